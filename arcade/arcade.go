@@ -1,12 +1,17 @@
 package arcade
 
 import (
+	"arcade/arcade/distributor"
 	"arcade/arcade/message"
+	"arcade/arcade/net"
+	"arcade/labgob"
 	"arcade/raft"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -15,6 +20,15 @@ type Arcade struct {
 	Port        int
 	LAN         bool
 
+	// Transport used to connect to other clients
+	Transport net.Transport
+
+	// Newest wire codec offered to other clients
+	Codec int
+
+	// Long-term keys of this player
+	Identity *net.Identity
+
 	Server *Server
 }
 
@@ -23,6 +37,8 @@ var arcade = NewArcade()
 func NewArcade() *Arcade {
 	return &Arcade{
 		Distributor: false,
+		Transport:   net.NewKCPTransport(),
+		Codec:       message.CodecLatest,
 	}
 }
 
@@ -30,15 +46,27 @@ func Start() {
 	dist := flag.Bool("distributor", false, "Run as a distributor")
 	flag.BoolVar(dist, "d", false, "Run as a distributor")
 
-	distributorAddr := flag.String("distributor-addr", "149.28.43.157:6824", "Distributor address")
-	flag.StringVar(distributorAddr, "da", "149.28.43.157:6824", "Distributor address")
+	distributorAddrs := flag.String("distributor-addr", "", "Comma-separated distributor addresses, tried in order (default from profile, or "+strings.Join(defaultDistributors, ",")+")")
+	flag.StringVar(distributorAddrs, "da", "", "Comma-separated distributor addresses, tried in order (default from profile, or "+strings.Join(defaultDistributors, ",")+")")
 
 	port := flag.Int("port", 6824, "Port to listen on")
 	flag.IntVar(port, "p", 6824, "Port to listen on")
 
 	nolan := flag.Bool("nolan", false, "Disable LAN scanning")
+
+	replayPath := flag.String("replay", "", "Play back a replay file")
+
+	transportName := flag.String("transport", "kcp", "Transport to connect to other clients with (kcp or tcp)")
+	jsonWire := flag.Bool("json-wire", false, "Send messages as JSON instead of binary, for debugging")
 	flag.Parse()
 
+	transport, err := net.NewTransport(*transportName)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	// Create log file
 	logName := fmt.Sprintf("log-%d", *port)
 	os.Remove(logName)
@@ -56,7 +84,10 @@ func Start() {
 
 	// Register messages
 	message.Register(AckGameUpdateMessage{Message: message.Message{Type: "ack_game_update"}})
+	message.Register(ChatMessage{Message: message.Message{Type: "chat"}})
 	message.Register(ClientUpdateMessage[TronClientState]{Message: message.Message{Type: "client_update"}})
+	message.Register(CountdownMessage{Message: message.Message{Type: "countdown"}})
+	message.Register(CountdownAckMessage{Message: message.Message{Type: "countdown_ack"}})
 	message.Register(DisconnectMessage{Message: message.Message{Type: "disconnect"}})
 	message.Register(EndGameMessage{Message: message.Message{Type: "end_game"}})
 	message.Register(ErrorMessage{Message: message.Message{Type: "error"}})
@@ -69,9 +100,23 @@ func Start() {
 	message.Register(LeaveMessage{Message: message.Message{Type: "leave"}})
 	message.Register(LobbyEndMessage{Message: message.Message{Type: "lobby_end"}})
 	message.Register(LobbyInfoMessage{Message: message.Message{Type: "lobby_info"}})
+	message.Register(ReadyMessage{Message: message.Message{Type: "ready"}})
+	message.Register(RematchMessage{Message: message.Message{Type: "rematch"}})
+	message.Register(SpectateMessage{Message: message.Message{Type: "spectate"}})
+	message.Register(SpectateReplyMessage{Message: message.Message{Type: "spectate_reply"}})
 	message.Register(StartGameMessage{Message: message.Message{Type: "start_game"}})
+	message.Register(StopSpectatingMessage{Message: message.Message{Type: "stop_spectating"}})
 	message.Register(ErrorMessage{Message: message.Message{Type: "error"}})
 
+	// register messages for talking to distributors
+	distributor.RegisterMessages()
+
+	// register Raft log commands, so they can be persisted
+	labgob.Register(map[string]interface{}{})
+	labgob.Register(json.Number(""))
+	labgob.Register(GameCommand[TronCommand]{})
+	labgob.Register(GameCommand[PongCommand]{})
+
 	// register Raft messages
 	message.Register(raft.RequestVoteArgs{Message: message.Message{Type: "RequestVote"}})
 	message.Register(raft.AppendEntriesArgs{Message: message.Message{Type: "AppendEntries"}})
@@ -84,16 +129,48 @@ func Start() {
 
 	arcade.Distributor = *dist
 	arcade.Port = *port
+	arcade.Transport = transport
 
+	if *jsonWire {
+		arcade.Codec = message.CodecJSON
+	}
+
+	arcade.Identity, err = LoadIdentity()
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Distributors have their own command now, but can still be started from
+	// the game with default limits
 	if arcade.Distributor {
-		arcade.Server = NewServer(fmt.Sprintf("0.0.0.0:%d", *port), *port, *dist, nil)
-		arcade.Server.Start(true)
-		os.Exit(0)
+		config := distributor.DefaultConfig()
+		config.Addr = fmt.Sprintf("0.0.0.0:%d", *port)
+		config.Transport = arcade.Transport
+		config.Identity = arcade.Identity
+		config.Codec = arcade.Codec
+		config.Log = os.Stdout
+
+		d, err := distributor.New(config)
+
+		if err == nil {
+			err = d.ListenAndServe()
+		}
+
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	// Start host server
+	// Start host server, coming back with the same ID if we crashed during a
+	// game
 	mgr := NewViewManager()
-	arcade.Server = NewServer(fmt.Sprintf("0.0.0.0:%d", *port), *port, *dist, mgr)
+	rejoinInfo, rejoinErr := LoadRejoinInfo()
+
+	if rejoinErr == nil && *replayPath == "" {
+		arcade.Server = NewServerWithSalt(rejoinInfo.IDSalt, fmt.Sprintf("0.0.0.0:%d", *port), *port, *dist, mgr)
+	} else {
+		arcade.Server = NewServer(fmt.Sprintf("0.0.0.0:%d", *port), *port, *dist, mgr)
+	}
 	arcade.Server.Network.Delegate = mgr
 
 	go arcade.Server.Start(*nolan)
@@ -101,10 +178,29 @@ func Start() {
 	// TODO: Make better solution for this later -- wait for server to start
 	time.Sleep(10 * time.Millisecond)
 
-	// Connect to distributor
-	go arcade.Server.Network.Connect(*distributorAddr, "", nil)
+	// Connect to a distributor, failing over to the next one if it goes away
+	go arcade.Server.KeepDistributorConnected(DistributorAddrs(*distributorAddrs))
 
 	// Start view manager
+	if *replayPath != "" {
+		replayView, err := NewReplayViewFromFile(mgr, *replayPath)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load replay:", err)
+			os.Exit(1)
+		}
+
+		mgr.Start(replayView)
+		return
+	}
+
+	if rejoinErr == nil {
+		if gameView := newGameView(mgr, rejoinInfo.Lobby); gameView != nil {
+			mgr.Start(gameView)
+			return
+		}
+	}
+
 	splashView := NewSplashView(mgr)
 	mgr.Start(splashView)
 }
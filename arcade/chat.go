@@ -0,0 +1,31 @@
+package arcade
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// ChatMessage is a line of chat sent by a lobby member to every other member.
+// It's shown under the name the lobby has in the sender's profile, so members
+// can't pass themselves off as someone else.
+type ChatMessage struct {
+	message.Message
+	LobbyID string
+	Text    string
+}
+
+func NewChatMessage(lobbyID string, text string) *ChatMessage {
+	return &ChatMessage{
+		Message: message.Message{Type: "chat"},
+		LobbyID: lobbyID,
+		Text:    text,
+	}
+}
+
+func (m ChatMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m ChatMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
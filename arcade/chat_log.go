@@ -0,0 +1,219 @@
+package arcade
+
+import (
+	"arcade/arcade/net"
+	"math"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Most lines kept in the scrollback
+const maxChatLines = 100
+
+// Longest line that can be sent and name that's shown, in runes
+const maxChatLength = 120
+const maxChatNameLength = 16
+
+type ChatLine struct {
+	Name string
+	Text string
+}
+
+// ChatLog keeps the conversation in the lobby we're in, along with the line
+// being typed. It's shared by the lobby and game views, so the conversation
+// carries on between games.
+type ChatLog struct {
+	sync.RWMutex
+
+	lobbyID string
+	lines   []ChatLine
+
+	typing bool
+	input  string
+}
+
+func NewChatLog() *ChatLog {
+	return &ChatLog{}
+}
+
+// switchLobby starts the scrollback over if it's for another lobby. Lock must
+// already be held.
+func (c *ChatLog) switchLobby(lobbyID string) {
+	if lobbyID != c.lobbyID {
+		c.lobbyID = lobbyID
+		c.lines = nil
+		c.typing = false
+		c.input = ""
+	}
+}
+
+// add appends a line to the scrollback of a lobby. Lock must already be held.
+func (c *ChatLog) add(lobbyID string, line ChatLine) {
+	c.switchLobby(lobbyID)
+	c.lines = append(c.lines, line)
+
+	if len(c.lines) > maxChatLines {
+		c.lines = c.lines[len(c.lines)-maxChatLines:]
+	}
+}
+
+// Send fans a line out to everyone else in the lobby, and adds it to our own
+// scrollback.
+func (c *ChatLog) Send(lobby *Lobby, text string) {
+	lobby.mu.RLock()
+	lobbyID := lobby.ID
+	memberIDs := append(append([]string{}, lobby.PlayerIDs...), lobby.SpectatorIDs...)
+	name := lobby.profile(arcade.Server.ID).Name
+	lobby.mu.RUnlock()
+
+	for _, memberID := range memberIDs {
+		if memberID == arcade.Server.ID {
+			continue
+		}
+
+		if client, ok := arcade.Server.Network.GetClient(memberID); ok {
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewChatMessage(lobbyID, text))
+		}
+	}
+
+	c.Lock()
+	c.add(lobbyID, ChatLine{Name: truncateRunes(name, maxChatNameLength), Text: text})
+	c.Unlock()
+}
+
+// Receive adds a line sent by someone in the lobby to the scrollback, under
+// the name in their profile, and returns false if it came from outside the
+// lobby.
+func (c *ChatLog) Receive(lobby *Lobby, msg *ChatMessage) bool {
+	lobby.mu.RLock()
+	lobbyID := lobby.ID
+	member := msg.SenderID == lobby.HostID || containsID(lobby.PlayerIDs, msg.SenderID) || containsID(lobby.SpectatorIDs, msg.SenderID)
+	name := lobby.profile(msg.SenderID).Name
+	lobby.mu.RUnlock()
+
+	if msg.LobbyID != lobbyID || !member || msg.Text == "" {
+		return false
+	}
+
+	c.Lock()
+	c.add(lobbyID, ChatLine{Name: truncateRunes(name, maxChatNameLength), Text: truncateRunes(msg.Text, maxChatLength)})
+	c.Unlock()
+
+	return true
+}
+
+// ProcessKey handles a key press for the chat, and returns false if it's not
+// for the chat. Tab starts and stops typing, and while typing Enter sends the
+// line. Other keys, like arrows, are left to the view.
+func (c *ChatLog) ProcessKey(lobby *Lobby, ev *tcell.EventKey) bool {
+	lobby.mu.RLock()
+	lobbyID := lobby.ID
+	lobby.mu.RUnlock()
+
+	c.Lock()
+	c.switchLobby(lobbyID)
+
+	if ev.Key() == tcell.KeyTab {
+		c.typing = !c.typing
+		c.Unlock()
+		return true
+	}
+
+	if !c.typing {
+		c.Unlock()
+		return false
+	}
+
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		text := c.input
+		c.input = ""
+		c.Unlock()
+
+		if text != "" {
+			c.Send(lobby, text)
+		}
+
+		return true
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if _, size := utf8.DecodeLastRuneInString(c.input); size > 0 {
+			c.input = c.input[:len(c.input)-size]
+		}
+	case tcell.KeyRune:
+		if utf8.RuneCountInString(c.input) < maxChatLength {
+			c.input += string(ev.Rune())
+		}
+	default:
+		c.Unlock()
+		return false
+	}
+
+	c.Unlock()
+	return true
+}
+
+// Typing returns true while a line is being typed.
+func (c *ChatLog) Typing() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.typing
+}
+
+// Render draws a box from (x1, y1) to (x2, y2) with the latest lines of the
+// lobby's scrollback that fit, and the line being typed at the bottom.
+func (c *ChatLog) Render(s *Screen, lobbyID string, x1, y1, x2, y2 int, sty, sty_bold tcell.Style) {
+	c.RLock()
+	defer c.RUnlock()
+
+	s.DrawEmpty(x1, y1, x2, y2, sty)
+	s.DrawBox(x1, y1, x2, y2, sty, false)
+
+	width := x2 - x1 - 3
+	inputY := y2 - 1
+
+	if c.typing {
+		input := "> " + c.input + "_"
+
+		// keep the end of long lines in view
+		if n := utf8.RuneCountInString(input); n > width {
+			input = string([]rune(input)[n-width:])
+		}
+
+		s.DrawText(x1+2, inputY, sty_bold, input)
+	} else {
+		s.DrawText(x1+2, inputY, sty, "[Tab] Chat")
+	}
+
+	lines := []ChatLine{}
+	if c.lobbyID == lobbyID {
+		lines = c.lines
+	}
+
+	rows := inputY - y1 - 1
+	start := int(math.Max(0, float64(len(lines)-rows)))
+
+	for i, line := range lines[start:] {
+		name := line.Name + ": "
+		s.DrawText(x1+2, y1+1+i, sty_bold, name)
+		s.DrawText(x1+2+utf8.RuneCountInString(name), y1+1+i, sty, truncateRunes(line.Text, width-utf8.RuneCountInString(name)))
+	}
+}
+
+func shortID(id string) string {
+	return truncateRunes(id, 8)
+}
+
+func truncateRunes(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+
+	return s
+}
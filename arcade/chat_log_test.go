@@ -0,0 +1,83 @@
+package arcade
+
+import (
+	"fmt"
+	"testing"
+)
+
+func newTestChatMessage(senderID string, lobbyID string, text string) *ChatMessage {
+	msg := NewChatMessage(lobbyID, text)
+	msg.SenderID = senderID
+	return msg
+}
+
+func TestChatLogReceive(t *testing.T) {
+	lobby := newTestLobby([]string{"a", "b"}, []string{"s"})
+	lobby.SetProfile("b", PlayerProfile{Name: "Bea"})
+
+	tests := []struct {
+		name     string
+		msg      *ChatMessage
+		received bool
+		line     ChatLine
+	}{
+		{"host", newTestChatMessage("a", lobby.ID, "hi"), true, ChatLine{shortID("a"), "hi"}},
+		{"player with a name", newTestChatMessage("b", lobby.ID, "hey"), true, ChatLine{"Bea", "hey"}},
+		{"spectator", newTestChatMessage("s", lobby.ID, "gl"), true, ChatLine{shortID("s"), "gl"}},
+		{"stranger", newTestChatMessage("x", lobby.ID, "spam"), false, ChatLine{}},
+		{"another lobby", newTestChatMessage("b", "other", "hey"), false, ChatLine{}},
+		{"empty line", newTestChatMessage("b", lobby.ID, ""), false, ChatLine{}},
+	}
+
+	for _, test := range tests {
+		c := NewChatLog()
+
+		if received := c.Receive(lobby, test.msg); received != test.received {
+			t.Errorf("%s: expected %v, got %v", test.name, test.received, received)
+			continue
+		}
+
+		if !test.received {
+			if len(c.lines) != 0 {
+				t.Errorf("%s: expected nothing in the scrollback, got %v", test.name, c.lines)
+			}
+
+			continue
+		}
+
+		if len(c.lines) != 1 || c.lines[0] != test.line {
+			t.Errorf("%s: expected %v in the scrollback, got %v", test.name, test.line, c.lines)
+		}
+	}
+}
+
+func TestChatLogStartsOverInAnotherLobby(t *testing.T) {
+	c := NewChatLog()
+
+	first := newTestLobby([]string{"a", "b"}, nil)
+	c.Receive(first, newTestChatMessage("b", first.ID, "first"))
+
+	second := newTestLobby([]string{"c", "b"}, nil)
+	c.Receive(second, newTestChatMessage("b", second.ID, "second"))
+
+	if len(c.lines) != 1 || c.lines[0].Text != "second" || c.lobbyID != second.ID {
+		t.Fatalf("expected only the line from the second lobby, got %v", c.lines)
+	}
+}
+
+func TestChatLogKeepsLatestLines(t *testing.T) {
+	c := NewChatLog()
+	lobby := newTestLobby([]string{"a", "b"}, nil)
+
+	for i := 0; i < maxChatLines+10; i++ {
+		c.Receive(lobby, newTestChatMessage("b", lobby.ID, fmt.Sprint(i)))
+	}
+
+	if len(c.lines) != maxChatLines {
+		t.Fatalf("expected %d lines, got %d", maxChatLines, len(c.lines))
+	}
+
+	if first, last := c.lines[0].Text, c.lines[len(c.lines)-1].Text; first != "10" || last != fmt.Sprint(maxChatLines+9) {
+		t.Fatalf("expected lines 10 to %d, got %s to %s", maxChatLines+9, first, last)
+	}
+}
@@ -0,0 +1,44 @@
+package arcade
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// CountdownMessage is sent by the host to every player right before a game
+// starts, or to call the start off if Cancel is set. Players acknowledge it,
+// and the host leaves out those that don't. The countdown itself runs in the
+// game, once it's started.
+type CountdownMessage struct {
+	message.Message
+	LobbyID string
+	Cancel  bool
+}
+
+type CountdownAckMessage struct {
+	message.Message
+	LobbyID string
+}
+
+func NewCountdownMessage(lobbyID string, cancel bool) *CountdownMessage {
+	return &CountdownMessage{
+		Message: message.Message{Type: "countdown"},
+		LobbyID: lobbyID,
+		Cancel:  cancel,
+	}
+}
+
+func NewCountdownAckMessage(lobbyID string) *CountdownAckMessage {
+	return &CountdownAckMessage{
+		Message: message.Message{Type: "countdown_ack"},
+		LobbyID: lobbyID,
+	}
+}
+
+func (m CountdownMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m CountdownAckMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,153 @@
+package arcade
+
+import (
+	"arcade/arcade/distributor"
+	"arcade/arcade/net"
+	"context"
+	"errors"
+	"time"
+)
+
+// How often the lobby we host is listed again with distributors, so it stays
+// in their directories and changes like new players show up.
+const lobbyRefreshInterval = 5 * time.Second
+
+// Distributors returns the distributors we're connected to.
+func (s *Server) Distributors() []*net.Client {
+	distributors := make([]*net.Client, 0)
+
+	s.Network.ClientsRange(func(client *net.Client) bool {
+		client.RLock()
+		defer client.RUnlock()
+
+		if client.Distributor && client.NextHop == "" && client.State == net.Connected {
+			distributors = append(distributors, client)
+		}
+
+		return true
+	})
+
+	return distributors
+}
+
+// PublishLobby lists a lobby we host in the distributors' directories, and
+// keeps it listed until UnpublishLobby is called. Calling it again with the
+// same lobby updates the listing right away.
+func (s *Server) PublishLobby(lobby *Lobby) {
+	s.Lock()
+	s.published = lobby
+	s.Unlock()
+
+	s.registerLobby()
+}
+
+// UnpublishLobby takes the lobby we host, if any, out of the directories.
+func (s *Server) UnpublishLobby() {
+	s.Lock()
+	lobby := s.published
+	s.published = nil
+	s.Unlock()
+
+	if lobby == nil {
+		return
+	}
+
+	lobby.mu.RLock()
+	lobbyID := lobby.ID
+	lobby.mu.RUnlock()
+
+	for _, client := range s.Distributors() {
+		s.Network.SendOn(client, net.Reliable, distributor.NewUnregisterLobbyMessage(lobbyID))
+	}
+}
+
+// registerLobby sends the listing of the lobby we host to every distributor.
+func (s *Server) registerLobby() {
+	s.RLock()
+	lobby := s.published
+	s.RUnlock()
+
+	if lobby == nil {
+		return
+	}
+
+	listing := lobby.Listing()
+
+	for _, client := range s.Distributors() {
+		s.Network.Send(client, distributor.NewRegisterLobbyMessage(listing))
+	}
+}
+
+// refreshLobbies keeps the lobby we host listed, since distributors forget
+// listings that aren't refreshed.
+func (s *Server) refreshLobbies() {
+	for {
+		time.Sleep(lobbyRefreshInterval)
+		s.registerLobby()
+	}
+}
+
+// QueryLobbies asks a distributor for a page of its directory, trying each
+// one we're connected to until one answers.
+func (s *Server) QueryLobbies(query distributor.LobbyQuery) ([]*Lobby, int, error) {
+	err := errors.New("not connected to a distributor")
+
+	for _, client := range s.Distributors() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		var reply *distributor.ListLobbiesReplyMessage
+		reply, err = net.Call[*distributor.ListLobbiesMessage, *distributor.ListLobbiesReplyMessage](ctx, s.Network, client, distributor.NewListLobbiesMessage(query))
+		cancel()
+
+		if err == nil {
+			return lobbiesFromListings(reply.Lobbies), reply.Total, nil
+		}
+	}
+
+	return nil, 0, err
+}
+
+func lobbiesFromListings(listings []distributor.LobbyListing) []*Lobby {
+
+	lobbies := make([]*Lobby, 0, len(listings))
+
+	for _, listing := range listings {
+		lobbies = append(lobbies, lobbyFromListing(listing))
+	}
+
+	return lobbies
+}
+
+// Listing returns what distributors need to know to list the lobby. The join
+// code of a private lobby stays with the host.
+func (l *Lobby) Listing() distributor.LobbyListing {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return distributor.LobbyListing{
+		ID:        l.ID,
+		Name:      l.Name,
+		GameType:  l.GameType,
+		HostID:    l.HostID,
+		Private:   l.Private,
+		InGame:    l.InGame,
+		Capacity:  l.Capacity,
+		PlayerIDs: append([]string{}, l.PlayerIDs...),
+		Ping:      l.Ping,
+	}
+}
+
+// lobbyFromListing returns a lobby with what a listing tells about it. It's
+// enough to show it in the games list and ask the host to join.
+func lobbyFromListing(listing distributor.LobbyListing) *Lobby {
+	return &Lobby{
+		ID:        listing.ID,
+		Name:      listing.Name,
+		GameType:  listing.GameType,
+		HostID:    listing.HostID,
+		Private:   listing.Private,
+		InGame:    listing.InGame,
+		Capacity:  listing.Capacity,
+		PlayerIDs: listing.PlayerIDs,
+		Ping:      listing.Ping,
+	}
+}
@@ -0,0 +1,166 @@
+package distributor
+
+import (
+	"arcade/arcade/net"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// ClientStats describes a client connected to the distributor.
+type ClientStats struct {
+	ID          string
+	PlayerID    string
+	Addr        string
+	ConnectedAt time.Time
+
+	// Round trip time to the client in milliseconds
+	RTT float64
+
+	// Messages from this client forwarded to others
+	Forwarded uint64
+
+	net.Traffic
+}
+
+// Stats describes the distributor as a whole.
+type Stats struct {
+	ID      string
+	Uptime  float64
+	Clients int
+	Peers   int
+	Lobbies int
+
+	// Messages forwarded between clients, in total and per second recently
+	Forwarded   uint64
+	ForwardRate float64
+
+	// Messages that couldn't be forwarded, and connections turned away
+	Dropped  uint64
+	Rejected uint64
+}
+
+// Clients returns stats on every client connected to the distributor, oldest
+// connection first.
+func (d *Distributor) Clients() []ClientStats {
+	d.RLock()
+	defer d.RUnlock()
+
+	clients := make([]ClientStats, 0, len(d.clients))
+
+	for id, info := range d.clients {
+		stats := ClientStats{
+			ID:          id,
+			PlayerID:    info.playerID,
+			Addr:        info.addr,
+			ConnectedAt: info.connectedAt,
+			Forwarded:   info.forwarded,
+		}
+
+		if client, ok := d.Network.GetClient(id); ok {
+			client.RLock()
+			stats.RTT = client.Distance
+			client.RUnlock()
+
+			stats.Traffic = client.Traffic()
+		}
+
+		clients = append(clients, stats)
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+
+	return clients
+}
+
+func (d *Distributor) Stats() Stats {
+	d.RLock()
+	defer d.RUnlock()
+
+	return Stats{
+		ID:          d.ID,
+		Uptime:      time.Since(d.started).Seconds(),
+		Clients:     len(d.clients),
+		Peers:       len(d.Peers()),
+		Lobbies:     len(d.Directory.Listings()),
+		Forwarded:   atomic.LoadUint64(&d.forwarded),
+		ForwardRate: d.forwardRate,
+		Dropped:     atomic.LoadUint64(&d.dropped),
+		Rejected:    atomic.LoadUint64(&d.rejected),
+	}
+}
+
+// AdminHandler serves the distributor's stats over HTTP. It's meant to be
+// served on a local address only:
+//
+//	/stats    the distributor as a whole, as JSON
+//	/clients  every connected client, as JSON
+//	/lobbies  every lobby in the directory, as JSON
+//	/metrics  the same numbers in Prometheus' text format
+func (d *Distributor) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.Stats())
+	})
+
+	mux.HandleFunc("/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.Clients())
+	})
+
+	mux.HandleFunc("/lobbies", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, d.Directory.Listings())
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		d.writeMetrics(w)
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func (d *Distributor) writeMetrics(w http.ResponseWriter) {
+	stats := d.Stats()
+
+	fmt.Fprintf(w, "# TYPE arcade_distributor_uptime_seconds gauge\narcade_distributor_uptime_seconds %g\n", stats.Uptime)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_clients gauge\narcade_distributor_clients %d\n", stats.Clients)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_peers gauge\narcade_distributor_peers %d\n", stats.Peers)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_lobbies gauge\narcade_distributor_lobbies %d\n", stats.Lobbies)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_forwarded_total counter\narcade_distributor_forwarded_total %d\n", stats.Forwarded)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_forward_rate gauge\narcade_distributor_forward_rate %g\n", stats.ForwardRate)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_dropped_total counter\narcade_distributor_dropped_total %d\n", stats.Dropped)
+	fmt.Fprintf(w, "# TYPE arcade_distributor_rejected_total counter\narcade_distributor_rejected_total %d\n", stats.Rejected)
+
+	clients := d.Clients()
+
+	for _, metric := range []struct {
+		name  string
+		value func(ClientStats) uint64
+	}{
+		{"client_bytes_in_total", func(c ClientStats) uint64 { return c.BytesIn }},
+		{"client_bytes_out_total", func(c ClientStats) uint64 { return c.BytesOut }},
+		{"client_messages_in_total", func(c ClientStats) uint64 { return c.MessagesIn }},
+		{"client_messages_out_total", func(c ClientStats) uint64 { return c.MessagesOut }},
+		{"client_forwarded_total", func(c ClientStats) uint64 { return c.Forwarded }},
+	} {
+		fmt.Fprintf(w, "# TYPE arcade_distributor_%s counter\n", metric.name)
+
+		for _, client := range clients {
+			fmt.Fprintf(w, "arcade_distributor_%s{client=%q} %d\n", metric.name, client.ID, metric.value(client))
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package distributor
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hosts refresh their listings every few seconds, so a listing that hasn't
+// been refreshed for this long belongs to a host that's gone.
+const listingTimeout = 15 * time.Second
+
+// Most lobbies one host can list at once. A host only runs one lobby at a
+// time, but may briefly list the next before the last one is removed.
+const maxListingsPerHost = 4
+
+const defaultPageSize = 10
+const maxPageSize = 50
+
+// LobbyListing is what the directory knows about a lobby. Join codes of
+// private lobbies are never sent to the distributor.
+type LobbyListing struct {
+	ID        string
+	Name      string
+	GameType  string
+	HostID    string
+	Private   bool
+	InGame    bool
+	Capacity  int
+	PlayerIDs []string
+
+	// Estimated round trip time in milliseconds between the host and the
+	// client asking, through the distributor. Filled in for each query.
+	Ping int
+}
+
+// FreeSlots returns how many more players can join the lobby.
+func (l LobbyListing) FreeSlots() int {
+	if free := l.Capacity - len(l.PlayerIDs); free > 0 {
+		return free
+	}
+
+	return 0
+}
+
+// LobbyQuery picks out a page of lobbies from the directory.
+type LobbyQuery struct {
+	// Only lobbies for this game, or any game if empty
+	GameType string
+
+	// Only lobbies with at least this many free slots
+	MinFreeSlots int
+
+	// Only lobbies at most this many milliseconds away, or any if zero
+	MaxPing int
+
+	// Page of results to return, counting from zero
+	Page     int
+	PageSize int
+}
+
+// Matches returns whether a listing passes the query's filters.
+func (q LobbyQuery) Matches(listing LobbyListing) bool {
+	if q.GameType != "" && listing.GameType != q.GameType {
+		return false
+	}
+
+	if listing.FreeSlots() < q.MinFreeSlots {
+		return false
+	}
+
+	if q.MaxPing > 0 && listing.Ping > q.MaxPing {
+		return false
+	}
+
+	return true
+}
+
+type directoryEntry struct {
+	listing LobbyListing
+	updated time.Time
+
+	// ID of the peer distributor the host listed the lobby with, or empty if
+	// it was listed with us
+	origin string
+}
+
+// Directory is the list of lobbies hosts have registered with the
+// distributor, along with the lobbies peer distributors have shared.
+type Directory struct {
+	sync.Mutex
+
+	entries map[string]*directoryEntry
+}
+
+func NewDirectory() *Directory {
+	return &Directory{
+		entries: make(map[string]*directoryEntry),
+	}
+}
+
+// Register adds a listing to the directory, or updates it if it's already
+// there. Only the host that first listed a lobby can change it, unless it left
+// and one of its players took the lobby over. A lobby a peer shared becomes
+// ours once its host lists it with us, e.g. after failing over from that peer.
+func (d *Directory) Register(listing LobbyListing, now time.Time) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if entry, ok := d.entries[listing.ID]; ok {
+		if entry.listing.HostID != listing.HostID && !handsOver(entry.listing, listing) {
+			return errors.New("lobby belongs to another host")
+		}
+
+		entry.listing = listing
+		entry.updated = now
+		entry.origin = ""
+		return nil
+	}
+
+	count := 0
+
+	for _, entry := range d.entries {
+		if entry.listing.HostID == listing.HostID && entry.origin == "" {
+			count++
+		}
+	}
+
+	if count >= maxListingsPerHost {
+		return errors.New("too many lobbies")
+	}
+
+	d.entries[listing.ID] = &directoryEntry{listing: listing, updated: now}
+	return nil
+}
+
+// handsOver returns true if next is the listing of a player that took the lobby
+// over from the host of prev, which players do once their host leaves.
+func handsOver(prev, next LobbyListing) bool {
+	wasPlayer := false
+
+	for _, playerID := range prev.PlayerIDs {
+		if playerID == next.HostID {
+			wasPlayer = true
+		}
+	}
+
+	for _, playerID := range next.PlayerIDs {
+		if playerID == prev.HostID {
+			return false
+		}
+	}
+
+	return wasPlayer
+}
+
+// Unregister removes a lobby from the directory, if hostID listed it.
+func (d *Directory) Unregister(hostID, lobbyID string) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	if entry, ok := d.entries[lobbyID]; !ok || entry.listing.HostID != hostID || entry.origin != "" {
+		return false
+	}
+
+	delete(d.entries, lobbyID)
+	return true
+}
+
+// RemoveHost removes every lobby a host listed, e.g. when it disconnects.
+func (d *Directory) RemoveHost(hostID string) {
+	d.Lock()
+	defer d.Unlock()
+
+	for id, entry := range d.entries {
+		if entry.listing.HostID == hostID {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// Merge replaces the lobbies shared by a peer distributor with listings. Our
+// own lobbies, and ones another peer shared first, are kept as they are.
+func (d *Directory) Merge(origin string, listings []LobbyListing, now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	for id, entry := range d.entries {
+		if entry.origin == origin {
+			delete(d.entries, id)
+		}
+	}
+
+	for _, listing := range listings {
+		if _, ok := d.entries[listing.ID]; ok {
+			continue
+		}
+
+		listing.Ping = 0
+		d.entries[listing.ID] = &directoryEntry{listing: listing, updated: now, origin: origin}
+	}
+}
+
+// RemoveOrigin removes every lobby a peer distributor shared, e.g. when it
+// disconnects.
+func (d *Directory) RemoveOrigin(origin string) {
+	d.Lock()
+	defer d.Unlock()
+
+	for id, entry := range d.entries {
+		if entry.origin == origin {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// Local returns the lobbies hosts listed with us, which are the ones we share
+// with peers. Lobbies peers shared aren't passed on, so every distributor
+// needs to be a peer of every other to see all lobbies.
+func (d *Directory) Local() []LobbyListing {
+	d.Lock()
+	defer d.Unlock()
+
+	listings := make([]LobbyListing, 0, len(d.entries))
+
+	for _, entry := range d.entries {
+		if entry.origin == "" {
+			listings = append(listings, entry.listing)
+		}
+	}
+
+	return listings
+}
+
+// Expire removes listings that haven't been refreshed in listingTimeout.
+func (d *Directory) Expire(now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	for id, entry := range d.entries {
+		if now.Sub(entry.updated) > listingTimeout {
+			delete(d.entries, id)
+		}
+	}
+}
+
+// Query returns a page of the lobbies matching query, closest first, along
+// with how many match in total. ping estimates the round trip time to a host,
+// and returns false for hosts that can't be reached.
+func (d *Directory) Query(query LobbyQuery, ping func(hostID string) (int, bool)) ([]LobbyListing, int) {
+	d.Lock()
+	listings := make([]LobbyListing, 0, len(d.entries))
+
+	for _, entry := range d.entries {
+		listings = append(listings, entry.listing)
+	}
+	d.Unlock()
+
+	matches := make([]LobbyListing, 0, len(listings))
+
+	for _, listing := range listings {
+		var ok bool
+
+		if listing.Ping, ok = ping(listing.HostID); ok && query.Matches(listing) {
+			matches = append(matches, listing)
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Ping != matches[j].Ping {
+			return matches[i].Ping < matches[j].Ping
+		}
+
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+
+		return matches[i].ID < matches[j].ID
+	})
+
+	pageSize := query.PageSize
+
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	start := query.Page * pageSize
+
+	if start < 0 || start >= len(matches) {
+		return []LobbyListing{}, len(matches)
+	}
+
+	end := start + pageSize
+
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	return matches[start:end], len(matches)
+}
+
+// Listings returns every lobby in the directory.
+func (d *Directory) Listings() []LobbyListing {
+	d.Lock()
+	defer d.Unlock()
+
+	listings := make([]LobbyListing, 0, len(d.entries))
+
+	for _, entry := range d.entries {
+		listings = append(listings, entry.listing)
+	}
+
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].ID < listings[j].ID
+	})
+
+	return listings
+}
@@ -0,0 +1,132 @@
+package distributor
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// RegisterMessages registers the messages clients exchange with a
+// distributor, and distributors with their peers. Distributors register them
+// when they're created, and clients need to before talking to one.
+func RegisterMessages() {
+	message.Register(RegisterLobbyMessage{Message: message.Message{Type: "register_lobby"}})
+	message.Register(UnregisterLobbyMessage{Message: message.Message{Type: "unregister_lobby"}})
+	message.Register(ListLobbiesMessage{Message: message.Message{Type: "list_lobbies"}})
+	message.Register(ListLobbiesReplyMessage{Message: message.Message{Type: "list_lobbies_reply"}})
+	message.Register(ShareLobbiesMessage{Message: message.Message{Type: "share_lobbies"}})
+}
+
+// RegisterLobbyMessage lists a lobby in the distributor's directory, or
+// updates its listing. Hosts send it every few seconds to keep it listed.
+type RegisterLobbyMessage struct {
+	message.Message
+
+	Listing LobbyListing
+}
+
+func NewRegisterLobbyMessage(listing LobbyListing) *RegisterLobbyMessage {
+	return &RegisterLobbyMessage{
+		Message: message.Message{Type: "register_lobby"},
+		Listing: listing,
+	}
+}
+
+func (m RegisterLobbyMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m RegisterLobbyMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// UnregisterLobbyMessage removes a lobby from the distributor's directory.
+type UnregisterLobbyMessage struct {
+	message.Message
+
+	LobbyID string
+}
+
+func NewUnregisterLobbyMessage(lobbyID string) *UnregisterLobbyMessage {
+	return &UnregisterLobbyMessage{
+		Message: message.Message{Type: "unregister_lobby"},
+		LobbyID: lobbyID,
+	}
+}
+
+func (m UnregisterLobbyMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m UnregisterLobbyMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// ListLobbiesMessage asks the distributor for a page of its directory.
+type ListLobbiesMessage struct {
+	message.Message
+
+	Query LobbyQuery
+}
+
+func NewListLobbiesMessage(query LobbyQuery) *ListLobbiesMessage {
+	return &ListLobbiesMessage{
+		Message: message.Message{Type: "list_lobbies"},
+		Query:   query,
+	}
+}
+
+func (m ListLobbiesMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m ListLobbiesMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// ListLobbiesReplyMessage has the page of lobbies asked for, and how many
+// lobbies matched the query in total.
+type ListLobbiesReplyMessage struct {
+	message.Message
+
+	Lobbies []LobbyListing
+	Total   int
+}
+
+func NewListLobbiesReplyMessage(lobbies []LobbyListing, total int) *ListLobbiesReplyMessage {
+	return &ListLobbiesReplyMessage{
+		Message: message.Message{Type: "list_lobbies_reply"},
+		Lobbies: lobbies,
+		Total:   total,
+	}
+}
+
+func (m ListLobbiesReplyMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m ListLobbiesReplyMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// ShareLobbiesMessage is sent between peer distributors every few seconds with
+// every lobby listed with the sender, replacing what it shared before.
+type ShareLobbiesMessage struct {
+	message.Message
+
+	Lobbies []LobbyListing
+}
+
+func NewShareLobbiesMessage(lobbies []LobbyListing) *ShareLobbiesMessage {
+	return &ShareLobbiesMessage{
+		Message: message.Message{Type: "share_lobbies"},
+		Lobbies: lobbies,
+	}
+}
+
+func (m ShareLobbiesMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m ShareLobbiesMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
@@ -0,0 +1,238 @@
+package distributor
+
+import (
+	"arcade/arcade/net"
+	"testing"
+	"time"
+)
+
+func everyoneAt(ping int) func(string) (int, bool) {
+	return func(string) (int, bool) {
+		return ping, true
+	}
+}
+
+func TestDirectoryOnlyLetsHostsChangeTheirLobbies(t *testing.T) {
+	directory := NewDirectory()
+	now := time.Now()
+
+	if err := directory.Register(LobbyListing{ID: "lobby", Name: "mine", HostID: "host"}, now); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	if err := directory.Register(LobbyListing{ID: "lobby", Name: "theirs", HostID: "other"}, now); err == nil {
+		t.Fatalf("expected another host not to be able to change the lobby")
+	}
+
+	if directory.Unregister("other", "lobby") {
+		t.Fatalf("expected another host not to be able to remove the lobby")
+	}
+
+	if err := directory.Register(LobbyListing{ID: "lobby", Name: "renamed", HostID: "host"}, now); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	if listings := directory.Listings(); len(listings) != 1 || listings[0].Name != "renamed" {
+		t.Fatalf("expected the renamed lobby, got %+v", listings)
+	}
+
+	if !directory.Unregister("host", "lobby") || len(directory.Listings()) != 0 {
+		t.Fatalf("expected the host to be able to remove the lobby")
+	}
+}
+
+func TestDirectoryHandsLobbiesOverToPlayers(t *testing.T) {
+	directory := NewDirectory()
+	now := time.Now()
+
+	directory.Register(LobbyListing{ID: "lobby", HostID: "host", PlayerIDs: []string{"host", "player"}}, now)
+
+	if err := directory.Register(LobbyListing{ID: "lobby", HostID: "player", PlayerIDs: []string{"host", "player"}}, now); err == nil {
+		t.Fatalf("expected players not to take the lobby over while the host is still in it")
+	}
+
+	if err := directory.Register(LobbyListing{ID: "lobby", HostID: "other", PlayerIDs: []string{"other"}}, now); err == nil {
+		t.Fatalf("expected only players to take the lobby over")
+	}
+
+	if err := directory.Register(LobbyListing{ID: "lobby", HostID: "player", PlayerIDs: []string{"player"}}, now); err != nil {
+		t.Fatalf("expected the player to take the lobby over once the host left, got %v", err)
+	}
+
+	if directory.Unregister("host", "lobby") {
+		t.Fatalf("expected the old host not to be able to remove the lobby")
+	}
+
+	if listings := directory.Listings(); len(listings) != 1 || listings[0].HostID != "player" {
+		t.Fatalf("expected the lobby to be listed by its new host, got %+v", listings)
+	}
+}
+
+func TestDirectoryLimitsLobbiesPerHost(t *testing.T) {
+	directory := NewDirectory()
+
+	for i := 0; i < maxListingsPerHost; i++ {
+		if err := directory.Register(LobbyListing{ID: string(rune('a' + i)), HostID: "host"}, time.Now()); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+
+	if err := directory.Register(LobbyListing{ID: "z", HostID: "host"}, time.Now()); err == nil {
+		t.Fatalf("expected a host to be limited to %d lobbies", maxListingsPerHost)
+	}
+}
+
+func TestDirectoryForgetsStaleLobbies(t *testing.T) {
+	directory := NewDirectory()
+	now := time.Now()
+
+	directory.Register(LobbyListing{ID: "old", HostID: "a"}, now)
+	directory.Register(LobbyListing{ID: "new", HostID: "b"}, now.Add(listingTimeout))
+	directory.Register(LobbyListing{ID: "gone", HostID: "c"}, now.Add(listingTimeout))
+
+	directory.Expire(now.Add(listingTimeout + time.Second))
+	directory.RemoveHost("c")
+
+	if listings := directory.Listings(); len(listings) != 1 || listings[0].ID != "new" {
+		t.Fatalf("expected only the refreshed lobby to be left, got %+v", listings)
+	}
+}
+
+func TestDirectoryMergesLobbiesFromPeers(t *testing.T) {
+	directory := NewDirectory()
+	now := time.Now()
+
+	directory.Register(LobbyListing{ID: "ours", HostID: "a"}, now)
+	directory.Merge("peer", []LobbyListing{{ID: "ours", HostID: "b"}, {ID: "theirs", HostID: "c"}, {ID: "moved", HostID: "d"}}, now)
+	directory.Merge("other", []LobbyListing{{ID: "theirs", HostID: "e"}}, now)
+
+	if listings := directory.Listings(); len(listings) != 3 || listings[1].HostID != "a" || listings[2].HostID != "c" {
+		t.Fatalf("expected our lobby and the first peer's to be kept, got %+v", listings)
+	}
+
+	if local := directory.Local(); len(local) != 1 || local[0].ID != "ours" {
+		t.Fatalf("expected only our lobby to be shared on, got %+v", local)
+	}
+
+	if directory.Unregister("c", "theirs") {
+		t.Fatalf("expected lobbies listed with a peer to be removed through it")
+	}
+
+	// A host that fails over to us takes its lobby along
+	if err := directory.Register(LobbyListing{ID: "moved", HostID: "d"}, now); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	directory.Merge("peer", []LobbyListing{}, now)
+
+	if listings := directory.Listings(); len(listings) != 2 || listings[0].ID != "moved" {
+		t.Fatalf("expected the peer's lobbies to be replaced, got %+v", listings)
+	}
+
+	directory.Merge("peer", []LobbyListing{{ID: "new", HostID: "f"}}, now)
+	directory.RemoveOrigin("peer")
+
+	if listings := directory.Listings(); len(listings) != 2 {
+		t.Fatalf("expected the peer's lobbies to be removed, got %+v", listings)
+	}
+}
+
+func TestDirectoryFiltersAndPages(t *testing.T) {
+	directory := NewDirectory()
+	now := time.Now()
+
+	directory.Register(LobbyListing{ID: "1", HostID: "near", GameType: "Tron", Capacity: 2, PlayerIDs: []string{"near"}}, now)
+	directory.Register(LobbyListing{ID: "2", HostID: "far", GameType: "Tron", Capacity: 2, PlayerIDs: []string{"far"}}, now)
+	directory.Register(LobbyListing{ID: "3", HostID: "full", GameType: "Tron", Capacity: 1, PlayerIDs: []string{"full"}}, now)
+	directory.Register(LobbyListing{ID: "4", HostID: "pong", GameType: "Pong", Capacity: 2, PlayerIDs: []string{"pong"}}, now)
+	directory.Register(LobbyListing{ID: "5", HostID: "gone", GameType: "Tron", Capacity: 2}, now)
+
+	pings := map[string]int{"near": 10, "far": 300, "full": 20, "pong": 30}
+
+	ping := func(hostID string) (int, bool) {
+		ping, ok := pings[hostID]
+		return ping, ok
+	}
+
+	ids := func(listings []LobbyListing) []string {
+		ids := make([]string, 0, len(listings))
+
+		for _, listing := range listings {
+			ids = append(ids, listing.ID)
+		}
+
+		return ids
+	}
+
+	for _, test := range []struct {
+		query LobbyQuery
+		ids   []string
+		total int
+	}{
+		// unreachable hosts are left out, and the rest sorted by ping
+		{LobbyQuery{}, []string{"1", "3", "4", "2"}, 4},
+		{LobbyQuery{GameType: "Tron"}, []string{"1", "3", "2"}, 3},
+		{LobbyQuery{MinFreeSlots: 1}, []string{"1", "4", "2"}, 3},
+		{LobbyQuery{MaxPing: 100}, []string{"1", "3", "4"}, 3},
+		{LobbyQuery{PageSize: 3, Page: 1}, []string{"2"}, 4},
+		{LobbyQuery{PageSize: 3, Page: 2}, []string{}, 4},
+	} {
+		listings, total := directory.Query(test.query, ping)
+
+		if got := ids(listings); total != test.total || len(got) != len(test.ids) {
+			t.Fatalf("query %+v: expected %v of %d, got %v of %d", test.query, test.ids, test.total, got, total)
+		} else {
+			for i := range got {
+				if got[i] != test.ids[i] {
+					t.Fatalf("query %+v: expected %v, got %v", test.query, test.ids, got)
+				}
+			}
+		}
+	}
+
+	if listings, _ := directory.Query(LobbyQuery{}, everyoneAt(42)); listings[0].Ping != 42 {
+		t.Fatalf("expected listings to come with their ping, got %+v", listings[0])
+	}
+}
+
+func TestClientsListLobbiesWithDistributor(t *testing.T) {
+	transport := net.NewMemoryTransport()
+	d := startTestDistributor(t, transport, DefaultConfig())
+
+	host, hostID := startTestClient(t, transport)
+	player, _ := startTestClient(t, transport)
+
+	for _, n := range []*net.Network{host, player} {
+		if _, err := n.Connect("memory:distributor", "", nil); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+	}
+
+	hostDistributor, _ := host.GetClient(d.ID)
+	playerDistributor, _ := player.GetClient(d.ID)
+
+	// hosts can't list lobbies as someone else
+	host.Send(hostDistributor, NewRegisterLobbyMessage(LobbyListing{ID: "lobby", Name: "tron", HostID: "someone", Capacity: 2}))
+
+	waitFor(t, "the lobby to be listed", func() bool {
+		return len(d.Directory.Listings()) == 1
+	})
+
+	res, err := player.SendAndReceive(playerDistributor, NewListLobbiesMessage(LobbyQuery{MinFreeSlots: 1}))
+
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	reply := res.(*ListLobbiesReplyMessage)
+
+	if reply.Total != 1 || reply.Lobbies[0].HostID != hostID || reply.Lobbies[0].Ping <= 0 {
+		t.Fatalf("expected the host's lobby with a ping, got %+v", reply)
+	}
+
+	host.Send(hostDistributor, NewUnregisterLobbyMessage("lobby"))
+
+	waitFor(t, "the lobby to be removed", func() bool {
+		return len(d.Directory.Listings()) == 0
+	})
+}
@@ -0,0 +1,492 @@
+// Package distributor runs a distributor: a server with a public address that
+// clients connect to in order to find and reach each other. It keeps a
+// directory of lobbies, forwards messages between clients that can't connect
+// directly, and helps them punch through NAT when they can.
+//
+// Messages between clients are sealed end to end, so the distributor only
+// ever sees their headers and never needs to know the game's message types.
+package distributor
+
+import (
+	"arcade/arcade/message"
+	"arcade/arcade/net"
+	"io"
+	gonet "net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How often forwarding rates are measured and idle clients are looked for.
+const statsInterval = time.Second
+
+// How long players are remembered after they disconnect, so they're
+// recognized when they come back in another session.
+const playerMemory = 24 * time.Hour
+
+type Config struct {
+	// Address to accept connections on
+	Addr string
+
+	// Most clients connected at once, in total and from one IP address. Zero
+	// means no limit.
+	MaxClients      int
+	MaxClientsPerIP int
+
+	// Clients that send nothing for this long are disconnected. Clients
+	// advertise routes every couple of seconds, so quiet ones are gone.
+	IdleTimeout time.Duration
+
+	Transport net.Transport
+	Identity  *net.Identity
+
+	// Newest wire codec offered to clients
+	Codec int
+
+	// Addresses of other distributors to federate with. Federated
+	// distributors share their clients and lobbies, so players connected to
+	// different ones can play together. Lobbies aren't passed on between
+	// peers, so every distributor should be a peer of every other, but a link
+	// only needs to be configured on one side of it.
+	Peers []string
+
+	// Where events are logged
+	Log io.Writer
+}
+
+// DefaultConfig returns the configuration the distributor command starts from.
+func DefaultConfig() Config {
+	return Config{
+		Addr:            "0.0.0.0:6824",
+		MaxClients:      1000,
+		MaxClientsPerIP: 16,
+		IdleTimeout:     10 * time.Second,
+		Transport:       net.NewKCPTransport(),
+		Codec:           message.CodecLatest,
+	}
+}
+
+// clientInfo is what the distributor keeps track of for each client connected
+// to it.
+type clientInfo struct {
+	addr        string
+	connectedAt time.Time
+
+	// Persistent ID of the player, see net.Identity.PlayerID
+	playerID string
+
+	// Messages this client sent that were forwarded to someone else
+	forwarded uint64
+
+	// Messages received from the client when it was last checked for being
+	// idle, and when that number last changed
+	messagesIn uint64
+	lastActive time.Time
+}
+
+type Distributor struct {
+	sync.RWMutex
+
+	Network *net.Network
+	ID      string
+
+	// Lobbies hosts have listed with us
+	Directory *Directory
+
+	config  Config
+	log     *Logger
+	started time.Time
+
+	clients map[string]*clientInfo
+
+	// When each player was last connected, by player ID
+	lastSeen map[string]time.Time
+
+	// IDs of the configured peers we've connected to, by address
+	peers map[string]string
+
+	// Updated atomically
+	forwarded uint64
+	dropped   uint64
+	rejected  uint64
+
+	// Messages forwarded per second, as of the last measurement
+	forwardRate float64
+}
+
+// New creates a distributor. It doesn't accept connections until Serve or
+// ListenAndServe is called.
+func New(config Config) (*Distributor, error) {
+	if config.Identity == nil {
+		identity, err := net.GenerateIdentity()
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Identity = identity
+	}
+
+	if config.Log == nil {
+		config.Log = io.Discard
+	}
+
+	salt := uuid.NewString()
+
+	network := net.NewNetwork(config.Identity, salt, 0, true, config.Transport)
+	network.SetCodec(config.Codec)
+
+	d := &Distributor{
+		Network:  network,
+		ID:       config.Identity.SessionID(salt),
+		config:   config,
+		log:      NewLogger(config.Log),
+		started:  time.Now(),
+		clients:  make(map[string]*clientInfo),
+		lastSeen: make(map[string]time.Time),
+		peers:    make(map[string]string),
+
+		Directory: NewDirectory(),
+	}
+
+	network.Delegate = d
+	RegisterMessages()
+
+	net.Handle(network, d.registerLobby)
+	net.Handle(network, d.unregisterLobby)
+	net.Handle(network, d.listLobbies)
+	net.Handle(network, d.mergeLobbies)
+
+	message.AddListener(message.Listener{
+		Distributor: true,
+		ServerID:    d.ID,
+		Handle:      d.handleMessage,
+	})
+
+	go d.measure()
+
+	return d, nil
+}
+
+// ListenAndServe accepts connections on the configured address until the
+// listener fails.
+func (d *Distributor) ListenAndServe() error {
+	listener, err := d.Network.Listen(d.config.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	return d.Serve(listener)
+}
+
+// Serve accepts connections from listener until it fails.
+func (d *Distributor) Serve(listener gonet.Listener) error {
+	d.log.Info("listening", "addr", listener.Addr(), "id", d.ID)
+
+	go d.federate()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			d.log.Warn("stopped_listening", "err", err)
+			return err
+		}
+
+		if reason := d.admit(conn.RemoteAddr().String()); reason != "" {
+			atomic.AddUint64(&d.rejected, 1)
+			d.log.Warn("connection_rejected", "addr", conn.RemoteAddr(), "reason", reason)
+			conn.Close()
+			continue
+		}
+
+		go d.Network.Connect(conn.RemoteAddr().String(), "", conn)
+	}
+}
+
+// admit returns why a connection from addr can't be accepted, or an empty
+// string if it can.
+func (d *Distributor) admit(addr string) string {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.config.MaxClients > 0 && len(d.clients) >= d.config.MaxClients {
+		return "too many clients"
+	}
+
+	if d.config.MaxClientsPerIP > 0 {
+		host := hostOf(addr)
+		count := 0
+
+		for _, client := range d.clients {
+			if hostOf(client.addr) == host {
+				count++
+			}
+		}
+
+		if count >= d.config.MaxClientsPerIP {
+			return "too many clients from address"
+		}
+	}
+
+	return ""
+}
+
+func (d *Distributor) handleMessage(client, msg interface{}) interface{} {
+	c := client.(*net.Client)
+
+	// Ignore messages that arrived on another network, e.g. in tests
+	if c.Delegate != d.Network {
+		return nil
+	}
+
+	header := msg.(message.Envelope).Header()
+
+	// Messages for us go to the network or the handlers registered in New
+	switch msg.(type) {
+	case *net.PingMessage, *net.PongMessage, *net.RoutingMessage, *net.PunchRequestMessage, *net.PunchMessage, *net.AckMessage:
+		return nil
+	}
+
+	if header.RecipientID == d.ID || header.RecipientID == "" {
+		atomic.AddUint64(&d.dropped, 1)
+		d.log.Warn("misaddressed_message", "type", header.Type, "from", header.SenderID)
+		return nil
+	}
+
+	recipient, ok := d.Network.GetClient(header.RecipientID)
+
+	if !ok || !d.Network.SendRaw(recipient, msg) {
+		atomic.AddUint64(&d.dropped, 1)
+		d.log.Warn("unknown_recipient", "type", header.Type, "from", header.SenderID, "to", header.RecipientID)
+		return nil
+	}
+
+	atomic.AddUint64(&d.forwarded, 1)
+
+	d.Lock()
+	if info, ok := d.clients[header.SenderID]; ok {
+		info.forwarded++
+	}
+	d.Unlock()
+
+	return nil
+}
+
+func (d *Distributor) registerLobby(from *net.Client, msg *RegisterLobbyMessage) (interface{}, error) {
+	// Hosts can only list their own lobbies
+	listing := msg.Listing
+	listing.HostID = msg.SenderID
+	listing.Ping = 0
+
+	if err := d.Directory.Register(listing, time.Now()); err != nil {
+		d.log.Warn("lobby_rejected", "id", listing.ID, "host", listing.HostID, "err", err)
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (d *Distributor) unregisterLobby(from *net.Client, msg *UnregisterLobbyMessage) (interface{}, error) {
+	if d.Directory.Unregister(msg.SenderID, msg.LobbyID) {
+		d.log.Info("lobby_unregistered", "id", msg.LobbyID, "host", msg.SenderID)
+	}
+
+	return nil, nil
+}
+
+func (d *Distributor) listLobbies(from *net.Client, msg *ListLobbiesMessage) (interface{}, error) {
+	lobbies, total := d.Directory.Query(msg.Query, d.pingFrom(msg.SenderID))
+	return NewListLobbiesReplyMessage(lobbies, total), nil
+}
+
+// pingFrom returns a function estimating the round trip time from a client to
+// a host through us, from the round trip times of our links to each.
+func (d *Distributor) pingFrom(clientID string) func(hostID string) (int, bool) {
+	routes := d.Network.GetRoutes()
+
+	return func(hostID string) (int, bool) {
+		host, ok := routes[hostID]
+
+		if !ok {
+			return 0, false
+		}
+
+		return int(routes[clientID].Distance + host.Distance), true
+	}
+}
+
+// measure periodically works out forwarding rates and disconnects clients
+// that have gone quiet.
+func (d *Distributor) measure() {
+	lastForwarded := uint64(0)
+	lastMeasured := time.Now()
+
+	for {
+		time.Sleep(statsInterval)
+
+		now := time.Now()
+		forwarded := atomic.LoadUint64(&d.forwarded)
+
+		d.Lock()
+		d.forwardRate = float64(forwarded-lastForwarded) / now.Sub(lastMeasured).Seconds()
+		d.Unlock()
+
+		lastForwarded, lastMeasured = forwarded, now
+
+		d.Directory.Expire(now)
+		d.forgetPlayers(now)
+
+		for _, id := range d.idleClients(now) {
+			d.log.Info("client_idle", "id", id)
+			d.Network.Disconnect(id)
+		}
+	}
+}
+
+// idleClients returns the clients that haven't sent anything for longer than
+// the idle timeout.
+func (d *Distributor) idleClients(now time.Time) []string {
+	idle := make([]string, 0)
+
+	if d.config.IdleTimeout <= 0 {
+		return idle
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	for id, info := range d.clients {
+		client, ok := d.Network.GetClient(id)
+
+		if !ok {
+			continue
+		}
+
+		if messagesIn := client.Traffic().MessagesIn; messagesIn != info.messagesIn {
+			info.messagesIn = messagesIn
+			info.lastActive = now
+		} else if now.Sub(info.lastActive) > d.config.IdleTimeout {
+			idle = append(idle, id)
+		}
+	}
+
+	return idle
+}
+
+//
+// NetworkDelegate methods
+//
+
+func (d *Distributor) ClientConnected(clientID string) {
+	client, ok := d.Network.GetClient(clientID)
+
+	if !ok {
+		return
+	}
+
+	client.RLock()
+	addr := client.Addr
+	client.RUnlock()
+
+	playerID := client.PlayerID()
+	now := time.Now()
+
+	d.Lock()
+	d.clients[clientID] = &clientInfo{
+		addr:        addr,
+		connectedAt: now,
+		playerID:    playerID,
+		lastActive:  now,
+	}
+	_, returning := d.lastSeen[playerID]
+	d.lastSeen[playerID] = now
+	count := len(d.clients)
+	d.Unlock()
+
+	d.log.Info("client_connected", "id", clientID, "player", playerID, "returning", returning, "addr", addr, "clients", count)
+}
+
+// PlayerID returns the persistent ID of the player behind a connected client,
+// which stays the same across their sessions.
+func (d *Distributor) PlayerID(clientID string) (string, bool) {
+	d.RLock()
+	defer d.RUnlock()
+
+	info, ok := d.clients[clientID]
+
+	if !ok {
+		return "", false
+	}
+
+	return info.playerID, true
+}
+
+// LastSeen returns when a player was last connected, in any session, or false
+// if they haven't been in the last playerMemory.
+func (d *Distributor) LastSeen(playerID string) (time.Time, bool) {
+	d.RLock()
+	defer d.RUnlock()
+
+	for _, info := range d.clients {
+		if info.playerID == playerID {
+			return time.Now(), true
+		}
+	}
+
+	seen, ok := d.lastSeen[playerID]
+	return seen, ok
+}
+
+// forgetPlayers forgets players that haven't been connected for playerMemory.
+func (d *Distributor) forgetPlayers(now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	for playerID, seen := range d.lastSeen {
+		if now.Sub(seen) > playerMemory {
+			delete(d.lastSeen, playerID)
+		}
+	}
+}
+
+func (d *Distributor) ClientDisconnected(clientID string) {
+	d.Lock()
+	info, ok := d.clients[clientID]
+	delete(d.clients, clientID)
+	if ok {
+		d.lastSeen[info.playerID] = time.Now()
+	}
+	count := len(d.clients)
+	d.Unlock()
+
+	d.Directory.RemoveHost(clientID)
+	d.Directory.RemoveOrigin(clientID)
+
+	if !ok {
+		d.RLock()
+		for addr, id := range d.peers {
+			if id == clientID {
+				d.log.Warn("peer_disconnected", "addr", addr, "id", id)
+			}
+		}
+		d.RUnlock()
+
+		return
+	}
+
+	d.log.Info("client_disconnected", "id", clientID, "player", info.playerID, "addr", info.addr, "connected_for", time.Since(info.connectedAt).Round(time.Second), "clients", count)
+}
+
+func hostOf(addr string) string {
+	host, _, err := gonet.SplitHostPort(addr)
+
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
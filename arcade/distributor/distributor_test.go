@@ -0,0 +1,293 @@
+package distributor
+
+import (
+	"arcade/arcade/message"
+	"arcade/arcade/net"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type echoMessage struct {
+	message.Message
+	Text string
+}
+
+func init() {
+	message.Register(echoMessage{Message: message.Message{Type: "echo"}})
+}
+
+func startTestDistributor(t *testing.T, transport *net.MemoryTransport, config Config) *Distributor {
+	if !strings.HasPrefix(config.Addr, "memory:") {
+		config.Addr = "memory:distributor"
+	}
+
+	config.Transport = transport
+
+	d, err := New(config)
+
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	listener, err := d.Network.Listen(config.Addr)
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go d.Serve(listener)
+
+	return d
+}
+
+// startTestClient starts a client that answers every echo message it gets.
+func startTestClient(t *testing.T, transport *net.MemoryTransport) (*net.Network, string) {
+	identity, err := net.GenerateIdentity()
+
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+
+	return startTestSession(t, transport, identity)
+}
+
+// startTestSession starts a client like startTestClient, for a new session of
+// the player with the given identity.
+func startTestSession(t *testing.T, transport *net.MemoryTransport, identity *net.Identity) (*net.Network, string) {
+	salt := uuid.NewString()
+	n := net.NewNetwork(identity, salt, 0, false, transport)
+	id := identity.SessionID(salt)
+
+	message.AddListener(message.Listener{
+		ServerID: id,
+		Handle: func(c, msg interface{}) interface{} {
+			if c.(*net.Client).Delegate != n {
+				return nil
+			}
+
+			header := reflect.ValueOf(msg).Elem().FieldByName("Message").Interface().(message.Message)
+			n.SignalReceived(header.MessageID, msg)
+
+			if msg, ok := msg.(*echoMessage); ok && !strings.HasPrefix(msg.Text, "re: ") {
+				return &echoMessage{Message: message.Message{Type: "echo"}, Text: "re: " + msg.Text}
+			}
+
+			return nil
+		},
+	})
+
+	return n, id
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	waitForWithin(t, what, time.Second, done)
+}
+
+func waitForWithin(t *testing.T, what string, timeout time.Duration, done func() bool) {
+	t.Helper()
+
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(10 * time.Millisecond) {
+		if done() {
+			return
+		}
+	}
+
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDistributorForwardsBetweenClients(t *testing.T) {
+	transport := net.NewMemoryTransport()
+	d := startTestDistributor(t, transport, DefaultConfig())
+
+	a, _ := startTestClient(t, transport)
+	b, bID := startTestClient(t, transport)
+
+	for _, n := range []*net.Network{a, b} {
+		if _, err := n.Connect("memory:distributor", "", nil); err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+	}
+
+	var client *net.Client
+
+	waitFor(t, "a to learn a route to b", func() bool {
+		client, _ = a.GetClient(bID)
+		return client != nil
+	})
+
+	res, err := a.SendAndReceive(client, &echoMessage{Message: message.Message{Type: "echo"}, Text: "hello"})
+
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if reply := res.(*echoMessage); reply.Text != "re: hello" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+
+	// The echo and its reply are each acknowledged, so that's 4 messages
+	waitFor(t, "the acknowledgements to be forwarded", func() bool {
+		return d.Stats().Forwarded == 4
+	})
+
+	if stats := d.Stats(); stats.Clients != 2 {
+		t.Fatalf("expected 2 clients, got %+v", stats)
+	}
+
+	for _, client := range d.Clients() {
+		if client.Forwarded != 2 || client.BytesIn == 0 || client.MessagesOut == 0 {
+			t.Fatalf("expected traffic to be counted, got %+v", client)
+		}
+	}
+}
+
+func TestDistributorLimitsClientsPerAddress(t *testing.T) {
+	transport := net.NewMemoryTransport()
+
+	config := DefaultConfig()
+	config.MaxClientsPerIP = 1
+
+	d := startTestDistributor(t, transport, config)
+
+	a, _ := startTestClient(t, transport)
+	b, _ := startTestClient(t, transport)
+
+	if _, err := a.Connect("memory:distributor", "", nil); err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+
+	waitFor(t, "a to be counted", func() bool {
+		return d.Stats().Clients == 1
+	})
+
+	// every in-memory client has the same host
+	if _, err := b.Connect("memory:distributor", "", nil); err == nil {
+		t.Fatalf("expected b to be turned away")
+	}
+
+	if stats := d.Stats(); stats.Clients != 1 || stats.Rejected != 1 {
+		t.Fatalf("expected 1 client and 1 rejected connection, got %+v", stats)
+	}
+}
+
+func TestDistributorDisconnectsIdleClients(t *testing.T) {
+	transport := net.NewMemoryTransport()
+
+	config := DefaultConfig()
+	config.IdleTimeout = time.Millisecond
+
+	d := startTestDistributor(t, transport, config)
+	a, _ := startTestClient(t, transport)
+
+	if _, err := a.Connect("memory:distributor", "", nil); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	waitFor(t, "a to be counted", func() bool {
+		return d.Stats().Clients == 1
+	})
+
+	// a advertises routes every couple of seconds, so it's quiet for at least
+	// one of the next few checks
+	for start := time.Now(); d.Stats().Clients > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*statsInterval {
+			t.Fatalf("expected idle client to be disconnected")
+		}
+	}
+}
+
+func TestAdminHandlerServesStats(t *testing.T) {
+	d := startTestDistributor(t, net.NewMemoryTransport(), DefaultConfig())
+	handler := d.AdminHandler()
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/stats", nil))
+
+	var stats Stats
+
+	if err := json.Unmarshal(res.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+
+	if stats.ID != d.ID {
+		t.Fatalf("expected stats for %s, got %+v", d.ID, stats)
+	}
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.Contains(res.Body.String(), "\narcade_distributor_clients 0\n") {
+		t.Fatalf("expected client count in metrics, got:\n%s", res.Body)
+	}
+}
+
+func TestLoggerQuotesValues(t *testing.T) {
+	var out bytes.Buffer
+	NewLogger(&out).Warn("test_event", "plain", "abc", "spaced", "a b", "empty", "", "odd")
+
+	line := out.String()
+	line = line[strings.Index(line, " level="):]
+
+	if expected := ` level=warn event=test_event plain=abc spaced="a b" empty="" odd=(missing)` + "\n"; line != expected {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+}
+
+func TestDistributorRecognizesReturningPlayers(t *testing.T) {
+	transport := net.NewMemoryTransport()
+	d := startTestDistributor(t, transport, DefaultConfig())
+
+	identity, err := net.GenerateIdentity()
+
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+
+	first, firstID := startTestSession(t, transport, identity)
+
+	if _, err := first.Connect("memory:distributor", "", nil); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	waitFor(t, "the first session to connect", func() bool {
+		playerID, ok := d.PlayerID(firstID)
+		return ok && playerID == identity.PlayerID()
+	})
+
+	d.Network.Disconnect(firstID)
+
+	if _, ok := d.LastSeen(identity.PlayerID()); !ok {
+		t.Fatalf("expected the player to be remembered after disconnecting")
+	}
+
+	second, secondID := startTestSession(t, transport, identity)
+
+	if _, err := second.Connect("memory:distributor", "", nil); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	if secondID == firstID {
+		t.Fatalf("expected every session to have its own ID")
+	}
+
+	waitFor(t, "the second session to be recognized", func() bool {
+		playerID, ok := d.PlayerID(secondID)
+		return ok && playerID == identity.PlayerID()
+	})
+
+	d.forgetPlayers(time.Now().Add(playerMemory + time.Second))
+
+	if _, ok := d.LastSeen(identity.PlayerID()); !ok {
+		t.Fatalf("expected connected players not to be forgotten")
+	}
+}
@@ -0,0 +1,98 @@
+package distributor
+
+import (
+	"arcade/arcade/net"
+	"errors"
+	"time"
+)
+
+// How often we reconnect to peers that went away, and share our lobbies with
+// the ones we're connected to.
+const federationInterval = 2 * time.Second
+
+// Peers returns the peer distributors we're connected to, whether we
+// connected to them or they connected to us.
+func (d *Distributor) Peers() []*net.Client {
+	peers := make([]*net.Client, 0)
+
+	d.Network.ClientsRange(func(client *net.Client) bool {
+		if isPeer(client) {
+			peers = append(peers, client)
+		}
+
+		return true
+	})
+
+	return peers
+}
+
+func isPeer(client *net.Client) bool {
+	client.RLock()
+	defer client.RUnlock()
+
+	return client.Distributor && client.NextHop == "" && client.State == net.Connected
+}
+
+// federate keeps us connected to the configured peers, and shares our lobbies
+// with every peer. Clients of our peers are reached through the routes they
+// advertise like any other, so that's all it takes for players on different
+// distributors to find and reach each other.
+func (d *Distributor) federate() {
+	for {
+		d.connectPeers()
+		d.shareLobbies()
+
+		time.Sleep(federationInterval)
+	}
+}
+
+// connectPeers connects to every configured peer we aren't connected to.
+func (d *Distributor) connectPeers() {
+	for _, addr := range d.config.Peers {
+		d.RLock()
+		id, ok := d.peers[addr]
+		d.RUnlock()
+
+		if client, connected := d.Network.GetClient(id); ok && connected && isPeer(client) {
+			continue
+		}
+
+		client, err := d.Network.Connect(addr, "", nil)
+
+		if err != nil {
+			d.log.Warn("peer_unreachable", "addr", addr, "err", err)
+			continue
+		}
+
+		client.RLock()
+		id = client.ID
+		client.RUnlock()
+
+		d.Lock()
+		d.peers[addr] = id
+		d.Unlock()
+
+		d.log.Info("peer_connected", "addr", addr, "id", id)
+	}
+}
+
+// shareLobbies sends the lobbies listed with us to every peer.
+func (d *Distributor) shareLobbies() {
+	lobbies := d.Directory.Local()
+
+	for _, peer := range d.Peers() {
+		d.Network.Send(peer, NewShareLobbiesMessage(lobbies))
+	}
+}
+
+func (d *Distributor) mergeLobbies(from *net.Client, msg *ShareLobbiesMessage) (interface{}, error) {
+	peer, ok := d.Network.GetClient(msg.SenderID)
+
+	if !ok || !isPeer(peer) {
+		d.log.Warn("lobbies_rejected", "from", msg.SenderID, "reason", "not a peer")
+		return nil, errors.New("not a peer")
+	}
+
+	d.Directory.Merge(msg.SenderID, msg.Lobbies, time.Now())
+	return nil, nil
+}
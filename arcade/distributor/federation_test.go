@@ -0,0 +1,106 @@
+package distributor
+
+import (
+	"arcade/arcade/message"
+	"arcade/arcade/net"
+	"testing"
+	"time"
+)
+
+func TestFederatedDistributorsShareClientsAndLobbies(t *testing.T) {
+	transport := net.NewMemoryTransport()
+
+	config := DefaultConfig()
+	config.Addr = "memory:east"
+	east := startTestDistributor(t, transport, config)
+
+	config = DefaultConfig()
+	config.Addr = "memory:west"
+	config.Peers = []string{"memory:east"}
+	west := startTestDistributor(t, transport, config)
+
+	waitFor(t, "the distributors to federate", func() bool {
+		return len(east.Peers()) == 1 && len(west.Peers()) == 1
+	})
+
+	host, hostID := startTestClient(t, transport)
+	player, _ := startTestClient(t, transport)
+
+	if _, err := host.Connect("memory:east", "", nil); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	if _, err := player.Connect("memory:west", "", nil); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// Players on one distributor reach hosts on the other through both
+	var client *net.Client
+
+	waitFor(t, "the player to learn a route to the host", func() bool {
+		client, _ = player.GetClient(hostID)
+		return client != nil
+	})
+
+	res, err := player.SendAndReceive(client, &echoMessage{Message: message.Message{Type: "echo"}, Text: "hello"})
+
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if reply := res.(*echoMessage); reply.Text != "re: hello" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+
+	// and see the lobbies listed with the other
+	hostDistributor, _ := host.GetClient(east.ID)
+	host.Send(hostDistributor, NewRegisterLobbyMessage(LobbyListing{ID: "lobby", Name: "tron", Capacity: 2}))
+
+	waitForWithin(t, "the lobby to be shared", 2*federationInterval, func() bool {
+		return len(west.Directory.Listings()) == 1
+	})
+
+	playerDistributor, _ := player.GetClient(west.ID)
+	res, err = player.SendAndReceive(playerDistributor, NewListLobbiesMessage(LobbyQuery{}))
+
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	if reply := res.(*ListLobbiesReplyMessage); reply.Total != 1 || reply.Lobbies[0].HostID != hostID || reply.Lobbies[0].Ping <= 0 {
+		t.Fatalf("expected the host's lobby with a ping, got %+v", reply)
+	}
+
+	// Lobbies go away along with the peer that shared them
+	west.Network.Disconnect(east.ID)
+
+	waitFor(t, "the shared lobby to be removed", func() bool {
+		return len(west.Directory.Listings()) == 0
+	})
+
+	// until it's reconnected to
+	waitForWithin(t, "the distributors to federate again", 2*federationInterval, func() bool {
+		return len(west.Peers()) == 1
+	})
+}
+
+func TestDistributorsOnlyMergeLobbiesFromPeers(t *testing.T) {
+	transport := net.NewMemoryTransport()
+	d := startTestDistributor(t, transport, DefaultConfig())
+
+	client, _ := startTestClient(t, transport)
+	distributor, err := client.Connect("memory:distributor", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	client.Send(distributor, NewShareLobbiesMessage([]LobbyListing{{ID: "lobby", HostID: "someone"}}))
+	client.Send(distributor, NewListLobbiesMessage(LobbyQuery{}))
+
+	time.Sleep(100 * time.Millisecond)
+
+	if listings := d.Directory.Listings(); len(listings) != 0 {
+		t.Fatalf("expected clients not to be able to share lobbies, got %+v", listings)
+	}
+}
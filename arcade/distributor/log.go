@@ -0,0 +1,65 @@
+package distributor
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger writes one line per event as key=value pairs, so that logs can be
+// searched and parsed without guessing at their format.
+type Logger struct {
+	sync.Mutex
+
+	out io.Writer
+}
+
+func NewLogger(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+// Info logs an event with fields given as alternating keys and values.
+func (l *Logger) Info(event string, fields ...interface{}) {
+	l.log("info", event, fields)
+}
+
+// Warn logs an event that means something went wrong, but not badly enough to
+// stop.
+func (l *Logger) Warn(event string, fields ...interface{}) {
+	l.log("warn", event, fields)
+}
+
+func (l *Logger) log(level, event string, fields []interface{}) {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "time=%s level=%s event=%s", time.Now().UTC().Format(time.RFC3339Nano), level, quote(event))
+
+	for i := 0; i < len(fields); i += 2 {
+		var value interface{} = "(missing)"
+
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+
+		fmt.Fprintf(&b, " %v=%s", fields[i], quote(fmt.Sprint(value)))
+	}
+
+	b.WriteByte('\n')
+
+	l.Lock()
+	defer l.Unlock()
+
+	io.WriteString(l.out, b.String())
+}
+
+// quote quotes values that would otherwise be read as more than one field.
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\n\t") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
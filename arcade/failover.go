@@ -0,0 +1,78 @@
+package arcade
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// The distributors players connect to unless the command line or their
+// profile lists others, in the order they're tried
+var defaultDistributors = []string{"149.28.43.157:6824"}
+
+// How often we check that we're still connected to a distributor. Silent
+// distributors are disconnected by the network, so this is how soon after
+// that we fail over.
+const distributorCheckInterval = 2 * time.Second
+
+// DistributorAddrs returns the distributors to connect to: the ones in addrs,
+// a comma-separated list from the command line, or else the ones in the
+// player's profile, or else the defaults.
+func DistributorAddrs(addrs string) []string {
+	list := make([]string, 0)
+
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			list = append(list, addr)
+		}
+	}
+
+	if len(list) > 0 {
+		return list
+	}
+
+	if profile, err := LoadProfile(); err == nil && len(profile.Distributors) > 0 {
+		return profile.Distributors
+	}
+
+	return defaultDistributors
+}
+
+// KeepDistributorConnected connects to the first distributor in addrs that
+// answers, and whenever we lose it, to the next one that does. Federated
+// distributors share their clients and lobbies, so it doesn't matter which
+// one we end up on.
+func (s *Server) KeepDistributorConnected(addrs []string) {
+	next := 0
+
+	for {
+		if len(s.Distributors()) == 0 {
+			next = s.connectDistributor(addrs, next)
+		}
+
+		time.Sleep(distributorCheckInterval)
+	}
+}
+
+// connectDistributor tries each distributor once, starting at addrs[start],
+// and returns where to start next time. That's after the one we connected to,
+// so a distributor that goes away is tried last.
+func (s *Server) connectDistributor(addrs []string, start int) int {
+	for i := range addrs {
+		index := (start + i) % len(addrs)
+
+		if _, err := s.Network.Connect(addrs[index], "", nil); err != nil {
+			log.Println("Couldn't connect to distributor", addrs[index], "-", err)
+			continue
+		}
+
+		log.Println("Connected to distributor", addrs[index])
+
+		// List the lobby we host with the new distributor right away
+		s.registerLobby()
+
+		return (index + 1) % len(addrs)
+	}
+
+	return start
+}
@@ -66,10 +66,20 @@ type Game[GS any, CS any] struct {
 var letters = []rune("ABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
 func NewGame(mgr *ViewManager, lobby *Lobby) {
+	if view := newGameView(mgr, lobby); view != nil {
+		mgr.SetView(view)
+	}
+}
+
+func newGameView(mgr *ViewManager, lobby *Lobby) View {
 	switch lobby.GameType {
 	case Tron:
-		mgr.SetView(NewTronGameView(mgr, lobby))
+		return NewTronGameView(mgr, lobby)
+	case Pong:
+		return NewPongGameView(mgr, lobby)
 	}
+
+	return nil
 }
 
 type ClientUpdateMessage[CS any] struct {
@@ -82,18 +92,20 @@ type GameUpdateMessage[GS any, CS any] struct {
 	message.Message
 	GameUpdate GS
 	// ClientStates map[string]CS
-	LastInps    map[string]int
-	ID          string
-	FragmentNum int
+	LastInps map[string]int
+	ID       string
 }
 
 type AckGameUpdateMessage struct {
 	message.Message
 }
 
+// StartGameMessage is sent by the host to everyone in the lobby to start the
+// game, with the players that confirmed they're in it.
 type StartGameMessage struct {
 	message.Message
-	GameID string
+	GameID    string
+	PlayerIDs []string
 }
 
 type EndGameMessage struct {
@@ -105,8 +117,8 @@ func NewEndGameMessage(winner string) *EndGameMessage {
 	return &EndGameMessage{message.Message{Type: "end_game"}, winner}
 }
 
-func NewStartGameMessage(GameID string) *StartGameMessage {
-	return &StartGameMessage{message.Message{Type: "start_game"}, GameID}
+func NewStartGameMessage(GameID string, playerIDs []string) *StartGameMessage {
+	return &StartGameMessage{message.Message{Type: "start_game"}, GameID, playerIDs}
 }
 
 func NewAckGameUpdateMessage() *AckGameUpdateMessage {
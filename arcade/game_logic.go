@@ -0,0 +1,97 @@
+package arcade
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// NoFriendsWinner is reported as the winner of a game with a single player.
+// It matches tron.NoFriendsWinner, so every game ends the same way.
+const NoFriendsWinner = "can't win without friends :^)"
+
+// GameLogic holds the rules of a game. Implementations should be pure: every
+// peer applies the same committed commands to the same initial state, so the
+// same inputs must always produce the same state.
+type GameLogic[GS any, CMD any] interface {
+	// InitialState returns the state of a new game between the given players.
+	InitialState(playerIDs []string, width, height int) GS
+
+	// ApplyCommand applies a player's command to the state without advancing
+	// time.
+	ApplyCommand(state GS, playerID string, cmd CMD) GS
+
+	// Step advances the state by a single timestep.
+	Step(state GS) GS
+
+	// IsOver returns true and the ID of the winner once the game is over.
+	IsOver(state GS) (bool, string)
+
+	// Input translates a key press into a command for the given player, or
+	// returns false if the key press should be ignored.
+	Input(state GS, playerID string, ev *tcell.EventKey) (CMD, bool)
+
+	// Render draws the state onto the screen from the perspective of me.
+	Render(s *Screen, state GS, me string, debug bool)
+}
+
+// LocalPredictor can be implemented by a GameLogic to move the local player
+// ahead of everyone else, hiding the round trip to the Raft leader.
+type LocalPredictor[GS any] interface {
+	PredictLocal(state GS, playerID string) GS
+}
+
+// gameProfiles returns the names and colors players have in a game, from
+// their profiles in the lobby if there is one. The host already made sure
+// colors are unique when the players joined, but players that somehow share a
+// color get the next free one.
+func gameProfiles(lobby *Lobby, playerIDs []string) map[string]PlayerProfile {
+	profiles := make(map[string]PlayerProfile)
+	uses := make(map[string]int)
+
+	for _, playerID := range playerIDs {
+		profile := PlayerProfile{Name: shortID(playerID)}
+		if lobby != nil {
+			profile = lobby.Profile(playerID)
+		}
+
+		if !isTronColor(profile.Color) || uses[profile.Color] > 0 {
+			profile.Color = leastUsedColor(uses)
+		}
+
+		uses[profile.Color]++
+		profiles[playerID] = profile
+	}
+
+	return profiles
+}
+
+type GameCommandType int64
+
+const (
+	GameMoveCmd GameCommandType = iota
+	GameEndCmd
+)
+
+// GameCommand is the entry every game stores in the Raft log. The game view
+// fills in the metadata, and Data holds the game-specific command.
+type GameCommand[CMD any] struct {
+	ID       string
+	Type     GameCommandType
+	Timestep int
+	PlayerID string
+	Winner   string
+	Data     CMD
+}
+
+func (gc GameCommand[CMD]) String() string {
+	id := gc.ID[:int(math.Min(3, float64(len(gc.ID))))]
+	playerID := gc.PlayerID[:int(math.Min(3, float64(len(gc.PlayerID))))]
+
+	if gc.Type == GameEndCmd {
+		return fmt.Sprintf("%s[%s, W:%s]", id, playerID, gc.Winner[:int(math.Min(3, float64(len(gc.Winner))))])
+	}
+
+	return fmt.Sprintf("%s[%d,%s, %v]", id, gc.Timestep, playerID, gc.Data)
+}
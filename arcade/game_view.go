@@ -0,0 +1,967 @@
+package arcade
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"arcade/arcade/net"
+	"arcade/raft"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/google/uuid"
+	"github.com/jinzhu/copier"
+)
+
+var returnToLobbyText = "Press [Enter] to return to lobby"
+
+var watchReplayText = "Press [R] to watch the replay"
+
+var showCommits = false
+
+// Number of committed log entries between snapshots of the committed state
+const snapshotInterval = 50
+
+// gameSnapshot is what's handed to Raft in place of the log entries it
+// covers: the committed state, and the timestep it was committed at.
+type gameSnapshot[GS any] struct {
+	State    GS
+	Timestep int
+}
+
+type GameRenderState int64
+
+const (
+	GameInitScreen GameRenderState = iota
+	GameScreen
+	GameWinScreen
+)
+
+// maxQueuedInputs is how many key presses are buffered while waiting for the
+// next timestep, so that quick double turns aren't dropped.
+const maxQueuedInputs = 2
+
+// BASIC QUEUE IMPLEMENTATION
+
+type BasicQueue[T any] []T
+
+func (bq *BasicQueue[T]) push(element ...T) {
+	*bq = append(*bq, element...)
+}
+
+func (bq *BasicQueue[T]) pop() (T, bool) {
+	if len(*bq) == 0 {
+		var nullT T
+		return nullT, false
+	}
+	element := (*bq)[0] // The first element is the one to be dedequeued.
+	*bq = (*bq)[1:]
+	return element, true
+}
+
+/*
+1. Initialize game state
+2. On every TIMESTEP:
+  a0. increment TIMESTEP
+	a. Calculate self state and send command, add to moveQ
+	b. Sleep
+	c. Ingest state from raft log:
+		1. replay uncomitted logs ontop of stored game state
+			a. iterate, keep track of current latest_timestep
+			b. any timesteps < latest_timestep will be replayed on top of latest_timestep, w.r.t. relative timing
+			c. if final latest_timestep > TIMESTEP, set TIMESTEP = latest_timestep (not counting "replayed" timesteps)
+		2. client predict up until current timestep
+		3. client predict self based on moveQ, replaying on top of latest_timestep
+3. When applyMsg is received, directly modify the base game state
+
+*/
+
+// GameView runs any GameLogic on top of a Raft log. It owns the timestep
+// loop, applies committed commands, and predicts the working state from
+// uncommitted commands and the local move queue.
+type GameView[GS any, CMD any] struct {
+	View
+	mgr *ViewManager
+	Game[GS, CMD]
+
+	logic GameLogic[GS, CMD]
+	lobby *Lobby
+
+	// Spectators follow the Raft log as learners, and never send commands
+	spectating bool
+
+	// Players keep their Raft state in a file, so they can rejoin if they crash
+	persister *raft.Persister
+	statePath string
+
+	mu   sync.RWMutex
+	cond *sync.Cond
+
+	CommitedGameState GS
+	CommitedTimestep  int
+	WorkingGameState  GS
+
+	Ended  bool
+	Winner string
+
+	// Set once the view is left, so spectators stop asking to follow the game
+	unloaded bool
+
+	MoveQueue  []GameCommand[CMD]
+	inputQueue []CMD
+
+	ApplyChan       chan raft.ApplyMsg
+	lastApplyMsgInd int
+
+	initialGameState  GS
+	initialTimestep   int
+	committedCommands []GameCommand[CMD]
+	replay            *Replay[GS, CMD]
+	replayPath        string
+
+	renderState  GameRenderState
+	countdownNum int
+}
+
+func NewGameView[GS any, CMD any](mgr *ViewManager, lobby *Lobby, logic GameLogic[GS, CMD], timestepPeriod int) *GameView[GS, CMD] {
+	gv := &GameView[GS, CMD]{
+		mgr: mgr,
+		Game: Game[GS, CMD]{
+			// ID is the lobby ID, not the player
+			ID:             lobby.ID,
+			PlayerIDs:      lobby.PlayerIDs,
+			Name:           lobby.Name,
+			Me:             arcade.Server.ID,
+			HostID:         lobby.HostID,
+			TimestepPeriod: timestepPeriod,
+			Timestep:       0,
+		},
+		logic:        logic,
+		lobby:        lobby,
+		countdownNum: 3,
+	}
+
+	gv.spectating = true
+	for _, playerID := range gv.PlayerIDs {
+		if playerID == gv.Me {
+			gv.spectating = false
+		}
+	}
+
+	gv.cond = sync.NewCond(&gv.mu)
+	return gv
+}
+
+func (gv *GameView[GS, CMD]) Init() {
+	gv.mu.Lock()
+	// JANK
+	var me int
+	for i := range gv.PlayerIDs {
+		if gv.PlayerIDs[i] == gv.Me {
+			me = i
+		}
+	}
+	gv.ApplyChan = make(chan raft.ApplyMsg)
+
+	clients := []*net.Client{}
+	for _, playerId := range gv.PlayerIDs {
+		if playerId == gv.Me {
+			clients = append(clients, &net.Client{})
+		} else if client, ok := arcade.Server.Network.GetClient(playerId); ok {
+			clients = append(clients, client)
+		} else {
+			// not connected yet, Raft looks the client up again by ID
+			clients = append(clients, &net.Client{ID: playerId})
+		}
+	}
+
+	// joining a running game skips the countdown, since the clock is
+	// already ticking
+	inProgress := gv.spectating && gv.lobby.InGame
+
+	if gv.spectating {
+		gv.RaftServer = raft.MakeLearner(clients, gv.ApplyChan, arcade.Server.Network, gv.TimestepPeriod, gv.cond)
+		gv.requestLearner()
+	} else {
+		persister, rejoined := gv.openPersister()
+		inProgress = inProgress || rejoined
+
+		gv.RaftServer = raft.Make(clients, me, persister, gv.ApplyChan, arcade.Server.Network, gv.TimestepPeriod, gv.cond)
+	}
+
+	if gv.Me == gv.HostID {
+		gv.lobby.mu.Lock()
+		gv.lobby.InGame = true
+		gv.lobby.mu.Unlock()
+
+		// still listed, so others can find the game to watch
+		arcade.Server.PublishLobby(gv.lobby)
+	}
+
+	width, height := gv.mgr.screen.displaySize()
+
+	gv.CommitedGameState = gv.logic.InitialState(gv.PlayerIDs, width, height)
+	gv.WorkingGameState = gv.copyState(gv.CommitedGameState)
+	gv.initialGameState = gv.copyState(gv.CommitedGameState)
+	gv.CommitedTimestep = -1
+	gv.mu.Unlock()
+
+	gv.startApplyChanHandler()
+
+	go func() {
+		for i := 3; i > 0 && !inProgress; i-- {
+			gv.mu.Lock()
+			gv.countdownNum = i
+			gv.mu.Unlock()
+
+			gv.mgr.RequestRender()
+			time.Sleep(time.Second)
+		}
+
+		gv.mu.Lock()
+		gv.RaftServer.StartTime()
+
+		gv.renderState = GameScreen
+		lastTimestep := -1
+		for !gv.Ended {
+			gv.cond.Wait()
+
+			timestep := gv.RaftServer.GetTimestep()
+			if timestep == lastTimestep {
+				panic(fmt.Sprintf("SAME TIMESTEP, %d", timestep))
+			} else {
+				lastTimestep = timestep
+			}
+
+			// update gamestate and render for previous timestep
+			gv.updateWorkingGameState(timestep - 1)
+
+			gv.mgr.RequestRender()
+
+			// DEBUG MODE
+			gv.mgr.RLock()
+			if gv.mgr.showDebug {
+				w, _ := gv.mgr.screen.displaySize()
+				style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+				_, isLeader := gv.RaftServer.GetState()
+				gv.mgr.screen.DrawText(w+1, 0, style, fmt.Sprintf("L:%t, T:%d", isLeader, timestep))
+			}
+			gv.mgr.RUnlock()
+
+			if !gv.spectating {
+				// send command for current timestep
+				gv.updateSelf()
+
+				if predictor, ok := gv.logic.(LocalPredictor[GS]); ok {
+					gv.WorkingGameState = predictor.PredictLocal(gv.WorkingGameState, gv.Me)
+				}
+			}
+
+			gv.mgr.RequestRender()
+		}
+
+		gv.renderState = GameWinScreen
+		gv.mu.Unlock()
+
+		gv.mgr.RequestRender()
+	}()
+}
+
+func (gv *GameView[GS, CMD]) ProcessEvent(ev interface{}) {
+	switch ev := ev.(type) {
+	case *ClientConnectedEvent:
+		// a player restarted and rejoined, so keep track of them again
+		for _, playerID := range gv.PlayerIDs {
+			if playerID == ev.ClientID && (gv.Me == gv.HostID || playerID == gv.HostID) {
+				arcade.Server.BeginHeartbeats(playerID)
+			}
+		}
+	case *ClientDisconnectedEvent:
+		gv.removeSpectator(ev.ClientID)
+	case *HeartbeatEvent:
+		// the host lets spectators in during the game, and every player needs
+		// to know them before adding them as learners
+		if gv.Me == gv.HostID {
+			break
+		}
+
+		lobby := new(Lobby)
+		if err := json.Unmarshal(ev.Metadata, lobby); err != nil || lobby.ID != gv.lobby.ID || lobby.HostID != gv.HostID {
+			break
+		}
+
+		gv.lobby.mu.Lock()
+		gv.lobby.SpectatorIDs = lobby.SpectatorIDs
+		gv.lobby.Profiles = lobby.Profiles
+		gv.lobby.mu.Unlock()
+	case *tcell.EventKey:
+		// the chat overlay takes typing, but leaves arrows to the game
+		if arcade.Server.Chat.ProcessKey(gv.lobby, ev) {
+			gv.mgr.RequestRender()
+			return
+		}
+
+		switch ev.Key() {
+		case tcell.KeyEnter:
+			gv.mu.RLock()
+			ended := gv.Ended
+			gv.mu.RUnlock()
+
+			if ended {
+				if gv.Me == gv.HostID {
+					gv.lobby.mu.Lock()
+					gv.lobby.InGame = false
+					gv.lobby.mu.Unlock()
+				}
+
+				gv.mgr.SetView(NewLobbyView(gv.mgr, gv.lobby))
+			}
+		case tcell.KeyCtrlG:
+			showCommits = !showCommits
+		case tcell.KeyRune:
+			gv.mu.RLock()
+			ended := gv.Ended
+			replay := gv.replay
+			gv.mu.RUnlock()
+
+			if ended {
+				if ev.Rune() == 'r' && replay != nil {
+					gv.mgr.SetView(NewReplayView(gv.mgr, gv.lobby, gv.logic, replay))
+				}
+				return
+			}
+
+			gv.processInput(ev)
+		default:
+			gv.processInput(ev)
+		}
+	}
+}
+
+// processInput queues the command for a key press, to be sent at the start of
+// the next timestep. Inputs are validated against the working state with the
+// already queued inputs applied on top.
+func (gv *GameView[GS, CMD]) processInput(ev *tcell.EventKey) {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+
+	if gv.Ended || gv.spectating {
+		return
+	}
+
+	state := gv.copyState(gv.WorkingGameState)
+	for _, queued := range gv.inputQueue {
+		state = gv.logic.ApplyCommand(state, gv.Me, queued)
+	}
+
+	cmd, ok := gv.logic.Input(state, gv.Me, ev)
+
+	if !ok {
+		return
+	}
+
+	if len(gv.inputQueue) < maxQueuedInputs {
+		gv.inputQueue = append(gv.inputQueue, cmd)
+	} else {
+		gv.inputQueue[len(gv.inputQueue)-1] = cmd
+	}
+}
+
+func (gv *GameView[GS, CMD]) ProcessMessage(from *net.Client, p interface{}) interface{} {
+	switch p := p.(type) {
+	case *HelloMessage:
+		if gv.Me == gv.HostID {
+			return NewLobbyInfoMessage(gv.lobby)
+		}
+
+		return nil
+	case *JoinMessage:
+		if gv.Me != gv.HostID || gv.lobby.ID != p.LobbyID {
+			return nil
+		}
+
+		gv.lobby.mu.RLock()
+		code := gv.lobby.Code
+		gv.lobby.mu.RUnlock()
+
+		if !p.Spectator {
+			return NewJoinReplyMessage(&Lobby{}, ErrInGame)
+		} else if code != p.Code {
+			return NewJoinReplyMessage(&Lobby{}, ErrWrongCode)
+		}
+
+		gv.lobby.AddSpectator(p.PlayerID)
+		profile := p.Profile
+		profile.PlayerID = from.PlayerID()
+		gv.lobby.SetProfile(p.PlayerID, profile)
+		arcade.Server.SetUsernames(gv.lobby)
+		arcade.Server.BeginHeartbeats(p.PlayerID)
+
+		return NewJoinReplyMessage(gv.lobby, OK)
+	case *CountdownMessage:
+		// the host is starting the next game before we left the win screen,
+		// and we're still here for it
+		gv.mu.RLock()
+		ended := gv.Ended
+		gv.mu.RUnlock()
+
+		if ended && !p.Cancel && p.LobbyID == gv.lobby.ID && p.SenderID == gv.lobby.HostID {
+			return NewCountdownAckMessage(p.LobbyID)
+		}
+
+		return nil
+	case *StartGameMessage:
+		// the host started the next game before we left the win screen
+		gv.mu.RLock()
+		ended := gv.Ended
+		gv.mu.RUnlock()
+
+		if ended && p.GameID == gv.lobby.ID && p.SenderID == gv.lobby.HostID {
+			gv.lobby.SetPlayers(p.PlayerIDs)
+			NewGame(gv.mgr, gv.lobby)
+		}
+
+		return nil
+	case *RematchMessage:
+		// players can vote for a rematch before the host is back in the lobby
+		if gv.Me == gv.HostID && gv.lobby.ID == p.LobbyID {
+			gv.lobby.SetRematchVote(from.ID, p.Vote)
+		}
+
+		return nil
+	case *ChatMessage:
+		if arcade.Server.Chat.Receive(gv.lobby, p) {
+			gv.mgr.RequestRender()
+		}
+
+		return nil
+	case *LeaveMessage:
+		if gv.lobby.ID == p.LobbyID {
+			gv.removeSpectator(p.PlayerID)
+		}
+
+		return nil
+	case *StopSpectatingMessage:
+		if gv.lobby.ID == p.LobbyID {
+			gv.RaftServer.RemoveLearner(p.PlayerID)
+		}
+
+		return nil
+	case *SpectateMessage:
+		if !canSpectate(gv.lobby, from.ID, p) {
+			return nil
+		}
+
+		if client, ok := arcade.Server.Network.GetClient(p.PlayerID); ok {
+			gv.RaftServer.AddLearner(client)
+			return NewSpectateReplyMessage()
+		}
+
+		return nil
+	}
+
+	return gv.RaftServer.ProcessMessage(from, p)
+}
+
+// removeSpectator stops sending the log to a spectator that left, and the
+// host takes them off the lobby too.
+func (gv *GameView[GS, CMD]) removeSpectator(spectatorID string) {
+	gv.RaftServer.RemoveLearner(spectatorID)
+
+	if gv.Me == gv.HostID {
+		gv.lobby.RemoveSpectator(spectatorID)
+	}
+}
+
+// openPersister returns a persister backed by a file for this match. If the
+// player crashed during this match, the file still holds their Raft state and
+// rejoined is true.
+func (gv *GameView[GS, CMD]) openPersister() (persister *raft.Persister, rejoined bool) {
+	statePath, err := raftStatePath(gv.lobby, gv.Me)
+
+	if err != nil {
+		log.Println("Failed to persist Raft state:", err)
+		return raft.MakePersister(), false
+	}
+
+	if info, err := LoadRejoinInfo(); err == nil && info.ServerID == gv.Me && info.StatePath == statePath {
+		rejoined = true
+	} else {
+		os.Remove(statePath)
+	}
+
+	persister, err = raft.MakeFilePersister(statePath)
+
+	if err != nil {
+		log.Println("Failed to persist Raft state:", err)
+		return raft.MakePersister(), false
+	}
+
+	gv.persister = persister
+	gv.statePath = statePath
+
+	info := &RejoinInfo{
+		ServerID:  gv.Me,
+		IDSalt:    arcade.Server.IDSalt,
+		Lobby:     gv.lobby,
+		StatePath: statePath,
+	}
+
+	if err := info.Save(); err != nil {
+		log.Println("Failed to save rejoin info:", err)
+	}
+
+	return persister, rejoined && persister.RaftStateSize() > 0
+}
+
+// requestLearner asks every player to add us to their Raft peers as a
+// learner, retrying until each of them has replied.
+func (gv *GameView[GS, CMD]) requestLearner() {
+	for _, playerID := range gv.PlayerIDs {
+		go func(playerID string) {
+			for {
+				gv.mu.RLock()
+				stopped := gv.Ended || gv.unloaded
+				gv.mu.RUnlock()
+
+				if stopped {
+					return
+				}
+
+				if client, ok := arcade.Server.Network.GetClient(playerID); ok {
+					ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+					_, err := net.Call[*SpectateMessage, *SpectateReplyMessage](ctx, arcade.Server.Network, client, NewSpectateMessage(gv.Me, gv.ID))
+					cancel()
+
+					if err == nil {
+						return
+					}
+				}
+
+				time.Sleep(500 * time.Millisecond)
+			}
+		}(playerID)
+	}
+}
+
+func (gv *GameView[GS, CMD]) Render(s *Screen) {
+	s.ClearContent()
+
+	displayWidth, displayHeight := gv.mgr.screen.displaySize()
+	boxStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorTeal)
+	s.DrawBox(1, 1, displayWidth-2, displayHeight-2, boxStyle, false)
+
+	gv.mgr.RLock()
+	showDebug := gv.mgr.showDebug
+	gv.mgr.RUnlock()
+
+	gv.logic.Render(s, gv.WorkingGameState, gv.Me, showDebug)
+
+	if gv.spectating {
+		s.DrawText(3, 1, boxStyle, " SPECTATING ")
+	}
+
+	switch gv.renderState {
+	case GameInitScreen:
+		// draw countdown
+		s.DrawBlockText(CenterX, CenterY, boxStyle, strconv.Itoa(gv.countdownNum), true)
+	case GameWinScreen:
+		if gv.Winner == gv.Me && !gv.spectating {
+			s.DrawBlockText(CenterX, CenterY, boxStyle, "YOU WON", true)
+		} else {
+			s.DrawBlockText(CenterX, CenterY, boxStyle, "GAME OVER", true)
+
+			if containsID(gv.PlayerIDs, gv.Winner) {
+				winnerText := gv.lobby.Profile(gv.Winner).Name + " won"
+				s.DrawText((displayWidth-utf8.RuneCountInString(winnerText))/2, displayHeight-8, boxStyle, winnerText)
+			}
+		}
+
+		s.DrawText((displayWidth-utf8.RuneCountInString(returnToLobbyText))/2, displayHeight-6, boxStyle, returnToLobbyText)
+
+		if gv.replay != nil {
+			s.DrawText((displayWidth-utf8.RuneCountInString(watchReplayText))/2, displayHeight-5, boxStyle, watchReplayText)
+
+			savedText := "Replay saved to " + gv.replayPath
+			s.DrawText((displayWidth-utf8.RuneCountInString(savedText))/2, displayHeight-4, boxStyle, savedText)
+		}
+	}
+
+	// Chat overlay in the bottom left corner, shown while typing
+	if arcade.Server.Chat.Typing() {
+		chatStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGreen)
+		arcade.Server.Chat.Render(s, gv.lobby.ID, 2, displayHeight-10, displayWidth/2, displayHeight-3, chatStyle, chatStyle.Bold(true))
+	}
+}
+
+// JANK: This applies entries in order without processing out of order timesteps. This could cause jumps in game state
+// i.e. entries {timestep}: [A{32}, B{24}, C{28}]. This would be processed as [A{32}, B{33}, C{37}], but cmd C could be
+// commited before timestep 37
+// ^ maybe not applicable anymore
+func (gv *GameView[GS, CMD]) startApplyChanHandler() {
+	go func() {
+		for {
+			applyMsg := <-gv.ApplyChan
+
+			gv.mu.Lock()
+			gv.lastApplyMsgInd = applyMsg.CommandIndex - 1 // raft indexes are 1 indexed
+			style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+
+			if applyMsg.CommandValid {
+				if applyMsg.CommandTimestep < gv.CommitedTimestep {
+					panic(fmt.Sprintf("encountered older timestep than commitedTimestep, %d, %d", applyMsg.CommandTimestep, gv.CommitedTimestep))
+				} else if cmd, ok := readLogEntryAsGameCmd[CMD](applyMsg.Command); ok {
+					log.Println("Applying: ", cmd, applyMsg.CommandTimestep)
+
+					cmd.Timestep = applyMsg.CommandTimestep
+					gv.CommitedGameState = applyCommittedCommand(gv.logic, gv.CommitedGameState, gv.CommitedTimestep, cmd)
+					gv.CommitedTimestep = applyMsg.CommandTimestep
+
+					switch cmd.Type {
+					case GameMoveCmd:
+						gv.committedCommands = append(gv.committedCommands, cmd)
+					case GameEndCmd:
+						if !gv.Ended {
+							gv.committedCommands = append(gv.committedCommands, cmd)
+							gv.saveReplay(cmd.Winner)
+
+							if gv.Me == gv.HostID {
+								gv.lobby.AddResult(cmd.Winner)
+							}
+
+							if !gv.spectating {
+								ClearRejoinInfo()
+							}
+						}
+
+						gv.Ended = true
+						gv.Winner = cmd.Winner
+					}
+
+					gv.truncateMoveQueueIfNecessary(cmd)
+				}
+
+				if applyMsg.CommandIndex%snapshotInterval == 0 {
+					gv.snapshot(applyMsg.CommandIndex)
+				}
+			} else if applyMsg.SnapshotValid {
+				gv.installSnapshot(applyMsg)
+			}
+
+			gv.mgr.RLock()
+			if gv.mgr.showDebug {
+				w, _ := gv.mgr.screen.displaySize()
+				gv.mgr.screen.DrawText(w+1, 1, style, fmt.Sprintf("A:%d C: %d", gv.lastApplyMsgInd, gv.CommitedTimestep))
+			}
+			gv.mgr.RUnlock()
+			gv.mu.Unlock()
+		}
+	}()
+}
+
+// updateSelf sends the next queued input as a command for the current
+// timestep, and optimistically applies it to the working state.
+func (gv *GameView[GS, CMD]) updateSelf() {
+	if len(gv.inputQueue) == 0 {
+		return
+	}
+
+	data := gv.inputQueue[0]
+	gv.inputQueue = gv.inputQueue[1:]
+
+	currentTimestep := gv.RaftServer.GetTimestep()
+	cmd := GameCommand[CMD]{
+		ID:       uuid.NewString(),
+		Type:     GameMoveCmd,
+		Timestep: currentTimestep,
+		PlayerID: gv.Me,
+		Data:     data,
+	}
+
+	gv.RaftServer.Start(cmd, currentTimestep)
+	gv.MoveQueue = append(gv.MoveQueue, cmd)
+
+	gv.mgr.RLock()
+	if gv.mgr.showDebug {
+		w, h := gv.mgr.screen.displaySize()
+		moveStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorBlue)
+		gv.mgr.screen.DrawText(w+1, h-1, moveStyle, cmd.String())
+	}
+	gv.mgr.RUnlock()
+
+	// optimistically apply move
+	gv.WorkingGameState = gv.logic.ApplyCommand(gv.WorkingGameState, gv.Me, data)
+}
+
+func (gv *GameView[GS, CMD]) updateWorkingGameState(currentTimestep int) {
+	raftLog, lastApplied, _ := gv.RaftServer.GetLog()
+
+	// only the uncommitted entries, everything else is in the committed state
+	// or a snapshot already
+	entries := raftLog.GetEntryAndFollowing(lastApplied + 1)
+
+	var commands BasicQueue[GameCommand[CMD]]
+	for _, entry := range entries {
+		if cmd, ok := readLogEntryAsGameCmd[CMD](entry.Command); ok {
+			cmd.Timestep = entry.Timestep
+			commands.push(cmd)
+
+			gv.truncateMoveQueueIfNecessary(cmd)
+		}
+	}
+
+	workingGameState := gv.copyState(gv.CommitedGameState)
+
+	// JANK: mixing in move queue in to processed logs instead of replaying on top, could cause jumps
+	if len(gv.MoveQueue) > 0 {
+		if len(commands) > 0 && commands[len(commands)-1].Timestep > gv.MoveQueue[0].Timestep {
+			diff := commands[len(commands)-1].Timestep - gv.MoveQueue[0].Timestep
+			log.Println("[RAFT]", "diff", diff)
+			for _, move := range gv.MoveQueue {
+				move.Timestep += diff
+				commands.push(move)
+			}
+		} else {
+			commands.push(gv.MoveQueue...)
+		}
+	}
+
+	// DEBUG MODE
+	gv.mgr.RLock()
+	if gv.mgr.showDebug {
+		w, _ := gv.mgr.screen.displaySize()
+		vOffset := 3
+		var maxLogs float64 = 15
+
+		firstIndex := int(math.Max(float64(raftLog.GetLastIncludedIndex()+1), float64(lastApplied)-maxLogs+1))
+		commitedEntries := raftLog.GetEntryAndFollowing(firstIndex)
+		commitedEntries = commitedEntries[:int(math.Max(0, math.Min(float64(len(commitedEntries)), float64(lastApplied-firstIndex+1))))]
+
+		gv.mgr.screen.DrawEmpty(w+1, vOffset, w+22, vOffset+len(commitedEntries)+len(entries)+3, tcell.StyleDefault.Background(tcell.ColorBlack))
+
+		commitedStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorGreen)
+		lastI := 0
+		for i, entry := range commitedEntries {
+			if cmd, ok := readLogEntryAsGameCmd[CMD](entry.Command); ok {
+				cmd.Timestep = entry.Timestep
+				gv.mgr.screen.DrawText(w+1, vOffset+i, commitedStyle, cmd.String())
+			}
+			lastI = i
+		}
+		gv.mgr.screen.DrawText(w+1, vOffset+lastI+1, commitedStyle, fmt.Sprintf("appliedInd: %d", lastApplied))
+		uncommitedStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+		for i, cmd := range commands {
+			gv.mgr.screen.DrawText(w+1, vOffset+lastI+3+i, uncommitedStyle, cmd.String())
+		}
+	}
+	gv.mgr.RUnlock()
+
+	workingTimestep := gv.CommitedTimestep + 1
+
+	// replay cmds on top of gamestate
+	for len(commands) > 0 || workingTimestep <= currentTimestep {
+		if len(commands) > 0 && commands[0].Timestep <= workingTimestep {
+			if cmd, ok := commands.pop(); ok && cmd.Timestep == workingTimestep && cmd.Type == GameMoveCmd {
+				workingGameState = gv.logic.ApplyCommand(workingGameState, cmd.PlayerID, cmd.Data)
+			}
+		} else {
+			workingGameState = gv.step(workingGameState, 1)
+			workingTimestep += 1
+		}
+	}
+
+	if over, winner := gv.logic.IsOver(workingGameState); over && !gv.spectating {
+		winCmd := GameCommand[CMD]{
+			ID:       uuid.NewString(),
+			Type:     GameEndCmd,
+			Timestep: currentTimestep,
+			PlayerID: gv.Me,
+			Winner:   winner,
+		}
+		gv.RaftServer.Start(winCmd, currentTimestep)
+	}
+
+	gv.WorkingGameState = workingGameState
+}
+
+// step advances the state by numTimesteps, stopping once the game is over.
+func (gv *GameView[GS, CMD]) step(state GS, numTimesteps int) GS {
+	return stepGame(gv.logic, state, numTimesteps)
+}
+
+// saveReplay writes the initial state and every committed command to a replay
+// file, so the match can be watched again after the process exits.
+func (gv *GameView[GS, CMD]) saveReplay(winner string) {
+	replay := &Replay[GS, CMD]{
+		GameType:       gv.lobby.GameType,
+		GameID:         gv.ID,
+		Name:           gv.Name,
+		PlayerIDs:      gv.PlayerIDs,
+		Me:             gv.Me,
+		Winner:         winner,
+		TimestepPeriod: gv.TimestepPeriod,
+		StartTimestep:  gv.initialTimestep,
+		InitialState:   gv.initialGameState,
+		Commands:       gv.committedCommands,
+	}
+
+	if path, err := replay.Save(); err != nil {
+		log.Println("Failed to save replay:", err)
+	} else {
+		gv.replay = replay
+		gv.replayPath = path
+	}
+}
+
+// snapshot hands the committed state to Raft so it can drop the log entries up
+// to and including index. Lock must already be held.
+func (gv *GameView[GS, CMD]) snapshot(index int) {
+	data, err := json.Marshal(gameSnapshot[GS]{
+		State:    gv.CommitedGameState,
+		Timestep: gv.CommitedTimestep,
+	})
+
+	if err != nil {
+		log.Println("Failed to snapshot game state:", err)
+		return
+	}
+
+	gv.RaftServer.Snapshot(index, data)
+}
+
+// installSnapshot replaces the committed state with a snapshot from Raft, sent
+// when this peer was too far behind to catch up from the log. Lock must
+// already be held.
+func (gv *GameView[GS, CMD]) installSnapshot(applyMsg raft.ApplyMsg) {
+	var snapshot gameSnapshot[GS]
+
+	if err := json.Unmarshal(applyMsg.Snapshot, &snapshot); err != nil {
+		log.Println("Failed to read game state snapshot:", err)
+		return
+	}
+
+	if snapshot.Timestep < gv.CommitedTimestep {
+		return
+	}
+
+	log.Println("Installing snapshot: ", applyMsg.SnapshotIndex, snapshot.Timestep)
+
+	gv.CommitedGameState = snapshot.State
+	gv.CommitedTimestep = snapshot.Timestep
+	gv.lastApplyMsgInd = applyMsg.SnapshotIndex - 1
+
+	// the replay can only start from here
+	gv.initialGameState = gv.copyState(snapshot.State)
+	gv.initialTimestep = snapshot.Timestep + 1
+	gv.committedCommands = nil
+}
+
+// blindly truncates move queue if id matches. Could potentially cut out earlier cmds in the moveQueue
+func (gv *GameView[GS, CMD]) truncateMoveQueueIfNecessary(cmd GameCommand[CMD]) {
+	for i, move := range gv.MoveQueue {
+		if move.ID == cmd.ID {
+			gv.MoveQueue = gv.MoveQueue[i+1:]
+			return
+		}
+	}
+}
+
+func (gv *GameView[GS, CMD]) copyState(state GS) GS {
+	return copyGameState(state)
+}
+
+func (gv *GameView[GS, CMD]) GetHeartbeatMetadata() encoding.BinaryMarshaler {
+	if gv.Me != gv.HostID {
+		return nil
+	}
+
+	return gv.lobby
+}
+
+func (gv *GameView[GS, CMD]) Unload() {
+	gv.RaftServer.Kill()
+
+	gv.mu.Lock()
+	gv.unloaded = true
+	gv.mu.Unlock()
+
+	if gv.spectating {
+		// players stop sending us the log
+		for _, playerID := range gv.PlayerIDs {
+			if client, ok := arcade.Server.Network.GetClient(playerID); ok {
+				arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewStopSpectatingMessage(gv.Me, gv.lobby.ID))
+			}
+		}
+	}
+
+	if gv.persister == nil {
+		return
+	}
+
+	if err := gv.persister.Close(); err != nil {
+		log.Println("Failed to persist Raft state:", err)
+	}
+
+	gv.mu.RLock()
+	ended := gv.Ended
+	gv.mu.RUnlock()
+
+	// Raft keeps saving after the game ends, so the state is cleared again
+	// once it has stopped
+	if ended {
+		os.Remove(gv.statePath)
+	}
+}
+
+// stepGame advances the state by numTimesteps, stopping once the game is over.
+func stepGame[GS any, CMD any](logic GameLogic[GS, CMD], state GS, numTimesteps int) GS {
+	for i := 0; i < numTimesteps; i++ {
+		if over, _ := logic.IsOver(state); over {
+			break
+		}
+
+		state = logic.Step(state)
+	}
+
+	return state
+}
+
+// applyCommittedCommand steps the committed state forward to the command's
+// timestep and applies it. Every peer, and every replay, runs committed
+// commands through here so they all end up in the same state.
+func applyCommittedCommand[GS any, CMD any](logic GameLogic[GS, CMD], state GS, committedTimestep int, cmd GameCommand[CMD]) GS {
+	jumpAhead := int(math.Max(float64(cmd.Timestep-committedTimestep-1), 0))
+	state = stepGame(logic, state, jumpAhead)
+
+	if cmd.Type == GameMoveCmd {
+		state = logic.ApplyCommand(state, cmd.PlayerID, cmd.Data)
+		state = stepGame(logic, state, 1) // current timestep forward
+	}
+
+	return state
+}
+
+func copyGameState[GS any](state GS) GS {
+	var copied GS
+	copier.CopyWithOption(&copied, &state, copier.Option{DeepCopy: true})
+	return copied
+}
+
+func readLogEntryAsGameCmd[CMD any](entry interface{}) (GameCommand[CMD], bool) {
+	var cmd GameCommand[CMD]
+
+	if jsonStr, err := json.Marshal(entry); err == nil {
+		if err := json.Unmarshal(jsonStr, &cmd); err == nil {
+			return cmd, true
+		}
+	}
+	return cmd, false
+}
@@ -1,8 +1,10 @@
 package arcade
 
 import (
+	"arcade/arcade/distributor"
 	"arcade/arcade/multicast"
 	"arcade/arcade/net"
+	"context"
 	"encoding"
 	"fmt"
 	"sort"
@@ -22,6 +24,12 @@ type GamesListView struct {
 	selectedRow  int
 	stopTickerCh chan bool
 
+	// Filters and page of the distributor's directory being shown, how many
+	// lobbies match in total, and which of the lobbies shown came from it
+	query  distributor.LobbyQuery
+	total  int
+	listed map[string]bool
+
 	lastTimeRefreshed int
 
 	glv_join_box          string
@@ -29,12 +37,20 @@ type GamesListView struct {
 	err_msg               string
 	glv_code_input_string string
 	glv_code              string
+	glv_spectate          bool
 }
 
 var footer = []string{
-	"[C]reate new lobby      [J]oin selected lobby",
+	"[C]reate new lobby      [J]oin selected lobby      [W]atch selected lobby",
 }
 
+// Lobbies shown per page, as many as fit in the table
+const gamesListPageSize = 14
+
+// Filters the games list cycles through
+var gameTypeFilters = []string{"", Tron, Pong}
+var maxPingFilters = []int{0, 50, 100, 200}
+
 // const (
 // 	nameColX    = 4
 // 	gameColX    = 30
@@ -58,10 +74,15 @@ func NewGamesListView(mgr *ViewManager) *GamesListView {
 		stopTickerCh:      make(chan bool),
 		lobbies:           make(map[string]*Lobby),
 		lastTimeRefreshed: 3,
+		query:             distributor.LobbyQuery{PageSize: gamesListPageSize},
+		listed:            make(map[string]bool),
 	}
 }
 
 func (v *GamesListView) Init() {
+	// Nothing we host is open once we're back to looking for games
+	arcade.Server.UnpublishLobby()
+
 	ticker := time.NewTicker(time.Second)
 
 	go func() {
@@ -92,10 +113,14 @@ func (v *GamesListView) SendHelloMessages() {
 	// Scan LAN for lobbies
 	go multicast.Discover(arcade.Server.Addr, arcade.Server.ID, arcade.Port)
 
-	// Send hello messages to everyone we find
+	// Distributors list the lobbies of everyone connected to them
+	go v.QueryDirectory()
+
+	// Send hello messages to everyone we're directly connected to, e.g. on
+	// the LAN, since they may not be connected to a distributor
 	arcade.Server.Network.ClientsRange(func(client *net.Client) bool {
 		client.RLock()
-		if (client.State != net.Connected && client.State != net.Connecting) || client.Distributor {
+		if (client.State != net.Connected && client.State != net.Connecting) || client.Distributor || client.NextHop != "" {
 			client.RUnlock()
 			return true
 		}
@@ -106,23 +131,85 @@ func (v *GamesListView) SendHelloMessages() {
 	})
 }
 
+// QueryDirectory replaces the lobbies listed by the distributor with the
+// current page of its directory.
+func (v *GamesListView) QueryDirectory() {
+	v.mu.RLock()
+	query := v.query
+	v.mu.RUnlock()
+
+	lobbies, total, err := arcade.Server.QueryLobbies(query)
+
+	if err != nil {
+		return
+	}
+
+	v.mu.Lock()
+	for lobbyID := range v.listed {
+		delete(v.lobbies, lobbyID)
+	}
+
+	v.listed = make(map[string]bool)
+
+	for _, lobby := range lobbies {
+		v.lobbies[lobby.ID] = lobby
+		v.listed[lobby.ID] = true
+	}
+
+	v.total = total
+
+	if v.selectedRow > len(v.lobbies)-1 {
+		v.selectedRow = len(v.lobbies) - 1
+	}
+
+	if v.selectedRow < 0 {
+		v.selectedRow = 0
+	}
+	v.mu.Unlock()
+
+	v.mgr.RequestRender()
+}
+
+// setQuery changes which lobbies are shown, and looks for them again.
+func (v *GamesListView) setQuery(query distributor.LobbyQuery) {
+	v.mu.Lock()
+	v.query = query
+	v.lobbies = make(map[string]*Lobby)
+	v.listed = make(map[string]bool)
+	v.selectedRow = 0
+	v.mu.Unlock()
+
+	go v.SendHelloMessages()
+}
+
 // QueryClient sends a HelloMessage to the client and waits for a reply. If a
 // LobbyInfoMessage is received, the client immediately re-renders the view
 // with the new lobby included.
 func (v *GamesListView) QueryClient(client *net.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
 	start := time.Now()
-	res, err := arcade.Server.Network.SendAndReceive(client, NewHelloMessage())
+	p, err := net.Call[*HelloMessage, *LobbyInfoMessage](ctx, arcade.Server.Network, client, NewHelloMessage())
 	end := time.Now()
 
-	p, ok := res.(*LobbyInfoMessage)
-
-	if !ok || err != nil {
+	if err != nil {
 		return
 	}
 
-	v.mu.Lock()
 	p.Lobby.Ping = int(end.Sub(start).Milliseconds())
+
+	v.mu.Lock()
+
+	// Hide lobbies filtered out, like the distributor does. They only show up
+	// on the first page, along with the closest lobbies it lists.
+	if query := v.query; query.Page > 0 || !query.Matches(p.Lobby.Listing()) {
+		v.mu.Unlock()
+		return
+	}
+
 	v.lobbies[p.Lobby.ID] = p.Lobby
+	delete(v.listed, p.Lobby.ID)
 	v.mu.Unlock()
 
 	v.mgr.RequestRender()
@@ -174,7 +261,11 @@ func (v *GamesListView) ProcessEvent(evt interface{}) {
 					selectedLobby := v.lobbies[v.selectedLobbyKey]
 					host, _ := arcade.Server.Network.GetClient(selectedLobby.HostID)
 
-					go arcade.Server.Network.Send(host, NewJoinMessage(v.glv_code, arcade.Server.ID, selectedLobby.ID))
+					if v.glv_spectate {
+						go arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewSpectateJoinMessage(v.glv_code, arcade.Server.ID, selectedLobby.ID))
+					} else {
+						go arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewJoinMessage(v.glv_code, arcade.Server.ID, selectedLobby.ID))
+					}
 				} else {
 					v.glv_join_box = "join_code"
 					v.err_msg = "Code must be four characters long."
@@ -183,12 +274,41 @@ func (v *GamesListView) ProcessEvent(evt interface{}) {
 			}
 		case tcell.KeyRune:
 			if v.glv_join_box == "" {
+				v.mu.RLock()
+				query := v.query
+				total := v.total
+				v.mu.RUnlock()
+
 				switch evt.Rune() {
+				case 'g':
+					query.GameType = gameTypeFilters[(indexOf(gameTypeFilters, query.GameType)+1)%len(gameTypeFilters)]
+					query.Page = 0
+					v.setQuery(query)
+				case 'f':
+					query.MinFreeSlots = 1 - query.MinFreeSlots
+					query.Page = 0
+					v.setQuery(query)
+				case 'm':
+					query.MaxPing = maxPingFilters[(indexOf(maxPingFilters, query.MaxPing)+1)%len(maxPingFilters)]
+					query.Page = 0
+					v.setQuery(query)
+				case 'n':
+					if (query.Page+1)*query.PageSize < total {
+						query.Page++
+						v.setQuery(query)
+					}
+				case 'b':
+					if query.Page > 0 {
+						query.Page--
+						v.setQuery(query)
+					}
 				case 'c':
 					v.glv_join_box = ""
 					v.mgr.SetView(NewLobbyCreateView(v.mgr))
-				case 'j':
+				case 'j', 'w':
 					if len(v.lobbies) != 0 {
+						v.glv_spectate = evt.Rune() == 'w'
+
 						v.mu.RLock()
 
 						keys := make([]string, 0, len(v.lobbies))
@@ -205,7 +325,11 @@ func (v *GamesListView) ProcessEvent(evt interface{}) {
 						} else {
 							host, _ := arcade.Server.Network.GetClient(selectedLobby.HostID)
 
-							go arcade.Server.Network.Send(host, NewJoinMessage("", arcade.Server.ID, selectedLobby.ID))
+							if v.glv_spectate {
+								go arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewSpectateJoinMessage("", arcade.Server.ID, selectedLobby.ID))
+							} else {
+								go arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewJoinMessage("", arcade.Server.ID, selectedLobby.ID))
+							}
 						}
 						v.mu.RUnlock()
 
@@ -231,8 +355,14 @@ func (v *GamesListView) ProcessMessage(from *net.Client, p interface{}) interfac
 			v.glv_code_input_string = ""
 			v.mu.Unlock()
 
-			v.mgr.SetView(NewLobbyView(v.mgr, p.Lobby))
+			if p.Lobby.InGame {
+				// watching a game that's already running
+				NewGame(v.mgr, p.Lobby)
+			} else {
+				v.mgr.SetView(NewLobbyView(v.mgr, p.Lobby))
+			}
 
+			arcade.Server.SetUsernames(p.Lobby)
 			arcade.Server.BeginHeartbeats(p.Lobby.HostID)
 		} else if p.Error == ErrWrongCode {
 			v.mu.Lock()
@@ -242,6 +372,10 @@ func (v *GamesListView) ProcessMessage(from *net.Client, p interface{}) interfac
 			v.mu.Lock()
 			v.err_msg = "Game is now full."
 			v.mu.Unlock()
+		} else if p.Error == ErrInGame {
+			v.mu.Lock()
+			v.err_msg = "Game has already started, [W]atch it instead."
+			v.mu.Unlock()
 		}
 	case *LobbyEndMessage:
 		v.mu.Lock()
@@ -317,6 +451,14 @@ func (v *GamesListView) Render(s *Screen) {
 	// Draw footer with navigation keystrokes
 	s.DrawText((width-len(footer[0]))/2, height-2, sty, footer[0])
 
+	// Draw filters and pages below it
+	v.mu.RLock()
+	filters := v.filtersText()
+	v.mu.RUnlock()
+
+	s.DrawEmpty(0, height-1, width-1, height-1, sty)
+	s.DrawText((width-len(filters))/2, height-1, sty, filters)
+
 	v.mu.Lock()
 	countdownMsg := fmt.Sprintf("Refreshing in %d", 6-v.lastTimeRefreshed)
 
@@ -374,6 +516,9 @@ func (v *GamesListView) Render(s *Screen) {
 		name := lobby.Name
 		game := lobby.GameType
 		players := fmt.Sprintf("%d/%d", len(lobby.PlayerIDs), lobby.Capacity)
+		if lobby.InGame {
+			players += " in game, [W]atch"
+		}
 		ping := fmt.Sprintf("%dms", lobby.Ping)
 		lobby.mu.RUnlock()
 
@@ -418,3 +563,43 @@ func (v *GamesListView) Unload() {
 func (v *GamesListView) GetHeartbeatMetadata() encoding.BinaryMarshaler {
 	return nil
 }
+
+// filtersText describes the filters and page of the directory being shown.
+// The lock must already be held.
+func (v *GamesListView) filtersText() string {
+	game := "all"
+
+	if v.query.GameType != "" {
+		game = v.query.GameType
+	}
+
+	free := "off"
+
+	if v.query.MinFreeSlots > 0 {
+		free = "on"
+	}
+
+	ping := "any"
+
+	if v.query.MaxPing > 0 {
+		ping = fmt.Sprintf("%dms", v.query.MaxPing)
+	}
+
+	pages := (v.total + v.query.PageSize - 1) / v.query.PageSize
+
+	if pages < 1 {
+		pages = 1
+	}
+
+	return fmt.Sprintf("[G]ame: %s   [F]ree slots only: %s   [M]ax ping: %s   [B]ack %d/%d [N]ext", game, free, ping, v.query.Page+1, pages)
+}
+
+func indexOf[T comparable](values []T, value T) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+
+	return -1
+}
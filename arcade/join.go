@@ -7,9 +7,13 @@ import (
 
 type JoinMessage struct {
 	message.Message
-	PlayerID string
-	Code     string
-	LobbyID  string
+	PlayerID  string
+	Code      string
+	LobbyID   string
+	Spectator bool
+
+	// What the rest of the lobby sees of the player's profile
+	Profile PlayerProfile
 }
 
 func NewJoinMessage(code string, playerID string, lobbyID string) *JoinMessage {
@@ -18,9 +22,18 @@ func NewJoinMessage(code string, playerID string, lobbyID string) *JoinMessage {
 		PlayerID: playerID,
 		Code:     code,
 		LobbyID:  lobbyID,
+		Profile:  LocalProfile(),
 	}
 }
 
+// NewSpectateJoinMessage asks to watch a lobby, or a game in progress, without
+// taking one of the player slots.
+func NewSpectateJoinMessage(code string, playerID string, lobbyID string) *JoinMessage {
+	msg := NewJoinMessage(code, playerID, lobbyID)
+	msg.Spectator = true
+	return msg
+}
+
 func (m JoinMessage) MarshalBinary() ([]byte, error) {
 	return json.Marshal(m)
 }
@@ -9,6 +9,7 @@ const (
 	OK           = "OK"
 	ErrCapacity  = "ErrCapacity"
 	ErrWrongCode = "ErrWrongCode"
+	ErrInGame    = "ErrInGame"
 )
 
 type JoinErr string
@@ -11,6 +11,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// PlayerProfile is what the rest of a lobby sees of a member's profile.
+type PlayerProfile struct {
+	Name  string
+	Color string
+
+	// Persistent ID of the player, which unlike their session ID stays the
+	// same when they restart. Set by the host from the player's key.
+	PlayerID string
+}
+
 type Lobby struct {
 	mu sync.RWMutex
 
@@ -21,7 +31,15 @@ type Lobby struct {
 	GameType         string
 	Capacity         int
 	PlayerIDs        []string
+	SpectatorIDs     []string
 	HostID           string
+	Profiles         map[string]PlayerProfile
+	InGame           bool
+	GamesPlayed      int
+	Scores           map[string]int
+	RematchIDs       []string
+	ReadyIDs         []string
+	AutoStart        bool
 	Ping             int
 	PlayerClientEnds labrpc.ClientEnd
 }
@@ -35,6 +53,8 @@ func NewLobby(name string, private bool, gameType string, capacity int, hostID s
 		Capacity:  capacity,
 		PlayerIDs: []string{hostID},
 		HostID:    hostID,
+		Profiles:  make(map[string]PlayerProfile),
+		Scores:    make(map[string]int),
 	}
 
 	if private {
@@ -55,12 +75,325 @@ func (l *Lobby) RemovePlayer(playerID string) {
 	for i, v := range l.PlayerIDs {
 		if v == playerID {
 			l.PlayerIDs = append(l.PlayerIDs[:i], l.PlayerIDs[i+1:]...)
+			l.ReadyIDs = removeID(l.ReadyIDs, playerID)
+			delete(l.Profiles, playerID)
+			break
+		}
+	}
+	l.mu.Unlock()
+}
+
+// SetPlayers replaces the players with the ones the host started a game with,
+// in case the heartbeat leaving out the others hasn't arrived yet.
+func (l *Lobby) SetPlayers(playerIDs []string) {
+	l.mu.Lock()
+	l.PlayerIDs = append([]string{}, playerIDs...)
+	l.mu.Unlock()
+}
+
+func (l *Lobby) AddSpectator(spectatorID string) {
+	l.mu.Lock()
+	l.SpectatorIDs = append(l.SpectatorIDs, spectatorID)
+	l.mu.Unlock()
+}
+
+func (l *Lobby) RemoveSpectator(spectatorID string) {
+	l.mu.Lock()
+	for i, v := range l.SpectatorIDs {
+		if v == spectatorID {
+			l.SpectatorIDs = append(l.SpectatorIDs[:i], l.SpectatorIDs[i+1:]...)
+			delete(l.Profiles, spectatorID)
 			break
 		}
 	}
 	l.mu.Unlock()
 }
 
+// SetProfile records the profile a member joined with, and returns it as the
+// rest of the lobby sees it. A player whose color is missing or already taken
+// by another player gets the first free color instead, or once every color is
+// taken, the one the fewest other players share.
+func (l *Lobby) SetProfile(playerID string, profile PlayerProfile) PlayerProfile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	uses := make(map[string]int)
+
+	for _, v := range l.PlayerIDs {
+		if v != playerID {
+			uses[l.Profiles[v].Color]++
+		}
+	}
+
+	if !isTronColor(profile.Color) || uses[profile.Color] > 0 {
+		profile.Color = leastUsedColor(uses)
+	}
+
+	if l.Profiles == nil {
+		l.Profiles = make(map[string]PlayerProfile)
+	}
+
+	l.Profiles[playerID] = profile
+	return profile
+}
+
+// ReplaceSession moves a returning player's place in the lobby, along with
+// their wins and rematch vote, over from the session they were in before to
+// sessionID. Returns the old session ID, or false if the player isn't in the
+// lobby under another session.
+func (l *Lobby) ReplaceSession(playerID string, sessionID string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if playerID == "" {
+		return "", false
+	}
+
+	oldID := ""
+
+	for id, profile := range l.Profiles {
+		if profile.PlayerID == playerID && id != sessionID {
+			oldID = id
+		}
+	}
+
+	if oldID == "" || oldID == l.HostID {
+		return "", false
+	}
+
+	for _, ids := range [][]string{l.PlayerIDs, l.SpectatorIDs, l.RematchIDs, l.ReadyIDs} {
+		for i, id := range ids {
+			if id == oldID {
+				ids[i] = sessionID
+			}
+		}
+	}
+
+	if wins, ok := l.Scores[oldID]; ok {
+		l.Scores[sessionID] = wins
+		delete(l.Scores, oldID)
+	}
+
+	l.Profiles[sessionID] = l.Profiles[oldID]
+	delete(l.Profiles, oldID)
+
+	return oldID, true
+}
+
+// Profile returns the profile of a member, with a short form of their ID
+// standing in for a missing name.
+func (l *Lobby) Profile(playerID string) PlayerProfile {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.profile(playerID)
+}
+
+// Lock must already be held
+func (l *Lobby) profile(playerID string) PlayerProfile {
+	profile := l.Profiles[playerID]
+
+	if profile.Name == "" {
+		profile.Name = shortID(playerID)
+	}
+
+	return profile
+}
+
+// AddResult records the end of a game, crediting the winner if it's one of
+// the players.
+func (l *Lobby) AddResult(winner string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.GamesPlayed++
+
+	if l.Scores == nil {
+		l.Scores = make(map[string]int)
+	}
+
+	for _, playerID := range l.PlayerIDs {
+		if playerID == winner {
+			l.Scores[winner]++
+		}
+	}
+}
+
+// SetRematchVote records whether the player wants to play again, and returns
+// true once every player has voted for a rematch.
+func (l *Lobby) SetRematchVote(playerID string, vote bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// spectators and peers outside the lobby don't get a vote
+	if !containsID(l.PlayerIDs, playerID) {
+		return false
+	}
+
+	for i, v := range l.RematchIDs {
+		if v == playerID {
+			l.RematchIDs = append(l.RematchIDs[:i], l.RematchIDs[i+1:]...)
+			break
+		}
+	}
+
+	if vote {
+		l.RematchIDs = append(l.RematchIDs, playerID)
+	}
+
+	return l.rematchAgreed()
+}
+
+// Lock must already be held
+func (l *Lobby) rematchAgreed() bool {
+	if l.GamesPlayed == 0 || len(l.PlayerIDs) < 2 {
+		return false
+	}
+
+	for _, playerID := range l.PlayerIDs {
+		voted := false
+
+		for _, v := range l.RematchIDs {
+			if v == playerID {
+				voted = true
+			}
+		}
+
+		if !voted {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetReady records whether the player is ready to start, and returns false if
+// they aren't a player in the lobby.
+func (l *Lobby) SetReady(playerID string, ready bool) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// spectators and peers outside the lobby don't hold up the game
+	if !containsID(l.PlayerIDs, playerID) {
+		return false
+	}
+
+	l.ReadyIDs = removeID(l.ReadyIDs, playerID)
+
+	if ready {
+		l.ReadyIDs = append(l.ReadyIDs, playerID)
+	}
+
+	return true
+}
+
+func (l *Lobby) IsReady(playerID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return containsID(l.ReadyIDs, playerID)
+}
+
+// NotReady returns the players other than the host that aren't ready yet. The
+// host is ready once they start the game.
+func (l *Lobby) NotReady() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	notReady := make([]string, 0)
+
+	for _, playerID := range l.PlayerIDs {
+		if playerID != l.HostID && !containsID(l.ReadyIDs, playerID) {
+			notReady = append(notReady, playerID)
+		}
+	}
+
+	return notReady
+}
+
+// ShouldAutoStart returns true if the host turned on auto-start, and there's
+// someone to play against with every player ready.
+func (l *Lobby) ShouldAutoStart() bool {
+	l.mu.RLock()
+	autoStart := l.AutoStart && len(l.PlayerIDs) > 1
+	l.mu.RUnlock()
+
+	return autoStart && len(l.NotReady()) == 0
+}
+
+func (l *Lobby) HasRematchVote(playerID string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, v := range l.RematchIDs {
+		if v == playerID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ElectHost takes the host out of the lobby, and hands the lobby over to the
+// player who joined first. Every member has the same roster from the host's
+// heartbeats, so they all pick the same new host without having to agree on
+// it. Returns the new host's ID, or false if no players are left.
+func (l *Lobby) ElectHost() (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.PlayerIDs = removeID(l.PlayerIDs, l.HostID)
+	l.SpectatorIDs = removeID(l.SpectatorIDs, l.HostID)
+	l.RematchIDs = removeID(l.RematchIDs, l.HostID)
+	l.ReadyIDs = removeID(l.ReadyIDs, l.HostID)
+	delete(l.Profiles, l.HostID)
+
+	if len(l.PlayerIDs) == 0 {
+		return "", false
+	}
+
+	l.HostID = l.PlayerIDs[0]
+	return l.HostID, true
+}
+
+// succeededBy returns true if next is a later state of the lobby, either from
+// the same host or from the player that took it over once the host left. A
+// host that lost its players keeps sending its own state, which is ignored.
+func (l *Lobby) succeededBy(next *Lobby) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if next.ID != l.ID {
+		return false
+	}
+
+	if next.HostID == l.HostID {
+		return true
+	}
+
+	return containsID(l.PlayerIDs, next.HostID) && !containsID(next.PlayerIDs, l.HostID)
+}
+
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func removeID(ids []string, id string) []string {
+	for i, v := range ids {
+		if v == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+
+	return ids
+}
+
 func generateCode() string {
 	var code string
 	rand.Seed(time.Now().UnixNano())
@@ -122,6 +122,7 @@ func (v *LobbyCreateView) ProcessEvent(evt interface{}) {
 					intVar, _ := strconv.Atoi(lcv_playerOpt[lcv_game_user_input_indices[2]][lcv_game_user_input_indices[3]])
 
 					lobby := NewLobby(lcv_game_name, (lcv_game_user_input_indices[1] == 1), lcv_gameOpt[lcv_game_user_input_indices[2]], intVar, arcade.Server.ID)
+					lobby.SetProfile(arcade.Server.ID, LocalProfile())
 					v.mgr.SetView(NewLobbyView(v.mgr, lobby))
 				}
 			}
@@ -0,0 +1,344 @@
+package arcade
+
+import "testing"
+
+// newTestLobby returns a lobby hosted by the first player, with the rest of
+// the players and the spectators already in it.
+func newTestLobby(playerIDs []string, spectatorIDs []string) *Lobby {
+	lobby := NewLobby("lobby", false, Tron, 8, playerIDs[0])
+
+	for _, playerID := range playerIDs[1:] {
+		lobby.AddPlayer(playerID)
+	}
+
+	for _, spectatorID := range spectatorIDs {
+		lobby.AddSpectator(spectatorID)
+	}
+
+	return lobby
+}
+
+func TestSetRematchVote(t *testing.T) {
+	type vote struct {
+		playerID string
+		vote     bool
+	}
+
+	tests := []struct {
+		name    string
+		votes   []vote
+		agreed  bool
+		voteIDs []string
+	}{
+		{"everyone votes", []vote{{"a", true}, {"b", true}}, true, []string{"a", "b"}},
+		{"one player votes", []vote{{"a", true}}, false, []string{"a"}},
+		{"vote withdrawn", []vote{{"a", true}, {"b", true}, {"b", false}}, false, []string{"a"}},
+		{"spectator can't vote", []vote{{"a", true}, {"s", true}}, false, []string{"a"}},
+		{"stranger can't vote", []vote{{"a", true}, {"x", true}}, false, []string{"a"}},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby([]string{"a", "b"}, []string{"s"})
+		lobby.AddResult("a")
+
+		agreed := false
+		for _, v := range test.votes {
+			agreed = lobby.SetRematchVote(v.playerID, v.vote)
+		}
+
+		if agreed != test.agreed {
+			t.Errorf("%s: expected agreed to be %v", test.name, test.agreed)
+		}
+
+		if len(lobby.RematchIDs) != len(test.voteIDs) {
+			t.Errorf("%s: expected votes from %v, got %v", test.name, test.voteIDs, lobby.RematchIDs)
+			continue
+		}
+
+		for _, playerID := range test.voteIDs {
+			if !containsID(lobby.RematchIDs, playerID) {
+				t.Errorf("%s: expected votes from %v, got %v", test.name, test.voteIDs, lobby.RematchIDs)
+			}
+		}
+	}
+}
+
+func TestSetReady(t *testing.T) {
+	type ready struct {
+		playerID string
+		ready    bool
+	}
+
+	tests := []struct {
+		name     string
+		ready    []ready
+		recorded []bool
+		readyIDs []string
+	}{
+		{"player gets ready", []ready{{"b", true}}, []bool{true}, []string{"b"}},
+		{"player gets ready twice", []ready{{"b", true}, {"b", true}}, []bool{true, true}, []string{"b"}},
+		{"player changes their mind", []ready{{"b", true}, {"b", false}}, []bool{true, true}, []string{}},
+		{"spectator can't get ready", []ready{{"s", true}}, []bool{false}, []string{}},
+		{"stranger can't get ready", []ready{{"x", true}}, []bool{false}, []string{}},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby([]string{"a", "b"}, []string{"s"})
+
+		for i, r := range test.ready {
+			if recorded := lobby.SetReady(r.playerID, r.ready); recorded != test.recorded[i] {
+				t.Errorf("%s: expected %s getting ready to be recorded: %v", test.name, r.playerID, test.recorded[i])
+			}
+		}
+
+		if len(lobby.ReadyIDs) != len(test.readyIDs) {
+			t.Errorf("%s: expected %v to be ready, got %v", test.name, test.readyIDs, lobby.ReadyIDs)
+			continue
+		}
+
+		for _, playerID := range test.readyIDs {
+			if !lobby.IsReady(playerID) {
+				t.Errorf("%s: expected %v to be ready, got %v", test.name, test.readyIDs, lobby.ReadyIDs)
+			}
+		}
+	}
+}
+
+func TestNotReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(lobby *Lobby)
+		notReady []string
+	}{
+		{"no one ready", func(lobby *Lobby) {}, []string{"b", "c"}},
+		{"one player ready", func(lobby *Lobby) { lobby.SetReady("b", true) }, []string{"c"}},
+		{"every player ready", func(lobby *Lobby) {
+			lobby.SetReady("b", true)
+			lobby.SetReady("c", true)
+		}, []string{}},
+		{"player no longer ready", func(lobby *Lobby) {
+			lobby.SetReady("b", true)
+			lobby.SetReady("b", false)
+		}, []string{"b", "c"}},
+		{"ready player leaves", func(lobby *Lobby) {
+			lobby.SetReady("b", true)
+			lobby.RemovePlayer("b")
+		}, []string{"c"}},
+		{"player that isn't ready leaves", func(lobby *Lobby) {
+			lobby.SetReady("b", true)
+			lobby.RemovePlayer("c")
+		}, []string{}},
+		{"ready player leaves and comes back", func(lobby *Lobby) {
+			lobby.SetReady("b", true)
+			lobby.RemovePlayer("b")
+			lobby.AddPlayer("b")
+		}, []string{"c", "b"}},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby([]string{"a", "b", "c"}, nil)
+		test.setup(lobby)
+
+		notReady := lobby.NotReady()
+
+		if len(notReady) != len(test.notReady) {
+			t.Errorf("%s: expected %v not to be ready, got %v", test.name, test.notReady, notReady)
+			continue
+		}
+
+		for i := range notReady {
+			if notReady[i] != test.notReady[i] {
+				t.Errorf("%s: expected %v not to be ready, got %v", test.name, test.notReady, notReady)
+				break
+			}
+		}
+
+		for _, playerID := range lobby.ReadyIDs {
+			if !containsID(lobby.PlayerIDs, playerID) {
+				t.Errorf("%s: expected %s to be forgotten once they left, got %v", test.name, playerID, lobby.ReadyIDs)
+			}
+		}
+	}
+}
+
+func TestShouldAutoStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		autoStart bool
+		playerIDs []string
+		readyIDs  []string
+		start     bool
+	}{
+		{"every player ready", true, []string{"a", "b", "c"}, []string{"b", "c"}, true},
+		{"auto-start off", false, []string{"a", "b", "c"}, []string{"b", "c"}, false},
+		{"player not ready", true, []string{"a", "b", "c"}, []string{"b"}, false},
+		{"host alone", true, []string{"a"}, []string{}, false},
+		{"spectator ready instead of a player", true, []string{"a", "b"}, []string{"s"}, false},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby(test.playerIDs, []string{"s"})
+		lobby.AutoStart = test.autoStart
+
+		for _, playerID := range test.readyIDs {
+			lobby.SetReady(playerID, true)
+		}
+
+		if start := lobby.ShouldAutoStart(); start != test.start {
+			t.Errorf("%s: expected %v, got %v", test.name, test.start, start)
+		}
+	}
+}
+
+func TestElectHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		playerIDs []string
+		hostID    string
+		elected   bool
+		remaining []string
+	}{
+		{"host leaves players behind", []string{"a", "b", "c"}, "b", true, []string{"b", "c"}},
+		{"host leaves one player behind", []string{"a", "b"}, "b", true, []string{"b"}},
+		{"last player leaves", []string{"a"}, "", false, []string{}},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby(test.playerIDs, []string{"s"})
+		lobby.SetReady("a", true)
+		lobby.AddResult("a")
+		lobby.SetRematchVote("a", true)
+
+		hostID, elected := lobby.ElectHost()
+
+		if elected != test.elected || hostID != test.hostID {
+			t.Errorf("%s: expected (%q, %v), got (%q, %v)", test.name, test.hostID, test.elected, hostID, elected)
+		}
+
+		if elected && lobby.HostID != test.hostID {
+			t.Errorf("%s: expected the lobby to be handed over to %s, got %s", test.name, test.hostID, lobby.HostID)
+		}
+
+		if len(lobby.PlayerIDs) != len(test.remaining) {
+			t.Errorf("%s: expected players %v, got %v", test.name, test.remaining, lobby.PlayerIDs)
+		}
+
+		if containsID(lobby.ReadyIDs, "a") || containsID(lobby.RematchIDs, "a") {
+			t.Errorf("%s: expected the old host to be forgotten, got %+v", test.name, lobby)
+		}
+	}
+}
+
+func TestSucceededBy(t *testing.T) {
+	tests := []struct {
+		name      string
+		lobbyID   string
+		hostID    string
+		playerIDs []string
+		succeeded bool
+	}{
+		{"same host", "", "a", []string{"a", "b", "c"}, true},
+		{"player that took over", "", "b", []string{"b", "c"}, true},
+		{"player that took over before the host left", "", "b", []string{"b", "a", "c"}, false},
+		{"stranger", "", "x", []string{"x"}, false},
+		{"another lobby", "other", "a", []string{"a", "b", "c"}, false},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby([]string{"a", "b", "c"}, nil)
+
+		next := newTestLobby(test.playerIDs, nil)
+		next.ID = lobby.ID
+		next.HostID = test.hostID
+
+		if test.lobbyID != "" {
+			next.ID = test.lobbyID
+		}
+
+		if succeeded := lobby.succeededBy(next); succeeded != test.succeeded {
+			t.Errorf("%s: expected %v, got %v", test.name, test.succeeded, succeeded)
+		}
+	}
+}
+
+func TestStaleHostIsIgnoredAfterElection(t *testing.T) {
+	lobby := newTestLobby([]string{"a", "b", "c"}, nil)
+
+	// The old host's heartbeats still name it as host, with its players
+	stale := newTestLobby([]string{"a", "b", "c"}, nil)
+	stale.ID = lobby.ID
+
+	if !lobby.succeededBy(stale) {
+		t.Fatal("expected the host's state to be taken before it left")
+	}
+
+	if hostID, ok := lobby.ElectHost(); !ok || hostID != "b" {
+		t.Fatalf("expected b to take over, got (%q, %v)", hostID, ok)
+	}
+
+	if lobby.succeededBy(stale) {
+		t.Fatal("expected the old host's state to be ignored once it was replaced")
+	}
+
+	next := newTestLobby([]string{"b", "c"}, nil)
+	next.ID = lobby.ID
+
+	if !lobby.succeededBy(next) {
+		t.Fatal("expected the new host's state to be taken")
+	}
+}
+
+func TestSetProfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		playerID string
+		color    string
+		expected string
+	}{
+		{"free color", "c", "green", "green"},
+		{"color taken by another player", "c", "red", "green"},
+		{"color that doesn't exist", "c", "chartreuse", "green"},
+		{"no color", "c", "", "green"},
+		{"member setting their own color again", "b", "red", "red"},
+		{"member taking another player's color", "b", "blue", "red"},
+		{"spectator's color isn't held against players", "c", "teal", "teal"},
+	}
+
+	for _, test := range tests {
+		lobby := newTestLobby([]string{"a", "b", "c"}, []string{"s"})
+		lobby.SetProfile("a", PlayerProfile{Color: "blue"})
+		lobby.SetProfile("b", PlayerProfile{Color: "red"})
+		lobby.SetProfile("s", PlayerProfile{Color: "teal"})
+
+		if profile := lobby.SetProfile(test.playerID, PlayerProfile{Color: test.color}); profile.Color != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, profile.Color)
+		}
+	}
+}
+
+func TestSetProfileWithEveryColorTaken(t *testing.T) {
+	playerIDs := []string{}
+	for i := 0; i <= len(TRON_COLORS)+1; i++ {
+		playerIDs = append(playerIDs, string(rune('a'+i)))
+	}
+
+	lobby := newTestLobby(playerIDs, nil)
+
+	for i, color := range TRON_COLORS {
+		lobby.SetProfile(playerIDs[i], PlayerProfile{Color: color})
+	}
+
+	// Every color has one player, so the first one is shared
+	if profile := lobby.SetProfile(playerIDs[8], PlayerProfile{Color: "red"}); profile.Color != TRON_COLORS[0] {
+		t.Fatalf("expected %s, got %s", TRON_COLORS[0], profile.Color)
+	}
+
+	// Now blue has two, so the next player shares the least used color
+	if profile := lobby.SetProfile(playerIDs[9], PlayerProfile{Color: "blue"}); profile.Color != TRON_COLORS[1] {
+		t.Fatalf("expected %s, got %s", TRON_COLORS[1], profile.Color)
+	}
+
+	if profile := lobby.SetProfile(playerIDs[9], PlayerProfile{Color: "chartreuse"}); !isTronColor(profile.Color) {
+		t.Fatalf("expected a color that doesn't exist to be replaced, got %s", profile.Color)
+	}
+}
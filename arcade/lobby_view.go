@@ -2,10 +2,14 @@ package arcade
 
 import (
 	"arcade/arcade/net"
+	"context"
 	"encoding"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
@@ -17,8 +21,25 @@ type LobbyView struct {
 
 	sync.RWMutex
 	Lobby *Lobby
+
+	// True once the game has started, so that unloading the view hands the
+	// lobby over to the game instead of ending it
+	startingGame bool
+
+	// True from when the host starts the game until it's started or called
+	// off, while the players confirm they're still there. Starts are
+	// numbered, so that one that was called off doesn't go ahead.
+	countingDown bool
+	countdownSeq int
+
+	// Shown to the host, e.g. when players were left out of a game
+	status string
 }
 
+// Players that don't acknowledge the start within this long are removed from
+// the lobby, so the game doesn't wait for them.
+const countdownAckTimeout = 2 * time.Second
+
 // const stickmen = []string{
 // 	o   \ o /  _ o         __|    \ /     |__        o _  \ o /   o
 // 	/|\    |     /\   ___\o   \o    |    o/    o/__   /\     |    /|\
@@ -30,13 +51,17 @@ type LobbyView struct {
 // var simple_man = []string {" o ","/|\\","/ \\"};
 
 var lobby_footer_host = []string{
-	"[S]tart game       [C]ancel",
+	"[S]tart game     [A]uto-start     [C]ancel",
+	"[S]tart game     [R]ematch     [A]uto-start     [C]ancel",
 }
 
 var lobby_footer_nonhost = []string{
-	"[C]ancel",
+	"[Y] Ready     [C]ancel",
+	"[Y] Ready     [R]ematch     [C]ancel",
 }
 
+var lobby_footer_spectator = "[C]ancel"
+
 func NewLobbyView(mgr *ViewManager, lobby *Lobby) *LobbyView {
 	return &LobbyView{
 		mgr:   mgr,
@@ -45,6 +70,9 @@ func NewLobbyView(mgr *ViewManager, lobby *Lobby) *LobbyView {
 }
 
 func (v *LobbyView) Init() {
+	if v.Lobby.HostID == arcade.Server.ID {
+		arcade.Server.PublishLobby(v.Lobby)
+	}
 }
 
 func (v *LobbyView) ProcessEvent(evt interface{}) {
@@ -52,18 +80,46 @@ func (v *LobbyView) ProcessEvent(evt interface{}) {
 	case *ClientDisconnectedEvent:
 		if v.Lobby.HostID == arcade.Server.ID {
 			v.Lobby.RemovePlayer(evt.ClientID)
+			v.Lobby.RemoveSpectator(evt.ClientID)
+		} else if v.Lobby.HostID == evt.ClientID {
+			v.cancelCountdown()
+			v.migrateHost()
 		}
 	case *HeartbeatEvent:
 		if v.Lobby.HostID != arcade.Server.ID {
+			// The host is still in a game, and sends the lobby only so its
+			// players learn about new spectators
 			lobby := new(Lobby)
-			json.Unmarshal(evt.Metadata, lobby)
-			// fmt.Println("lobby updated w heartbeat")
+			if err := json.Unmarshal(evt.Metadata, lobby); err != nil || lobby.InGame {
+				break
+			}
+
+			if !v.Lobby.succeededBy(lobby) {
+				break
+			}
+
+			hostID := v.Lobby.HostID
+
 			v.Lock()
 			v.Lobby = lobby
 			v.Unlock()
+
+			arcade.Server.SetUsernames(lobby)
+
+			// Another player took the lobby over before we noticed the
+			// host leave
+			if lobby.HostID != hostID {
+				v.followHost(hostID)
+			}
 		}
 		// do something with lobby
 	case *tcell.EventKey:
+		// keys go to the chat while typing
+		if arcade.Server.Chat.ProcessKey(v.Lobby, evt) {
+			v.mgr.RequestRender()
+			break
+		}
+
 		switch evt.Key() {
 		case tcell.KeyRune:
 			switch evt.Rune() {
@@ -74,49 +130,273 @@ func (v *LobbyView) ProcessEvent(evt interface{}) {
 					host, _ := arcade.Server.Network.GetClient(v.Lobby.HostID)
 					v.Lobby.mu.RUnlock()
 
-					arcade.Server.Network.Send(host, NewLeaveMessage(arcade.Server.ID, v.Lobby.ID))
+					arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewLeaveMessage(arcade.Server.ID, v.Lobby.ID))
 
 					arcade.Server.EndAllHeartbeats()
 					v.mgr.SetView(NewGamesListView(v.mgr))
 				} else {
-					// first extract lobbyID for messages
-					lobbyID := v.Lobby.ID
 					v.Lobby.mu.RUnlock()
 
+					// Unload hands the lobby over to the other players
 					arcade.Server.EndAllHeartbeats()
-					// send updates to everyone
+					v.mgr.SetView(NewGamesListView(v.mgr))
+				}
+			case 's':
+				if v.Lobby.HostID != arcade.Server.ID {
+					break
+				}
 
-					arcade.Server.Network.ClientsRange(func(client *net.Client) bool {
-						if client.Distributor {
-							return true
-						}
+				if notReady := len(v.Lobby.NotReady()); notReady > 0 {
+					v.setStatus(fmt.Sprintf("Waiting for %d player(s) to get ready", notReady))
+					break
+				}
 
-						arcade.Server.Network.Send(client, NewLobbyEndMessage(lobbyID))
+				v.beginCountdown()
+			case 'a':
+				if v.Lobby.HostID != arcade.Server.ID {
+					break
+				}
 
-						return true
-					})
+				v.Lobby.mu.Lock()
+				v.Lobby.AutoStart = !v.Lobby.AutoStart
+				v.Lobby.mu.Unlock()
 
-					v.mgr.SetView(NewGamesListView(v.mgr))
+				v.autoStart()
+				v.mgr.RequestRender()
+			case 'y':
+				v.Lobby.mu.RLock()
+				canReady := v.Lobby.HostID != arcade.Server.ID && !v.isSpectator()
+				v.Lobby.mu.RUnlock()
 
+				if !canReady {
+					break
 				}
-			case 's':
-				//start gamex
+
+				ready := !v.Lobby.IsReady(arcade.Server.ID)
+
+				if host, ok := arcade.Server.Network.GetClient(v.Lobby.HostID); ok {
+					// show it right away, the next heartbeat confirms it
+					v.Lobby.SetReady(arcade.Server.ID, ready)
+					arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewReadyMessage(v.Lobby.ID, ready))
+					v.mgr.RequestRender()
+				}
+			case 'r':
 				v.Lobby.mu.RLock()
+				canRematch := v.Lobby.GamesPlayed > 0 && !v.isSpectator()
+				v.Lobby.mu.RUnlock()
+
+				if !canRematch {
+					break
+				}
+
+				vote := !v.Lobby.HasRematchVote(arcade.Server.ID)
+
 				if v.Lobby.HostID == arcade.Server.ID {
-					for _, playerId := range v.Lobby.PlayerIDs {
-						client, ok := arcade.Server.Network.GetClient(playerId)
-						if ok {
-							arcade.Server.Network.Send(client, NewStartGameMessage(v.Lobby.ID))
-						}
+					if v.Lobby.SetRematchVote(arcade.Server.ID, vote) {
+						v.beginCountdown()
 					}
-					NewGame(v.mgr, v.Lobby)
+				} else if host, ok := arcade.Server.Network.GetClient(v.Lobby.HostID); ok {
+					// show our vote right away, the next heartbeat confirms it
+					v.Lobby.SetRematchVote(arcade.Server.ID, vote)
+					arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewRematchMessage(v.Lobby.ID, vote))
 				}
-				v.Lobby.mu.RUnlock()
 			}
 		}
 	}
 }
 
+// beginCountdown has every player confirm they're still there, leaving out
+// those that don't, and starts the game with the rest right away. The
+// countdown to the first move runs in the game, so everyone sees it together.
+func (v *LobbyView) beginCountdown() {
+	v.Lock()
+	if v.countingDown {
+		v.Unlock()
+		return
+	}
+
+	v.countingDown = true
+	v.countdownSeq++
+	seq := v.countdownSeq
+	v.status = ""
+	v.Unlock()
+
+	v.Lobby.mu.RLock()
+	lobbyID := v.Lobby.ID
+	playerIDs := append([]string{}, v.Lobby.PlayerIDs...)
+	v.Lobby.mu.RUnlock()
+
+	v.mgr.RequestRender()
+
+	go func() {
+		missing := v.confirmCountdown(lobbyID, playerIDs)
+
+		v.RLock()
+		canceled := v.countdownSeq != seq
+		v.RUnlock()
+
+		if canceled {
+			return
+		}
+
+		if len(missing) > 0 {
+			status := "Left out " + strings.Join(v.removeMissing(lobbyID, missing), ", ") + ": not responding"
+
+			v.Lobby.mu.RLock()
+			enoughPlayers := len(v.Lobby.PlayerIDs) > 1
+			v.Lobby.mu.RUnlock()
+
+			// there's no game without anyone to play against
+			if !enoughPlayers {
+				v.cancelCountdown()
+				status = "Not enough players to start. " + status
+			}
+
+			v.setStatus(status)
+
+			if !enoughPlayers {
+				return
+			}
+		}
+
+		v.startGame(seq)
+	}()
+}
+
+// confirmCountdown tells every other player the game is starting, and returns
+// the ones that didn't acknowledge it.
+func (v *LobbyView) confirmCountdown(lobbyID string, playerIDs []string) []string {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		missing = make([]string, 0)
+	)
+
+	for _, playerID := range playerIDs {
+		if playerID == arcade.Server.ID {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(playerID string) {
+			defer wg.Done()
+
+			if client, ok := arcade.Server.Network.GetClient(playerID); ok {
+				ctx, cancel := context.WithTimeout(context.Background(), countdownAckTimeout)
+				defer cancel()
+
+				if _, err := net.Call[*CountdownMessage, *CountdownAckMessage](ctx, arcade.Server.Network, client, NewCountdownMessage(lobbyID, false)); err == nil {
+					return
+				}
+			}
+
+			mu.Lock()
+			missing = append(missing, playerID)
+			mu.Unlock()
+		}(playerID)
+	}
+
+	wg.Wait()
+	return missing
+}
+
+// removeMissing takes players that didn't acknowledge the start out of the
+// lobby, and returns their names.
+func (v *LobbyView) removeMissing(lobbyID string, missing []string) []string {
+	names := make([]string, 0, len(missing))
+
+	for _, playerID := range missing {
+		names = append(names, v.Lobby.Profile(playerID).Name)
+
+		v.Lobby.RemovePlayer(playerID)
+		arcade.Server.EndHeartbeats(playerID)
+
+		if client, ok := arcade.Server.Network.GetClient(playerID); ok {
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewLobbyEndMessage(lobbyID))
+		}
+	}
+
+	arcade.Server.PublishLobby(v.Lobby)
+	return names
+}
+
+// cancelCountdown calls off the start of the game, if it's starting, and the
+// host tells the players it's off.
+func (v *LobbyView) cancelCountdown() {
+	v.Lock()
+	wasCountingDown := v.countingDown
+	v.countingDown = false
+	v.countdownSeq++
+	v.Unlock()
+
+	if !wasCountingDown || v.Lobby.HostID != arcade.Server.ID {
+		return
+	}
+
+	v.Lobby.mu.RLock()
+	lobbyID := v.Lobby.ID
+	playerIDs := append([]string{}, v.Lobby.PlayerIDs...)
+	v.Lobby.mu.RUnlock()
+
+	for _, playerID := range playerIDs {
+		if client, ok := arcade.Server.Network.GetClient(playerID); ok && playerID != arcade.Server.ID {
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewCountdownMessage(lobbyID, true))
+		}
+	}
+
+	v.mgr.RequestRender()
+}
+
+// autoStart begins the countdown if the host turned on auto-start and every
+// player is ready.
+func (v *LobbyView) autoStart() {
+	if v.Lobby.ShouldAutoStart() {
+		v.beginCountdown()
+	}
+}
+
+func (v *LobbyView) setStatus(status string) {
+	v.Lock()
+	v.status = status
+	v.Unlock()
+
+	v.mgr.RequestRender()
+}
+
+// startGame tells the players and spectators to start the game, and starts it
+// for the host, unless the start numbered seq was called off.
+func (v *LobbyView) startGame(seq int) {
+	v.Lock()
+	if v.countdownSeq != seq {
+		v.Unlock()
+		return
+	}
+
+	v.startingGame = true
+	v.Unlock()
+
+	v.Lobby.mu.Lock()
+	v.Lobby.RematchIDs = nil
+	v.Lobby.ReadyIDs = nil
+
+	lobbyID := v.Lobby.ID
+	playerIDs := append([]string{}, v.Lobby.PlayerIDs...)
+
+	// spectators start watching at the same time as the players
+	recipientIDs := append(append([]string{}, v.Lobby.PlayerIDs...), v.Lobby.SpectatorIDs...)
+	v.Lobby.mu.Unlock()
+
+	for _, playerId := range recipientIDs {
+		client, ok := arcade.Server.Network.GetClient(playerId)
+		if ok {
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewStartGameMessage(lobbyID, playerIDs))
+		}
+	}
+
+	NewGame(v.mgr, v.Lobby)
+}
+
 func (v *LobbyView) ProcessMessage(from *net.Client, p interface{}) interface{} {
 	switch p := p.(type) {
 	case *HelloMessage:
@@ -130,13 +410,48 @@ func (v *LobbyView) ProcessMessage(from *net.Client, p interface{}) interface{}
 				lobby_code := v.Lobby.Code
 				v.Lobby.mu.RUnlock()
 
+				// the player ID comes from the client's key, so it can't be
+				// claimed by anyone else
+				profile := p.Profile
+				profile.PlayerID = from.PlayerID()
+
+				if lobby_code == p.Code {
+					// a player back in a new session, e.g. after restarting,
+					// takes their old place
+					if oldID, ok := v.Lobby.ReplaceSession(profile.PlayerID, p.PlayerID); ok {
+						arcade.Server.EndHeartbeats(oldID)
+						v.Lobby.SetProfile(p.PlayerID, profile)
+						arcade.Server.SetUsernames(v.Lobby)
+						arcade.Server.BeginHeartbeats(p.PlayerID)
+						arcade.Server.PublishLobby(v.Lobby)
+						return NewJoinReplyMessage(v.Lobby, OK)
+					}
+				}
+
+				if p.Spectator {
+					// spectators don't take up a player slot
+					if lobby_code != p.Code {
+						return NewJoinReplyMessage(&Lobby{}, ErrWrongCode)
+					}
+
+					v.Lobby.AddSpectator(p.PlayerID)
+					v.Lobby.SetProfile(p.PlayerID, profile)
+					arcade.Server.SetUsernames(v.Lobby)
+					arcade.Server.BeginHeartbeats(p.PlayerID)
+					arcade.Server.PublishLobby(v.Lobby)
+					return NewJoinReplyMessage(v.Lobby, OK)
+				}
+
 				if playerIDlength == cap {
 					return NewJoinReplyMessage(&Lobby{}, ErrCapacity)
 				} else if lobby_code != p.Code {
 					return NewJoinReplyMessage(&Lobby{}, ErrWrongCode)
 				} else {
 					v.Lobby.AddPlayer(p.PlayerID)
+					v.Lobby.SetProfile(p.PlayerID, profile)
+					arcade.Server.SetUsernames(v.Lobby)
 					arcade.Server.BeginHeartbeats(p.PlayerID)
+					arcade.Server.PublishLobby(v.Lobby)
 					return NewJoinReplyMessage(v.Lobby, OK)
 				}
 			} else {
@@ -145,9 +460,52 @@ func (v *LobbyView) ProcessMessage(from *net.Client, p interface{}) interface{}
 			}
 		}
 
+	case *RematchMessage:
+		if v.Lobby.ID == p.LobbyID && v.Lobby.HostID == arcade.Server.ID {
+			if v.Lobby.SetRematchVote(from.ID, p.Vote) {
+				v.beginCountdown()
+			}
+		}
+	case *ReadyMessage:
+		if v.Lobby.ID == p.LobbyID && v.Lobby.HostID == arcade.Server.ID {
+			if !v.Lobby.SetReady(from.ID, p.Ready) {
+				return nil
+			}
+
+			if p.Ready {
+				v.autoStart()
+			} else {
+				v.cancelCountdown()
+			}
+
+			v.mgr.RequestRender()
+		}
+	case *CountdownMessage:
+		if v.Lobby.ID != p.LobbyID || v.Lobby.HostID != p.SenderID {
+			return nil
+		}
+
+		if p.Cancel {
+			v.cancelCountdown()
+			return nil
+		}
+
+		v.Lock()
+		v.countingDown = true
+		v.Unlock()
+
+		v.mgr.RequestRender()
+		return NewCountdownAckMessage(p.LobbyID)
 	case *LeaveMessage:
 		if v.Lobby.ID == p.LobbyID && v.Lobby.HostID == arcade.Server.ID {
 			v.Lobby.RemovePlayer(p.PlayerID)
+			v.Lobby.RemoveSpectator(p.PlayerID)
+			arcade.Server.PublishLobby(v.Lobby)
+			v.cancelCountdown()
+		} else if v.Lobby.ID == p.LobbyID && v.Lobby.HostID == p.PlayerID && p.SenderID == p.PlayerID {
+			// the host left, but handed the lobby over to us
+			v.migrateHost()
+			return nil
 		}
 
 		arcade.Server.EndHeartbeats(p.PlayerID)
@@ -160,8 +518,17 @@ func (v *LobbyView) ProcessMessage(from *net.Client, p interface{}) interface{}
 			arcade.Server.EndAllHeartbeats()
 			v.mgr.SetView(NewGamesListView(v.mgr))
 		}
+	case *ChatMessage:
+		if arcade.Server.Chat.Receive(v.Lobby, p) {
+			v.mgr.RequestRender()
+		}
 	case *StartGameMessage:
-		if p.GameID == v.Lobby.ID {
+		if p.GameID == v.Lobby.ID && p.SenderID == v.Lobby.HostID {
+			v.Lock()
+			v.startingGame = true
+			v.Unlock()
+
+			v.Lobby.SetPlayers(p.PlayerIDs)
 			NewGame(v.mgr, v.Lobby)
 		}
 
@@ -194,7 +561,7 @@ func (v *LobbyView) Render(s *Screen) {
 	sty_bold := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorDarkGreen)
 
 	// Draw GAME header
-	s.DrawBlockText(CenterX, 1, sty, "TRON", false)
+	s.DrawBlockText(CenterX, 1, sty, strings.ToUpper(v.Lobby.GameType), false)
 
 	// Draw box surrounding games list
 	s.DrawBox(lv_TableX1, lv_TableY1, lv_TableX2, lv_TableY2, sty, true)
@@ -222,44 +589,248 @@ func (v *LobbyView) Render(s *Screen) {
 	s.DrawText((width-len(capacityHeader+capacityString))/2, lv_TableY1+3, sty, capacityHeader)
 	s.DrawText((width-len(capacityHeader+capacityString))/2+utf8.RuneCountInString(capacityHeader), lv_TableY1+3, sty_bold, capacityString)
 
+	// spectators
+	spectatorsHeader := "Spectators: "
+	spectatorsString := fmt.Sprintf("%v", len(v.Lobby.SpectatorIDs))
+	s.DrawText((width-len(spectatorsHeader+spectatorsString))/2, lv_TableY1+4, sty, spectatorsHeader)
+	s.DrawText((width-len(spectatorsHeader+spectatorsString))/2+utf8.RuneCountInString(spectatorsHeader), lv_TableY1+4, sty_bold, spectatorsString)
+
+	// auto-start
+	autoStartHeader := "Auto-start: "
+	autoStartString := "off"
+	if v.Lobby.AutoStart {
+		autoStartString = "on"
+	}
+	s.DrawText((width-len(autoStartHeader+autoStartString))/2, lv_TableY1+5, sty, autoStartHeader)
+	s.DrawText((width-len(autoStartHeader+autoStartString))/2+utf8.RuneCountInString(autoStartHeader), lv_TableY1+5, sty_bold, autoStartString)
+
+	v.RLock()
+	countingDown, status := v.countingDown, v.status
+	v.RUnlock()
+
+	if status != "" {
+		status = truncateRunes(status, tableWidth-2)
+		s.DrawText((width-utf8.RuneCountInString(status))/2, lv_TableY1+7, sty_bold, status)
+	}
+
+	// Draw the roster with everyone's wins so far on the left, and the chat
+	// on the right
+	v.renderRoster(s, 2, lv_TableY2+1, sty, sty_bold)
+	arcade.Server.Chat.Render(s, v.Lobby.ID, width/2+1, lv_TableY2+1, width-2, height-3, sty, sty_bold)
+
 	// Draw footer with navigation keystrokes
+	if countingDown {
+		countdownString := "Starting..."
+		s.DrawText((width-len(countdownString))/2, lv_TableY1+6, sty_bold, countdownString)
+	}
+
 	if arcade.Server.ID == v.Lobby.HostID {
 		// I am host so I should see start game controls
-		hostLabelString := "You are the host."
-		s.DrawText((width-len(hostLabelString))/2, lv_TableY1+5, sty, hostLabelString)
-		s.DrawText((width-len(lobby_footer_host[0]))/2, height-2, sty, lobby_footer_host[0])
+		if !countingDown {
+			hostLabelString := "You are the host."
+			s.DrawText((width-len(hostLabelString))/2, lv_TableY1+6, sty, hostLabelString)
+		}
+
+		if v.Lobby.GamesPlayed > 0 {
+			s.DrawText((width-len(lobby_footer_host[1]))/2, height-2, sty, lobby_footer_host[1])
+		} else {
+			s.DrawText((width-len(lobby_footer_host[0]))/2, height-2, sty, lobby_footer_host[0])
+		}
+	} else if v.isSpectator() {
+		if !countingDown {
+			spectatorLabelString := "Spectating. Waiting for host..."
+			s.DrawText((width-len(spectatorLabelString))/2, lv_TableY1+6, sty, spectatorLabelString)
+		}
+
+		s.DrawText((width-len(lobby_footer_spectator))/2, height-2, sty, lobby_footer_spectator)
 	} else {
-		participantLabelString := "Waiting for host to start game..."
-		s.DrawText((width-len(participantLabelString))/2, lv_TableY1+5, sty, participantLabelString)
-		s.DrawText((width-len(lobby_footer_nonhost[0]))/2, height-2, sty, lobby_footer_nonhost[0])
+		if !countingDown {
+			participantLabelString := "Waiting for host to start game..."
+			if containsID(v.Lobby.ReadyIDs, arcade.Server.ID) {
+				participantLabelString = "Ready. Waiting for host to start game..."
+			}
+			s.DrawText((width-len(participantLabelString))/2, lv_TableY1+6, sty, participantLabelString)
+		}
+
+		if v.Lobby.GamesPlayed > 0 {
+			s.DrawText((width-len(lobby_footer_nonhost[1]))/2, height-2, sty, lobby_footer_nonhost[1])
+		} else {
+			s.DrawText((width-len(lobby_footer_nonhost[0]))/2, height-2, sty, lobby_footer_nonhost[0])
+		}
 	}
 
 }
 
+// renderRoster draws a row per player with their name in their color and
+// whether they're ready, and once they've played their wins and whether they
+// voted for a rematch. Lobby lock must already be held.
+func (v *LobbyView) renderRoster(s *Screen, x, y int, sty, sty_bold tcell.Style) {
+	const (
+		nameColWidth  = 20
+		readyColWidth = 7
+		winsColWidth  = 5
+	)
+
+	s.DrawText(x, y, sty, "PLAYER")
+	s.DrawText(x+nameColWidth, y, sty, "READY")
+
+	if v.Lobby.GamesPlayed > 0 {
+		s.DrawText(x+nameColWidth+readyColWidth, y, sty, "WINS")
+		s.DrawText(x+nameColWidth+readyColWidth+winsColWidth, y, sty, "REMATCH")
+	}
+
+	for i, playerID := range v.Lobby.PlayerIDs {
+		profile := v.Lobby.profile(playerID)
+		name := profile.Name
+		suffix := ""
+
+		if playerID == arcade.Server.ID {
+			suffix = " (you)"
+		} else if playerID == v.Lobby.HostID {
+			suffix = " (host)"
+		}
+
+		name = truncateRunes(name, nameColWidth-1-utf8.RuneCountInString(suffix)) + suffix
+
+		nameStyle := sty_bold
+		if color, ok := tcell.ColorNames[profile.Color]; ok {
+			nameStyle = nameStyle.Foreground(color)
+		}
+
+		s.DrawText(x, y+i+1, nameStyle, name)
+
+		// the host is ready once they start the game
+		if playerID != v.Lobby.HostID && containsID(v.Lobby.ReadyIDs, playerID) {
+			s.DrawText(x+nameColWidth, y+i+1, sty_bold, "yes")
+		}
+
+		if v.Lobby.GamesPlayed == 0 {
+			continue
+		}
+
+		rematch := ""
+		for _, rematchID := range v.Lobby.RematchIDs {
+			if rematchID == playerID {
+				rematch = "ready"
+			}
+		}
+
+		s.DrawText(x+nameColWidth+readyColWidth, y+i+1, sty_bold, strconv.Itoa(v.Lobby.Scores[playerID]))
+		s.DrawText(x+nameColWidth+readyColWidth+winsColWidth, y+i+1, sty_bold, rematch)
+	}
+}
+
+// isSpectator returns true if we joined the lobby to watch. Lobby lock must
+// already be held.
+func (v *LobbyView) isSpectator() bool {
+	for _, spectatorID := range v.Lobby.SpectatorIDs {
+		if spectatorID == arcade.Server.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (v *LobbyView) Unload() {
+	v.RLock()
+	startingGame := v.startingGame
+	v.RUnlock()
+
+	if startingGame {
+		return
+	}
+
+	v.cancelCountdown()
+
 	if v.Lobby.HostID == arcade.Server.ID {
-		// send to all the players, similar to 'c'
-		lobbyID := v.Lobby.ID
+		// hand the lobby over to the other players
+		v.leaveAsHost()
+	} else {
+		// only send to host
+		host, ok := arcade.Server.Network.GetClient(v.Lobby.HostID)
+
+		if ok {
+			arcade.Server.Network.SendOn(host, net.ReliableOrdered, NewLeaveMessage(arcade.Server.ID, v.Lobby.ID))
+		}
+	}
+}
 
+// leaveAsHost tells the other players we're leaving, so that they elect a new
+// host and keep the lobby going. The lobby only ends if there's nobody left
+// to take it over.
+func (v *LobbyView) leaveAsHost() {
+	v.Lobby.mu.RLock()
+	lobbyID := v.Lobby.ID
+	memberIDs := append(append([]string{}, v.Lobby.PlayerIDs...), v.Lobby.SpectatorIDs...)
+	handOver := len(v.Lobby.PlayerIDs) > 1
+	v.Lobby.mu.RUnlock()
+
+	if !handOver {
+		// send updates to everyone
 		arcade.Server.Network.ClientsRange(func(client *net.Client) bool {
 			if client.Distributor {
 				return true
 			}
 
-			arcade.Server.Network.Send(client, NewLobbyEndMessage(lobbyID))
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewLobbyEndMessage(lobbyID))
 
 			return true
 		})
-	} else {
-		// only send to host
-		host, ok := arcade.Server.Network.GetClient(v.Lobby.HostID)
 
-		if ok {
-			arcade.Server.Network.Send(host, NewLeaveMessage(arcade.Server.ID, v.Lobby.ID))
+		return
+	}
+
+	for _, memberID := range memberIDs {
+		if client, ok := arcade.Server.Network.GetClient(memberID); ok && memberID != arcade.Server.ID {
+			arcade.Server.Network.SendOn(client, net.ReliableOrdered, NewLeaveMessage(arcade.Server.ID, lobbyID))
 		}
 	}
 }
 
+// migrateHost elects a new host once the host has left, keeping the lobby's ID,
+// code and roster. If we're elected we start heartbeats with everyone else and
+// list the lobby with the distributors, otherwise we follow the new host.
+func (v *LobbyView) migrateHost() {
+	oldHostID := v.Lobby.HostID
+	hostID, ok := v.Lobby.ElectHost()
+
+	if !ok {
+		// only spectators were left
+		arcade.Server.EndAllHeartbeats()
+		v.mgr.SetView(NewGamesListView(v.mgr))
+		return
+	}
+
+	if hostID != arcade.Server.ID {
+		v.followHost(oldHostID)
+		return
+	}
+
+	arcade.Server.EndHeartbeats(oldHostID)
+
+	v.Lobby.mu.RLock()
+	memberIDs := append(append([]string{}, v.Lobby.PlayerIDs...), v.Lobby.SpectatorIDs...)
+	v.Lobby.mu.RUnlock()
+
+	for _, memberID := range memberIDs {
+		if memberID != arcade.Server.ID {
+			arcade.Server.BeginHeartbeats(memberID)
+		}
+	}
+
+	arcade.Server.PublishLobby(v.Lobby)
+	v.mgr.RequestRender()
+}
+
+// followHost moves our heartbeats from the old host over to the lobby's new
+// one.
+func (v *LobbyView) followHost(oldHostID string) {
+	arcade.Server.EndHeartbeats(oldHostID)
+	arcade.Server.BeginHeartbeats(v.Lobby.HostID)
+	v.mgr.RequestRender()
+}
+
 func (v *LobbyView) GetHeartbeatMetadata() encoding.BinaryMarshaler {
 	v.RLock()
 	defer v.RUnlock()
@@ -0,0 +1,565 @@
+package message
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// The binary codec walks messages with reflection, like encoding/json does,
+// but both sides already know the type of every field, so only the values are
+// sent. Fields of type interface{} can hold anything, so their values are
+// prefixed with one of these kinds. Structs and maps in an interface{} come out
+// as map[string]interface{}, the same as they would from JSON.
+const (
+	kindNil = iota
+	kindFalse
+	kindTrue
+	kindInt
+	kindFloat
+	kindString
+	kindBytes
+	kindList
+	kindMap
+)
+
+var binaryMarshalerType = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+func (e *encoder) varint(x int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, b[:binary.PutVarint(b[:], x)]...)
+}
+
+func (e *encoder) float32(f float32) {
+	var b [4]byte
+	byteOrder.PutUint32(b[:], math.Float32bits(f))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) float64(f float64) {
+	var b [8]byte
+	byteOrder.PutUint64(b[:], math.Float64bits(f))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// fields encodes the exported fields of a struct, skipping the message header.
+func (e *encoder) fields(v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); !isEncodedField(f) {
+			continue
+		}
+
+		if err := e.value(v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), t.Field(i).Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if usesBinaryMarshaler(v.Type()) {
+		data, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+
+		if err != nil {
+			return err
+		}
+
+		e.string(string(data))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 1)
+		} else {
+			e.buf = append(e.buf, 0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.varint(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uvarint(v.Uint())
+	case reflect.Float32:
+		e.float32(float32(v.Float()))
+	case reflect.Float64:
+		e.float64(v.Float())
+	case reflect.String:
+		e.string(v.String())
+	case reflect.Slice:
+		// 0 is a nil slice, so that it stays nil on the other side
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+
+		e.uvarint(uint64(v.Len()) + 1)
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.uvarint(0)
+			return nil
+		}
+
+		e.uvarint(uint64(v.Len()) + 1)
+		iter := v.MapRange()
+
+		for iter.Next() {
+			if err := e.value(iter.Key()); err != nil {
+				return err
+			}
+
+			if err := e.value(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.fields(v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0)
+			return nil
+		}
+
+		e.buf = append(e.buf, 1)
+		return e.value(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return errors.New("only interface{} fields can be encoded")
+		}
+
+		return e.dynamic(v.Elem())
+	default:
+		return fmt.Errorf("can't encode %s", v.Type())
+	}
+
+	return nil
+}
+
+// dynamic encodes a value along with its kind, for interface{} fields.
+func (e *encoder) dynamic(v reflect.Value) error {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		e.buf = append(e.buf, kindNil)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, kindTrue)
+		} else {
+			e.buf = append(e.buf, kindFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.buf = append(e.buf, kindInt)
+		e.varint(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			e.buf = append(e.buf, kindFloat)
+			e.float64(float64(v.Uint()))
+		} else {
+			e.buf = append(e.buf, kindInt)
+			e.varint(int64(v.Uint()))
+		}
+	case reflect.Float32, reflect.Float64:
+		// whole numbers are usually ints that went through JSON at some point
+		if f := v.Float(); f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			e.buf = append(e.buf, kindInt)
+			e.varint(int64(f))
+		} else {
+			e.buf = append(e.buf, kindFloat)
+			e.float64(f)
+		}
+	case reflect.String:
+		// json.Number is a string too, so keep numbers as numbers
+		if v.Type().Name() == "Number" && v.Type().PkgPath() == "encoding/json" {
+			return e.dynamicNumber(v.String())
+		}
+
+		e.buf = append(e.buf, kindString)
+		e.string(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			e.buf = append(e.buf, kindBytes)
+			e.string(string(v.Bytes()))
+			return nil
+		}
+
+		e.buf = append(e.buf, kindList)
+		e.uvarint(uint64(v.Len()))
+
+		for i := 0; i < v.Len(); i++ {
+			if err := e.dynamic(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		e.buf = append(e.buf, kindMap)
+		e.uvarint(uint64(v.Len()))
+
+		// keys are sorted, so the same value always encodes the same way
+		keys := make([]string, 0, v.Len())
+		values := make(map[string]reflect.Value, v.Len())
+		iter := v.MapRange()
+
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			keys = append(keys, key)
+			values[key] = iter.Value()
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			e.string(key)
+
+			if err := e.dynamic(values[key]); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		names := []string{}
+		fields := []reflect.Value{}
+
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); isEncodedField(f) {
+				names = append(names, f.Name)
+				fields = append(fields, v.Field(i))
+			}
+		}
+
+		e.buf = append(e.buf, kindMap)
+		e.uvarint(uint64(len(names)))
+
+		for i, name := range names {
+			e.string(name)
+
+			if err := e.dynamic(fields[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can't encode %s", v.Type())
+	}
+
+	return nil
+}
+
+func (e *encoder) dynamicNumber(n string) error {
+	if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+		e.buf = append(e.buf, kindInt)
+		e.varint(i)
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(n, 64)
+
+	if err != nil {
+		return err
+	}
+
+	e.buf = append(e.buf, kindFloat)
+	e.float64(f)
+	return nil
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+
+	d.buf = nil
+}
+
+func (d *decoder) byte() byte {
+	if len(d.buf) < 1 {
+		d.fail(errors.New("message too short"))
+		return 0
+	}
+
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if n < 0 || len(d.buf) < n {
+		d.fail(errors.New("message too short"))
+		return make([]byte, n)
+	}
+
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	x, n := binary.Uvarint(d.buf)
+
+	if n <= 0 {
+		d.fail(errors.New("invalid varint"))
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *decoder) varint() int64 {
+	x, n := binary.Varint(d.buf)
+
+	if n <= 0 {
+		d.fail(errors.New("invalid varint"))
+		return 0
+	}
+
+	d.buf = d.buf[n:]
+	return x
+}
+
+// length reads a length, which can't be more than what's left of the message.
+func (d *decoder) length() int {
+	n := d.uvarint()
+
+	if n > uint64(len(d.buf)) {
+		d.fail(errors.New("invalid length"))
+		return 0
+	}
+
+	return int(n)
+}
+
+// nilableLength reads the length of a slice or map, which is stored plus one
+// so that 0 can mean nil.
+func (d *decoder) nilableLength() (int, bool) {
+	n := d.uvarint()
+
+	if n == 0 {
+		return 0, true
+	} else if n-1 > uint64(len(d.buf)) {
+		d.fail(errors.New("invalid length"))
+		return 0, true
+	}
+
+	return int(n - 1), false
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+func (d *decoder) fields(v reflect.Value) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField() && d.err == nil; i++ {
+		if f := t.Field(i); !isEncodedField(f) {
+			continue
+		}
+
+		if err := d.value(v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), t.Field(i).Name, err)
+		}
+	}
+
+	return d.err
+}
+
+func (d *decoder) value(v reflect.Value) error {
+	if usesBinaryMarshaler(v.Type()) {
+		data := []byte(d.string())
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(d.byte() != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(d.varint())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(d.uvarint())
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(byteOrder.Uint32(d.bytes(4)))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(byteOrder.Uint64(d.bytes(8))))
+	case reflect.String:
+		v.SetString(d.string())
+	case reflect.Slice:
+		n, isNil := d.nilableLength()
+
+		if isNil {
+			v.Set(reflect.Zero(v.Type()))
+			return d.err
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte{}, d.bytes(n)...))
+			return d.err
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+
+		for i := 0; i < n && d.err == nil; i++ {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len() && d.err == nil; i++ {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, isNil := d.nilableLength()
+
+		if isNil {
+			v.Set(reflect.Zero(v.Type()))
+			return d.err
+		}
+
+		v.Set(reflect.MakeMapWithSize(v.Type(), n))
+
+		for i := 0; i < n && d.err == nil; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			value := reflect.New(v.Type().Elem()).Elem()
+
+			if err := d.value(key); err != nil {
+				return err
+			}
+
+			if err := d.value(value); err != nil {
+				return err
+			}
+
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		return d.fields(v)
+	case reflect.Pointer:
+		if d.byte() == 0 {
+			v.Set(reflect.Zero(v.Type()))
+			return d.err
+		}
+
+		v.Set(reflect.New(v.Type().Elem()))
+		return d.value(v.Elem())
+	case reflect.Interface:
+		if value := d.dynamic(); value != nil {
+			v.Set(reflect.ValueOf(value))
+		}
+	default:
+		return fmt.Errorf("can't decode %s", v.Type())
+	}
+
+	return d.err
+}
+
+func (d *decoder) dynamic() interface{} {
+	switch d.byte() {
+	case kindNil:
+		return nil
+	case kindFalse:
+		return false
+	case kindTrue:
+		return true
+	case kindInt:
+		return d.varint()
+	case kindFloat:
+		return math.Float64frombits(byteOrder.Uint64(d.bytes(8)))
+	case kindString:
+		return d.string()
+	case kindBytes:
+		return []byte(d.string())
+	case kindList:
+		n := d.length()
+		list := make([]interface{}, n)
+
+		for i := 0; i < n && d.err == nil; i++ {
+			list[i] = d.dynamic()
+		}
+
+		return list
+	case kindMap:
+		n := d.length()
+		m := make(map[string]interface{}, n)
+
+		for i := 0; i < n && d.err == nil; i++ {
+			key := d.string()
+			m[key] = d.dynamic()
+		}
+
+		return m
+	}
+
+	d.fail(errors.New("invalid value kind"))
+	return nil
+}
+
+// isEncodedField returns true for the fields JSON would encode, minus the
+// message header.
+func isEncodedField(f reflect.StructField) bool {
+	return f.IsExported() && f.Type != messageType && f.Tag.Get("json") != "-"
+}
+
+// usesBinaryMarshaler returns true for types that encode themselves, like
+// time.Time. Message types only implement MarshalBinary for JSON, so they're
+// always walked field by field.
+func usesBinaryMarshaler(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || !t.Implements(binaryMarshalerType) {
+		return false
+	}
+
+	if _, ok := t.FieldByName("Message"); ok {
+		return false
+	}
+
+	return reflect.PointerTo(t).Implements(binaryUnmarshalerType)
+}
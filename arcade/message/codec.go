@@ -0,0 +1,236 @@
+package message
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// CodecJSON sends every message as JSON. It's kept around because it's
+	// easy to read when debugging.
+	CodecJSON = 0
+
+	// CodecBinaryV1 sends messages in the compact binary format below.
+	CodecBinaryV1 = 1
+
+	// CodecLatest is the newest codec this build can speak, and what's offered
+	// in the ping/pong handshake.
+	CodecLatest = CodecBinaryV1
+)
+
+// Codec encodes and decodes the messages sent over a single connection.
+//
+// Binary frames start with the codec version, followed by the type tag of the
+// message, the sender and recipient IDs, the message ID, and then the
+// message's own fields. Peer IDs are only sent in full the first time they're
+// used on a connection, after that they're replaced with a short integer, so
+// a codec must only ever be used for one connection, in order.
+//
+// JSON frames always start with '{', so both formats can be told apart
+// without knowing what the other side picked.
+type Codec struct {
+	sendMux sync.Mutex
+	version int
+	sendIDs map[string]uint64
+
+	recvMux sync.Mutex
+	recvIDs []string
+}
+
+func NewCodec() *Codec {
+	return &Codec{
+		version: CodecJSON,
+		sendIDs: make(map[string]uint64),
+	}
+}
+
+// Version returns the codec used for sending.
+func (c *Codec) Version() int {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	return c.version
+}
+
+// SetVersion changes the codec used for sending, once the other side has
+// agreed to it.
+func (c *Codec) SetVersion(version int) {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	c.version = version
+}
+
+// Encode encodes a message with the current codec. Messages must be sent in
+// the order they're encoded in.
+func (c *Codec) Encode(msg interface{}) ([]byte, error) {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	if c.version == CodecJSON {
+		return json.Marshal(msg)
+	}
+
+	v := reflect.ValueOf(msg)
+
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	header := v.FieldByName("Message").Interface().(Message)
+	tag, ok := typeTags[header.Type]
+
+	if !ok {
+		return nil, errors.New("unknown message type '" + header.Type + "'")
+	}
+
+	e := &encoder{}
+	e.buf = append(e.buf, byte(c.version))
+	e.uvarint(uint64(tag))
+	c.encodeID(e, header.SenderID)
+	c.encodeID(e, header.RecipientID)
+	encodeMessageID(e, header.MessageID)
+
+	if err := e.fields(v); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+// Decode decodes a message in any codec this build knows about.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty message")
+	}
+
+	if data[0] == '{' {
+		return parse(data)
+	}
+
+	if data[0] != CodecBinaryV1 {
+		return nil, fmt.Errorf("unknown codec version %d", data[0])
+	}
+
+	c.recvMux.Lock()
+	defer c.recvMux.Unlock()
+
+	d := &decoder{buf: data[1:]}
+	tag := d.uvarint()
+	messageType, ok := tags[uint16(tag)]
+
+	if d.err != nil {
+		return nil, d.err
+	} else if !ok {
+		return nil, fmt.Errorf("unknown message tag %d", tag)
+	}
+
+	msg, err := newMessage(messageType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := reflect.ValueOf(msg).Elem()
+
+	header := Message{Type: messageType}
+	header.SenderID = c.decodeID(d)
+	header.RecipientID = c.decodeID(d)
+	header.MessageID = decodeMessageID(d)
+
+	if err := d.fields(v); err != nil {
+		return nil, err
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	v.FieldByName("Message").Set(reflect.ValueOf(header))
+
+	return msg, nil
+}
+
+// encodeID writes 0 for no ID, the ID's index plus one if it has been sent
+// before, or one past the last index followed by the ID itself if it's new.
+func (c *Codec) encodeID(e *encoder, id string) {
+	if id == "" {
+		e.uvarint(0)
+		return
+	}
+
+	if ref, ok := c.sendIDs[id]; ok {
+		e.uvarint(ref)
+		return
+	}
+
+	ref := uint64(len(c.sendIDs) + 1)
+	c.sendIDs[id] = ref
+
+	e.uvarint(ref)
+	e.string(id)
+}
+
+func (c *Codec) decodeID(d *decoder) string {
+	ref := d.uvarint()
+
+	switch {
+	case d.err != nil || ref == 0:
+		return ""
+	case ref <= uint64(len(c.recvIDs)):
+		return c.recvIDs[ref-1]
+	case ref == uint64(len(c.recvIDs)+1):
+		id := d.string()
+		c.recvIDs = append(c.recvIDs, id)
+		return id
+	}
+
+	d.fail(fmt.Errorf("unknown peer ID %d", ref))
+	return ""
+}
+
+const (
+	messageIDEmpty = iota
+	messageIDUUID
+	messageIDString
+)
+
+// Message IDs are almost always UUIDs, which fit in 16 bytes.
+func encodeMessageID(e *encoder, id string) {
+	if id == "" {
+		e.buf = append(e.buf, messageIDEmpty)
+	} else if u, err := uuid.Parse(id); err == nil && u.String() == id {
+		e.buf = append(e.buf, messageIDUUID)
+		e.buf = append(e.buf, u[:]...)
+	} else {
+		e.buf = append(e.buf, messageIDString)
+		e.string(id)
+	}
+}
+
+func decodeMessageID(d *decoder) string {
+	switch d.byte() {
+	case messageIDEmpty:
+		return ""
+	case messageIDUUID:
+		var u uuid.UUID
+		copy(u[:], d.bytes(len(u)))
+		return u.String()
+	case messageIDString:
+		return d.string()
+	}
+
+	d.fail(errors.New("invalid message ID"))
+	return ""
+}
+
+// the embedded Message header is encoded separately
+var messageType = reflect.TypeOf(Message{})
+
+var byteOrder = binary.LittleEndian
@@ -0,0 +1,137 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testPosition struct {
+	X, Y int
+}
+
+type testCodecMessage struct {
+	Message
+
+	Name      string
+	Alive     bool
+	Score     float64
+	Scores    map[string]int
+	Players   []string
+	Path      []testPosition
+	Dir       *testPosition
+	Command   interface{}
+	Sent      time.Time
+	Ignored   string `json:"-"`
+	unchanged int
+	Data      []byte
+}
+
+func init() {
+	Register(testCodecMessage{Message: Message{Type: "test_codec"}})
+}
+
+func newTestCodecMessage() *testCodecMessage {
+	return &testCodecMessage{
+		Message: Message{
+			SenderID:    uuid.NewString(),
+			RecipientID: uuid.NewString(),
+			MessageID:   uuid.NewString(),
+			Type:        "test_codec",
+		},
+		Name:    "tron",
+		Alive:   true,
+		Score:   -1.5,
+		Scores:  map[string]int{"a": 3, "b": -7},
+		Players: []string{"a", "", "b"},
+		Path:    []testPosition{{1, 2}, {3, 4}},
+		Dir:     &testPosition{0, -1},
+		Command: map[string]interface{}{"Dir": 2, "Name": "up", "Ok": true, "Path": []interface{}{0.5, nil}},
+		Sent:    time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data:    []byte{1, 2, 3},
+	}
+}
+
+func testRoundTrip(t *testing.T, version int) {
+	sender, receiver := NewCodec(), NewCodec()
+	sender.SetVersion(version)
+
+	msg := newTestCodecMessage()
+	msg.Ignored = "not sent"
+
+	// send twice, so the second time peer IDs are sent as references
+	for i := 0; i < 2; i++ {
+		data, err := sender.Encode(msg)
+
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+
+		decoded, err := receiver.Decode(data)
+
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		expected := newTestCodecMessage()
+		expected.Message = msg.Message
+
+		// numbers in interfaces come back as the widest type of their kind
+		if version == CodecJSON {
+			expected.Command = map[string]interface{}{"Dir": 2.0, "Name": "up", "Ok": true, "Path": []interface{}{0.5, nil}}
+		} else {
+			expected.Command = map[string]interface{}{"Dir": int64(2), "Name": "up", "Ok": true, "Path": []interface{}{0.5, nil}}
+		}
+
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, decoded)
+		}
+	}
+}
+
+func TestCodecJSONRoundTrip(t *testing.T) {
+	testRoundTrip(t, CodecJSON)
+}
+
+func TestCodecBinaryRoundTrip(t *testing.T) {
+	testRoundTrip(t, CodecBinaryV1)
+}
+
+func TestCodecBinaryIsSmaller(t *testing.T) {
+	binaryCodec := NewCodec()
+	binaryCodec.SetVersion(CodecBinaryV1)
+
+	jsonData, _ := NewCodec().Encode(newTestCodecMessage())
+	binaryData, err := binaryCodec.Encode(newTestCodecMessage())
+
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	if len(binaryData)*2 > len(jsonData) {
+		t.Fatalf("expected binary (%d bytes) to be less than half of JSON (%d bytes)", len(binaryData), len(jsonData))
+	}
+}
+
+func TestCodecDecodesEitherVersion(t *testing.T) {
+	sender, receiver := NewCodec(), NewCodec()
+
+	for _, version := range []int{CodecJSON, CodecBinaryV1, CodecJSON} {
+		sender.SetVersion(version)
+		data, _ := sender.Encode(newTestCodecMessage())
+
+		if _, err := receiver.Decode(data); err != nil {
+			t.Fatalf("decode version %d: %v", version, err)
+		}
+	}
+}
+
+func TestCodecRejectsGarbage(t *testing.T) {
+	for _, data := range [][]byte{{}, {CodecBinaryV1}, {CodecBinaryV1, 0xff, 0xff, 0x03}, {42}} {
+		if _, err := NewCodec().Decode(data); err == nil {
+			t.Fatalf("expected decoding %v to fail", data)
+		}
+	}
+}
@@ -1,9 +1,8 @@
 package message
 
 import (
-	"encoding/json"
-	"log"
 	"reflect"
+	"sync"
 )
 
 type Listener struct {
@@ -17,41 +16,30 @@ type Listener struct {
 	Handle func(c, data interface{}) interface{}
 }
 
+var listenersMux sync.RWMutex
 var listeners = make([]Listener, 0)
 
 func AddListener(listener Listener) {
+	listenersMux.Lock()
+	defer listenersMux.Unlock()
+
 	listeners = append(listeners, listener)
 }
 
-func Notify(c interface{}, data []byte) []interface{} {
-
-	// defer func() {
-	// 	if r := recover(); r != nil {
-	// 		log.Println("RECOVERED", len(data), data)
-	// 	}
-	// }()
-
-	msg, err := parse(data)
+// Notify hands a decoded message to the listeners and returns their replies.
+func Notify(c interface{}, msg interface{}) []interface{} {
 	recipientID := reflect.ValueOf(msg).Elem().FieldByName("Message").FieldByName("RecipientID").String()
 
-	if err != nil {
-		log.Println("FUCKKKKK")
-		// panic(err)
-		res := struct {
-			Type string
-		}{}
-
-		if err := json.Unmarshal(data, &res); err != nil {
-			log.Println(res)
-		}
-	}
-
 	// log.Println("Received message:", msg)
 	// log.Println("notify parsed", msg, reflect.TypeOf(msg))
 
 	replies := make([]interface{}, 0)
 
-	for _, listener := range listeners {
+	listenersMux.RLock()
+	current := listeners
+	listenersMux.RUnlock()
+
+	for _, listener := range current {
 		if listener.ServerID != "" && listener.ServerID != recipientID && !listener.Distributor {
 			continue
 		}
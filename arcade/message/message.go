@@ -12,3 +12,13 @@ type Message struct {
 func (m Message) UnmarshalBinary(data []byte) error {
 	return json.Unmarshal(data, &m)
 }
+
+// Envelope is implemented by pointers to every message, through the Message
+// they embed, and lets their header be read and set without reflection.
+type Envelope interface {
+	Header() *Message
+}
+
+func (m *Message) Header() *Message {
+	return m
+}
@@ -3,11 +3,19 @@ package message
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"reflect"
 )
 
 var types = map[string]interface{}{}
 
+// Numeric tags of the registered types, used by the binary codec instead of
+// the type name. Tags are a hash of the name, so they don't depend on the
+// order types are registered in.
+var tags = map[uint16]string{}
+var typeTags = map[string]uint16{}
+
 func Register(msg interface{}) {
 	if reflect.TypeOf(msg).Kind() == reflect.Pointer {
 		panic("msg must be a value")
@@ -19,7 +27,34 @@ func Register(msg interface{}) {
 		return
 	}
 
+	tag := typeTag(messageType)
+
+	if other, ok := tags[tag]; ok {
+		panic(fmt.Sprintf("message types '%s' and '%s' have the same tag", messageType, other))
+	}
+
 	types[messageType] = msg
+	tags[tag] = messageType
+	typeTags[messageType] = tag
+}
+
+func typeTag(messageType string) uint16 {
+	h := fnv.New32a()
+	h.Write([]byte(messageType))
+	sum := h.Sum32()
+
+	return uint16(sum>>16) ^ uint16(sum)
+}
+
+// newMessage returns a pointer to a new message of the given registered type.
+func newMessage(messageType string) (interface{}, error) {
+	msg, ok := types[messageType]
+
+	if !ok {
+		return nil, errors.New("unknown message type '" + messageType + "'")
+	}
+
+	return reflect.New(reflect.TypeOf(msg)).Interface(), nil
 }
 
 func parse(data []byte) (interface{}, error) {
@@ -31,19 +66,15 @@ func parse(data []byte) (interface{}, error) {
 		return nil, err
 	}
 
-	for messageType := range types {
-		if messageType != res.Type {
-			continue
-		}
+	p, err := newMessage(res.Type)
 
-		p := reflect.New(reflect.TypeOf(types[messageType])).Interface()
-
-		if err := json.Unmarshal(data, p); err != nil {
-			panic(err)
-		}
+	if err != nil {
+		return nil, err
+	}
 
-		return reflect.ValueOf(p).Interface(), nil
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("unknown message type '" + res.Type + "'")
+	return p, nil
 }
@@ -0,0 +1,472 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Channel picks the delivery guarantees of a message sent with SendOn.
+// Channels are kept between us and each client we send to, end to end, so
+// messages relayed through distributors or other clients get the same
+// guarantees as ones sent directly.
+type Channel uint8
+
+const (
+	// Unreliable messages are sent once, and may be lost or arrive out of
+	// order, but are handled once at most. Use it for messages that are soon
+	// outdated anyway, like inputs.
+	Unreliable Channel = iota
+
+	// ReliableOrdered messages are resent until they're acknowledged, and
+	// handled once each in the order they were sent. Use it for control
+	// messages, like joining and leaving lobbies.
+	ReliableOrdered
+
+	// Reliable messages are resent until they're acknowledged, and handled
+	// once each in whatever order they arrive. SendAndReceive uses it.
+	Reliable
+
+	numChannels
+)
+
+// Reliable messages are resent if they aren't acknowledged within twice the
+// round trip time to the client, but no sooner than minRetransmitTimeout.
+// After maxRetransmits they're given up on, and skipped by the client. Giving
+// up on a ReliableOrdered message breaks the order later ones are handled in,
+// so the client is reported to the delegate as disconnected.
+const minRetransmitTimeout = 100 * time.Millisecond
+const maxRetransmits = 10
+const retransmitCheckInterval = 25 * time.Millisecond
+
+// Most messages kept from each client while waiting for an earlier one that
+// was lost. Messages beyond that aren't acknowledged, so they're resent.
+const maxOutOfOrder = 256
+
+// Unreliable messages arriving further than this behind the latest one from
+// their sender can't be told apart from replays, so they're dropped.
+const replayWindow = 64
+
+var errInvalidChannelHeader = errors.New("invalid channel header")
+
+// channelHeader is sealed along with every message, so it can't be changed by
+// the clients relaying it. Messages are numbered from 1 on each channel, so
+// that ones replayed by those clients are dropped. Reliable messages also
+// carry the lowest number their sender hasn't had acknowledged, so the
+// recipient knows not to wait for earlier ones.
+type channelHeader struct {
+	Channel Channel
+
+	// When the sender started numbering messages to us, in Unix nanoseconds.
+	// Numbering starts over when a client comes back after we've forgotten
+	// it, so later epochs replace earlier ones.
+	Epoch uint64
+
+	Seq  uint64
+	Base uint64
+}
+
+func (h channelHeader) append(buf []byte) []byte {
+	buf = append(buf, byte(h.Channel))
+	buf = appendUvarint(buf, h.Epoch)
+	buf = appendUvarint(buf, h.Seq)
+	return appendUvarint(buf, h.Base)
+}
+
+// readChannelHeader reads the header at the start of data, and returns it
+// along with the rest of data.
+func readChannelHeader(data []byte) (channelHeader, []byte, error) {
+	if len(data) == 0 || Channel(data[0]) >= numChannels {
+		return channelHeader{}, nil, errInvalidChannelHeader
+	}
+
+	h := channelHeader{Channel: Channel(data[0])}
+	data = data[1:]
+
+	for _, field := range []*uint64{&h.Epoch, &h.Seq, &h.Base} {
+		value, n := binary.Uvarint(data)
+
+		if n <= 0 {
+			return channelHeader{}, nil, errInvalidChannelHeader
+		}
+
+		*field = value
+		data = data[n:]
+	}
+
+	if h.Seq == 0 || h.Base > h.Seq {
+		return channelHeader{}, nil, errInvalidChannelHeader
+	}
+
+	return h, data, nil
+}
+
+type channelSeq struct {
+	channel Channel
+	seq     uint64
+}
+
+// unackedMessage is a reliable message waiting to be acknowledged.
+type unackedMessage struct {
+	sealed  *SealedMessage
+	sent    time.Time
+	retries int
+}
+
+// receivedMessages keeps track of what's been received from a client on one
+// channel.
+type receivedMessages struct {
+	// Every message before this one has been received, and on the ordered
+	// channel handled
+	next uint64
+
+	// Messages received after one that was lost. They're kept on the ordered
+	// channel until the lost one arrives, and only their numbers otherwise.
+	ahead map[uint64]interface{}
+
+	// On the unreliable channel, next is one past the latest message, and bit
+	// i is set if the message i before the latest one was received
+	recent uint64
+}
+
+// fresh returns true the first time an unreliable message arrives, and marks
+// it received.
+func (r *receivedMessages) fresh(seq uint64) bool {
+	if seq >= r.next {
+		shift := seq + 1 - r.next
+
+		if shift >= replayWindow {
+			r.recent = 0
+		} else {
+			r.recent <<= shift
+		}
+
+		r.recent |= 1
+		r.next = seq + 1
+		return true
+	}
+
+	behind := r.next - 1 - seq
+
+	if behind >= replayWindow || r.recent&(1<<behind) != 0 {
+		return false
+	}
+
+	r.recent |= 1 << behind
+	return true
+}
+
+// peerChannels is the state of the channels between us and one client.
+type peerChannels struct {
+	sync.Mutex
+
+	// Sending
+	epoch   uint64
+	nextSeq [numChannels]uint64
+	unacked map[channelSeq]*unackedMessage
+
+	// Receiving
+	peerEpoch uint64
+	received  [numChannels]*receivedMessages
+}
+
+func newPeerChannels() *peerChannels {
+	pc := &peerChannels{
+		epoch:   uint64(time.Now().UnixNano()),
+		unacked: make(map[channelSeq]*unackedMessage),
+	}
+
+	for channel := range pc.nextSeq {
+		pc.nextSeq[channel] = 1
+	}
+
+	pc.resetReceived(0)
+	return pc
+}
+
+// resetSending starts numbering messages over, for a client that comes back
+// after we forgot it. What we received from it is kept, so that its old
+// messages still can't be replayed.
+func (pc *peerChannels) resetSending() {
+	pc.Lock()
+	defer pc.Unlock()
+
+	pc.epoch = uint64(time.Now().UnixNano())
+	pc.unacked = make(map[channelSeq]*unackedMessage)
+
+	for channel := range pc.nextSeq {
+		pc.nextSeq[channel] = 1
+	}
+}
+
+func (pc *peerChannels) resetReceived(epoch uint64) {
+	pc.peerEpoch = epoch
+
+	for channel := range pc.received {
+		pc.received[channel] = &receivedMessages{next: 1, ahead: make(map[uint64]interface{})}
+	}
+}
+
+// number returns the header for the next message sent on channel.
+func (pc *peerChannels) number(channel Channel) channelHeader {
+	pc.Lock()
+	defer pc.Unlock()
+
+	h := channelHeader{Channel: channel, Epoch: pc.epoch, Seq: pc.nextSeq[channel]}
+	pc.nextSeq[channel]++
+
+	h.Base = h.Seq
+
+	for key := range pc.unacked {
+		if key.channel == channel && key.seq < h.Base {
+			h.Base = key.seq
+		}
+	}
+
+	return h
+}
+
+// track keeps a sealed message to resend until it's acknowledged.
+func (pc *peerChannels) track(h channelHeader, sealed *SealedMessage, now time.Time) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	pc.unacked[channelSeq{h.Channel, h.Seq}] = &unackedMessage{sealed: sealed, sent: now}
+}
+
+func (pc *peerChannels) ack(msg *AckMessage) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if msg.Epoch != pc.epoch {
+		return
+	}
+
+	for _, seq := range msg.Seqs {
+		delete(pc.unacked, channelSeq{msg.Channel, seq})
+	}
+}
+
+// receive returns the messages that can be handled now that msg arrived with
+// header h, and whether to acknowledge it.
+func (pc *peerChannels) receive(h channelHeader, msg interface{}) ([]interface{}, bool) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	if h.Epoch < pc.peerEpoch {
+		// Left over from before the client started over, and already
+		// given up on by it
+		return nil, true
+	} else if h.Epoch > pc.peerEpoch {
+		pc.resetReceived(h.Epoch)
+	}
+
+	r := pc.received[h.Channel]
+	ordered := h.Channel == ReliableOrdered
+	deliver := make([]interface{}, 0, 1)
+
+	if h.Channel == Unreliable {
+		if r.fresh(h.Seq) {
+			deliver = append(deliver, msg)
+		}
+
+		return deliver, false
+	}
+
+	// The sender gave up on or had acknowledged everything before Base, so
+	// stop waiting for it
+	for r.next < h.Base {
+		if buffered, ok := r.ahead[r.next]; ok && ordered {
+			deliver = append(deliver, buffered)
+		}
+
+		delete(r.ahead, r.next)
+		r.next++
+	}
+
+	if _, ok := r.ahead[h.Seq]; ok || h.Seq < r.next {
+		// Already received, but the acknowledgement may have been lost
+		return deliver, true
+	}
+
+	if h.Seq > r.next {
+		if len(r.ahead) >= maxOutOfOrder {
+			return deliver, false
+		}
+
+		if ordered {
+			r.ahead[h.Seq] = msg
+		} else {
+			r.ahead[h.Seq] = nil
+			deliver = append(deliver, msg)
+		}
+
+		return deliver, true
+	}
+
+	deliver = append(deliver, msg)
+	r.next++
+
+	for {
+		buffered, ok := r.ahead[r.next]
+
+		if !ok {
+			break
+		}
+
+		if ordered {
+			deliver = append(deliver, buffered)
+		}
+
+		delete(r.ahead, r.next)
+		r.next++
+	}
+
+	return deliver, true
+}
+
+// due returns the messages that haven't been acknowledged in timeout and need
+// to be resent, and forgets ones that have been resent too often. lost is true
+// if one of those was sent on ReliableOrdered.
+func (pc *peerChannels) due(now time.Time, timeout time.Duration) (resend []*SealedMessage, lost bool) {
+	pc.Lock()
+	defer pc.Unlock()
+
+	resend = make([]*SealedMessage, 0)
+
+	for key, unacked := range pc.unacked {
+		if now.Sub(unacked.sent) < timeout {
+			continue
+		}
+
+		if unacked.retries >= maxRetransmits {
+			log.Println("Giving up on message", unacked.sealed.MessageID, "to", unacked.sealed.RecipientID)
+			delete(pc.unacked, key)
+			lost = lost || key.channel == ReliableOrdered
+			continue
+		}
+
+		unacked.retries++
+		unacked.sent = now
+		resend = append(resend, unacked.sealed)
+	}
+
+	return resend, lost
+}
+
+// channelsTo returns the state of the channels between us and a client.
+func (n *Network) channelsTo(clientID string) *peerChannels {
+	if pc, ok := n.channels.Load(clientID); ok {
+		return pc.(*peerChannels)
+	}
+
+	pc, _ := n.channels.LoadOrStore(clientID, newPeerChannels())
+	return pc.(*peerChannels)
+}
+
+// receive returns the messages that can be handled now that msg arrived from
+// sender with header h, and acknowledges it if it's reliable.
+func (n *Network) receive(sender *Client, h channelHeader, msg interface{}) []interface{} {
+	sender.RLock()
+	senderID := sender.ID
+	sender.RUnlock()
+
+	deliver, ack := n.channelsTo(senderID).receive(h, msg)
+
+	if ack && h.Channel != Unreliable {
+		n.Send(sender, NewAckMessage(h.Channel, h.Epoch, []uint64{h.Seq}))
+	}
+
+	return deliver
+}
+
+// retransmit periodically resends reliable messages that haven't been
+// acknowledged.
+func (n *Network) retransmit() {
+	for {
+		time.Sleep(retransmitCheckInterval)
+
+		now := time.Now()
+
+		n.channels.Range(func(key, value any) bool {
+			client, ok := n.GetClient(key.(string))
+
+			if !ok {
+				// Keep the messages in case the client comes back, but
+				// count the attempt
+				value.(*peerChannels).due(now, minRetransmitTimeout)
+				return true
+			}
+
+			resend, lost := value.(*peerChannels).due(now, retransmitTimeout(client))
+
+			if lost {
+				go n.lostOrdered(key.(string))
+				return true
+			}
+
+			for _, sealed := range resend {
+				n.SendRaw(client, sealed)
+			}
+
+			return true
+		})
+	}
+}
+
+// lostOrdered reports a client that never acknowledged a ReliableOrdered
+// message as disconnected, since the messages sent to it after that one can't
+// be relied on any more. Its channels start over, so if it's still around it
+// gets what's sent from now on in order.
+func (n *Network) lostOrdered(clientID string) {
+	log.Println("Lost an ordered message to", clientID, "- reporting it disconnected")
+
+	n.channelsTo(clientID).resetSending()
+
+	if n.Delegate != nil {
+		n.Delegate.ClientDisconnected(clientID)
+	}
+}
+
+func retransmitTimeout(client *Client) time.Duration {
+	client.RLock()
+	defer client.RUnlock()
+
+	if timeout := 2 * time.Duration(client.Distance) * time.Millisecond; timeout > minRetransmitTimeout {
+		return timeout
+	}
+
+	return minRetransmitTimeout
+}
+
+// AckMessage acknowledges reliable messages, so their sender stops resending
+// them. It's always sent unreliably, since lost acknowledgements just cause
+// the message to be resent and acknowledged again.
+type AckMessage struct {
+	message.Message
+
+	Channel Channel
+	Epoch   uint64
+	Seqs    []uint64
+}
+
+func NewAckMessage(channel Channel, epoch uint64, seqs []uint64) *AckMessage {
+	return &AckMessage{
+		Message: message.Message{Type: "ack"},
+		Channel: channel,
+		Epoch:   epoch,
+		Seqs:    seqs,
+	}
+}
+
+func (m AckMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m AckMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
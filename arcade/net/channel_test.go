@@ -0,0 +1,341 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countMessage struct {
+	message.Message
+	N int
+}
+
+func (m countMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m countMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+func init() {
+	message.Register(countMessage{Message: message.Message{Type: "count"}})
+}
+
+func newCountMessage(n int) *countMessage {
+	return &countMessage{Message: message.Message{Type: "count"}, N: n}
+}
+
+func counts(msgs []interface{}) []int {
+	ns := make([]int, 0, len(msgs))
+
+	for _, msg := range msgs {
+		ns = append(ns, msg.(*countMessage).N)
+	}
+
+	return ns
+}
+
+func expectCounts(t *testing.T, what string, msgs []interface{}, expected ...int) {
+	t.Helper()
+
+	got := counts(msgs)
+
+	if len(got) != len(expected) {
+		t.Fatalf("%s: expected %v, got %v", what, expected, got)
+	}
+
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("%s: expected %v, got %v", what, expected, got)
+		}
+	}
+}
+
+func TestChannelHeadersRoundTrip(t *testing.T) {
+	for _, h := range []channelHeader{
+		{Channel: Unreliable, Epoch: 1, Seq: 5, Base: 5},
+		{Channel: ReliableOrdered, Epoch: uint64(time.Now().UnixNano()), Seq: 300, Base: 2},
+		{Channel: Reliable, Epoch: 1, Seq: 1, Base: 1},
+	} {
+		decoded, rest, err := readChannelHeader(append(h.append(nil), "rest"...))
+
+		if err != nil || decoded != h || string(rest) != "rest" {
+			t.Fatalf("expected %+v, got %+v with %q, %v", h, decoded, rest, err)
+		}
+	}
+
+	for _, data := range [][]byte{
+		{},
+		{byte(numChannels)},
+		// Unreliable messages are numbered too
+		{byte(Unreliable)},
+		{byte(Unreliable), 1, 0, 0},
+		{byte(Reliable), 1},
+		// Messages are numbered from 1, and never come before their base
+		{byte(Reliable), 1, 0, 0},
+		{byte(Reliable), 1, 1, 2},
+	} {
+		if _, _, err := readChannelHeader(data); err == nil {
+			t.Fatalf("expected %v to be invalid", data)
+		}
+	}
+}
+
+func TestUnreliableChannelHandlesMessagesOnce(t *testing.T) {
+	pc := newPeerChannels()
+	h := func(epoch, seq uint64) channelHeader {
+		return channelHeader{Channel: Unreliable, Epoch: epoch, Seq: seq, Base: seq}
+	}
+
+	msgs, ack := pc.receive(h(1, 3), newCountMessage(3))
+	expectCounts(t, "message after lost ones", msgs, 3)
+
+	if ack {
+		t.Fatalf("expected unreliable messages not to be acknowledged")
+	}
+
+	msgs, _ = pc.receive(h(1, 3), newCountMessage(3))
+	expectCounts(t, "a replayed message", msgs)
+
+	msgs, _ = pc.receive(h(1, 1), newCountMessage(1))
+	expectCounts(t, "a message out of order", msgs, 1)
+
+	msgs, _ = pc.receive(h(1, 1), newCountMessage(1))
+	expectCounts(t, "a replayed message out of order", msgs)
+
+	msgs, _ = pc.receive(h(1, 3+replayWindow), newCountMessage(3+replayWindow))
+	expectCounts(t, "a message far ahead", msgs, 3+replayWindow)
+
+	msgs, _ = pc.receive(h(1, 2), newCountMessage(2))
+	expectCounts(t, "a message too far behind to tell from a replay", msgs)
+
+	msgs, _ = pc.receive(h(1, 10), newCountMessage(10))
+	expectCounts(t, "a message inside the window", msgs, 10)
+
+	// Numbering starts over when the sender does, and its old messages are
+	// left behind
+	msgs, _ = pc.receive(h(2, 1), newCountMessage(1))
+	expectCounts(t, "a message from a new epoch", msgs, 1)
+
+	msgs, _ = pc.receive(h(1, 5+replayWindow), newCountMessage(5+replayWindow))
+	expectCounts(t, "a message from an old epoch", msgs)
+}
+
+func TestOrderedChannelWaitsForLostMessages(t *testing.T) {
+	pc := newPeerChannels()
+	h := func(seq, base uint64) channelHeader {
+		return channelHeader{Channel: ReliableOrdered, Epoch: 1, Seq: seq, Base: base}
+	}
+
+	msgs, _ := pc.receive(h(2, 1), newCountMessage(2))
+	expectCounts(t, "message after a lost one", msgs)
+
+	msgs, _ = pc.receive(h(3, 1), newCountMessage(3))
+	expectCounts(t, "another message after a lost one", msgs)
+
+	msgs, ack := pc.receive(h(2, 1), newCountMessage(2))
+	expectCounts(t, "a repeated message", msgs)
+
+	if !ack {
+		t.Fatalf("expected repeated messages to be acknowledged again")
+	}
+
+	msgs, _ = pc.receive(h(1, 1), newCountMessage(1))
+	expectCounts(t, "the lost message", msgs, 1, 2, 3)
+
+	msgs, _ = pc.receive(h(1, 1), newCountMessage(1))
+	expectCounts(t, "a message already handled", msgs)
+
+	// The sender gave up on 4, so don't wait for it
+	msgs, _ = pc.receive(h(6, 6), newCountMessage(6))
+	expectCounts(t, "a message after one given up on", msgs, 6)
+
+	msgs, _ = pc.receive(h(8, 7), newCountMessage(8))
+	expectCounts(t, "a message before a gap", msgs)
+
+	msgs, _ = pc.receive(h(9, 9), newCountMessage(9))
+	expectCounts(t, "a message after the gap was given up on", msgs, 8, 9)
+}
+
+func TestReliableChannelHandlesMessagesOnce(t *testing.T) {
+	pc := newPeerChannels()
+	h := func(epoch, seq uint64) channelHeader {
+		return channelHeader{Channel: Reliable, Epoch: epoch, Seq: seq, Base: 1}
+	}
+
+	msgs, _ := pc.receive(h(1, 2), newCountMessage(2))
+	expectCounts(t, "message after a lost one", msgs, 2)
+
+	msgs, _ = pc.receive(h(1, 2), newCountMessage(2))
+	expectCounts(t, "a repeated message", msgs)
+
+	msgs, _ = pc.receive(h(1, 1), newCountMessage(1))
+	expectCounts(t, "the lost message", msgs, 1)
+
+	// Numbering starts over when the sender does
+	msgs, _ = pc.receive(h(2, 1), newCountMessage(1))
+	expectCounts(t, "a message from a new epoch", msgs, 1)
+
+	msgs, _ = pc.receive(h(1, 3), newCountMessage(3))
+	expectCounts(t, "a message from an old epoch", msgs)
+}
+
+func TestChannelsResendUntilAcknowledged(t *testing.T) {
+	pc := newPeerChannels()
+	now := time.Now()
+
+	first := pc.number(Reliable)
+	pc.track(first, &SealedMessage{}, now)
+
+	second := pc.number(Reliable)
+	pc.track(second, &SealedMessage{}, now)
+
+	if first.Seq != 1 || second.Seq != 2 || second.Base != 1 {
+		t.Fatalf("expected messages numbered from 1 on, got %+v and %+v", first, second)
+	}
+
+	if resend, _ := pc.due(now, time.Second); len(resend) != 0 {
+		t.Fatalf("expected nothing to be resent yet, got %d", len(resend))
+	}
+
+	if resend, _ := pc.due(now.Add(time.Second), time.Second); len(resend) != 2 {
+		t.Fatalf("expected both messages to be resent, got %d", len(resend))
+	}
+
+	pc.ack(NewAckMessage(Reliable, pc.epoch, []uint64{1}))
+
+	if third := pc.number(Reliable); third.Base != 2 {
+		t.Fatalf("expected the acknowledged message not to be waited for, got %+v", third)
+	}
+
+	lost := false
+	for i := 0; i <= maxRetransmits; i++ {
+		_, lost = pc.due(now.Add(time.Duration(i+2)*time.Second), time.Second)
+	}
+
+	if len(pc.unacked) != 0 {
+		t.Fatalf("expected messages to be given up on after %d retransmits", maxRetransmits)
+	}
+
+	if lost {
+		t.Fatalf("expected giving up on unordered messages not to be reported")
+	}
+}
+
+func TestChannelsReportLostOrderedMessages(t *testing.T) {
+	pc := newPeerChannels()
+	now := time.Now()
+
+	pc.track(pc.number(ReliableOrdered), &SealedMessage{}, now)
+
+	for i := 1; i <= maxRetransmits; i++ {
+		if _, lost := pc.due(now.Add(time.Duration(i)*time.Second), time.Second); lost {
+			t.Fatalf("expected the message not to be lost after %d retransmits", i)
+		}
+	}
+
+	if _, lost := pc.due(now.Add(time.Duration(maxRetransmits+1)*time.Second), time.Second); !lost {
+		t.Fatalf("expected the message to be lost after %d retransmits", maxRetransmits)
+	}
+}
+
+// disconnectRecorder is a NetworkDelegate that records who's reported as
+// disconnected.
+type disconnectRecorder struct {
+	disconnected chan string
+}
+
+func (d *disconnectRecorder) ClientConnected(id string) {}
+
+func (d *disconnectRecorder) ClientDisconnected(id string) {
+	d.disconnected <- id
+}
+
+func TestNetworksReportClientsThatLoseOrderedMessages(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	recorder := &disconnectRecorder{disconnected: make(chan string, 1)}
+	a.Delegate = recorder
+
+	b.SetDropRate(1)
+	a.SendOn(client, ReliableOrdered, newCountMessage(1))
+
+	select {
+	case id := <-recorder.disconnected:
+		if id != b.me {
+			t.Fatalf("expected %s to be reported disconnected, got %s", b.me, id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a client that never acknowledges an ordered message to be reported disconnected")
+	}
+}
+
+func TestNetworksDeliverReliablyOverLossyLinks(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	var mu sync.Mutex
+	received := make([]interface{}, 0)
+
+	message.AddListener(message.Listener{
+		ServerID: b.me,
+		Handle: func(c, msg interface{}) interface{} {
+			if msg, ok := msg.(*countMessage); ok && c.(*Client).Delegate == b {
+				mu.Lock()
+				received = append(received, msg)
+				mu.Unlock()
+			}
+
+			return nil
+		},
+	})
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	a.SetDropRate(0.3)
+	b.SetDropRate(0.3)
+
+	expected := make([]int, 0)
+
+	for i := 1; i <= 50; i++ {
+		a.SendOn(client, ReliableOrdered, newCountMessage(i))
+		expected = append(expected, i)
+	}
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		mu.Lock()
+		done := len(received) >= len(expected)
+		mu.Unlock()
+
+		if done {
+			break
+		}
+	}
+
+	// Wait for any repeats to turn up
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	expectCounts(t, "messages over a lossy link", received, expected...)
+}
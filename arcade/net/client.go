@@ -1,9 +1,12 @@
 package net
 
 import (
-	"encoding"
+	"arcade/arcade/message"
+	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Actually can't be increased past this number -- kcp-go enforces a packet
@@ -18,6 +21,28 @@ type ClientRoutingInfo struct {
 
 	// True if this client is a distributor.
 	Distributor bool
+
+	// The client's public key, and the salt that its ID was derived from
+	// along with it. See VerifySessionID.
+	PublicKey []byte
+	IDSalt    string
+}
+
+// Traffic counts what's been sent to and received from a neighbor over its
+// connection. Bytes include fragment headers, and messages are counted whole.
+type Traffic struct {
+	BytesIn     uint64
+	BytesOut    uint64
+	MessagesIn  uint64
+	MessagesOut uint64
+}
+
+// trafficCounters is where a client's Traffic is counted, along with when it
+// last received a message, in Unix nanoseconds.
+type trafficCounters struct {
+	Traffic
+
+	lastReceived int64
 }
 
 type ConnectionState int
@@ -56,9 +81,30 @@ type Client struct {
 
 	conn net.Conn
 
+	// Encodes messages to and decodes messages from this client. Encoding
+	// and queueing happen under sendMux so messages go out in the order
+	// they were encoded.
+	codec   *message.Codec
+	sendMux sync.Mutex
+
+	// ID of the next message that needs to be fragmented, and the fragments
+	// received so far from this client
+	nextFragmentID uint32
+	reassembler    *reassembler
+
+	// Key for messages sealed between us and this client
+	sessionKey []byte
+
+	// Updated atomically, so it's allocated separately to keep it aligned
+	traffic *trafficCounters
+
 	sendCh chan []byte
 	recvCh chan []byte
 
+	// Closed when the client disconnects. sendCh and recvCh are never closed,
+	// since other goroutines may still be sending on them.
+	closeCh chan struct{}
+
 	State          ConnectionState
 	TimeoutRetries int
 }
@@ -66,9 +112,13 @@ type Client struct {
 // start begins reading and writing messages with this client.
 func (c *Client) start(conn net.Conn) {
 	c.conn = conn
+	c.codec = message.NewCodec()
+	c.reassembler = newReassembler()
+	c.traffic = &trafficCounters{}
 
 	c.recvCh = make(chan []byte, maxBufferSize)
 	c.sendCh = make(chan []byte, maxBufferSize)
+	c.closeCh = make(chan struct{})
 
 	go c.readPump()
 	go c.writePump()
@@ -84,8 +134,7 @@ func (c *Client) disconnect() {
 	c.State = Disconnected
 
 	if c.NextHop == "" {
-		close(c.sendCh)
-		close(c.recvCh)
+		close(c.closeCh)
 
 		if c.conn != nil {
 			c.conn.Close()
@@ -108,10 +157,31 @@ func (c *Client) readPump() {
 			return
 		}
 
+		atomic.AddUint64(&c.traffic.BytesIn, uint64(n))
+
 		data := make([]byte, n)
 		copy(data, buf[:n])
 
-		c.recvCh <- data
+		if isFragment(data) {
+			data, err = c.reassembler.add(data, time.Now())
+
+			if err != nil {
+				log.Println("Dropping fragment:", err)
+				continue
+			} else if data == nil {
+				// wait for the rest of the message
+				continue
+			}
+		}
+
+		atomic.AddUint64(&c.traffic.MessagesIn, 1)
+		atomic.StoreInt64(&c.traffic.lastReceived, time.Now().UnixNano())
+
+		select {
+		case c.recvCh <- data:
+		case <-c.closeCh:
+			return
+		}
 
 		// // Randomly drop packets if debugging
 		// dropRate := arcade.Server.Network.GetDropRate()
@@ -128,20 +198,23 @@ func (c *Client) readPump() {
 // writePump pumps messages from the sendCh to the client's UDP connection.
 func (c *Client) writePump() {
 	for {
-		data, ok := <-c.sendCh
-		// log.Println("Sending message:", string(data))
+		var data []byte
 
-		if !ok {
-			c.disconnect()
+		select {
+		case data = <-c.sendCh:
+			// log.Println("Sending message:", string(data))
+		case <-c.closeCh:
 			return
 		}
 
-		_, err := c.conn.Write(data)
+		n, err := c.conn.Write(data)
 
 		if err != nil {
 			c.disconnect()
 			return
 		}
+
+		atomic.AddUint64(&c.traffic.BytesOut, uint64(n))
 	}
 }
 
@@ -154,8 +227,76 @@ func (c *Client) Send(msg interface{}) bool {
 	}
 	c.RUnlock()
 
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
 	// log.Println("SENDING: ", msg)
-	data, _ := msg.(encoding.BinaryMarshaler).MarshalBinary()
-	c.sendCh <- data
+	data, err := c.codec.Encode(msg)
+
+	if err != nil {
+		log.Println("Send failed:", err)
+		return false
+	}
+
+	packets, err := fragment(c.nextFragmentID, data)
+
+	if err != nil {
+		log.Println("Send failed:", err)
+		return false
+	}
+
+	if len(packets) > 1 {
+		c.nextFragmentID++
+	}
+
+	atomic.AddUint64(&c.traffic.MessagesOut, 1)
+
+	for _, packet := range packets {
+		select {
+		case c.sendCh <- packet:
+		case <-c.closeCh:
+			return false
+		}
+	}
+
 	return true
 }
+
+// Traffic returns what's been sent to and received from the client so far.
+// It's always zero for clients reached through another client.
+func (c *Client) Traffic() Traffic {
+	if c.traffic == nil {
+		return Traffic{}
+	}
+
+	return Traffic{
+		BytesIn:     atomic.LoadUint64(&c.traffic.BytesIn),
+		BytesOut:    atomic.LoadUint64(&c.traffic.BytesOut),
+		MessagesIn:  atomic.LoadUint64(&c.traffic.MessagesIn),
+		MessagesOut: atomic.LoadUint64(&c.traffic.MessagesOut),
+	}
+}
+
+// LastReceived returns when the client last sent us a message over its
+// connection, or the zero time if it hasn't yet.
+func (c *Client) LastReceived() time.Time {
+	if c.traffic == nil {
+		return time.Time{}
+	}
+
+	if nanos := atomic.LoadInt64(&c.traffic.lastReceived); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+
+	return time.Time{}
+}
+
+// PlayerID returns the persistent ID of the player behind the client, which
+// stays the same when they come back in another session. It's empty until the
+// client's public key is known.
+func (c *Client) PlayerID() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return PlayerIDFor(c.PublicKey)
+}
@@ -0,0 +1,180 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Messages that don't fit in one packet are split into fragments. Fragments
+// start with a marker byte that no codec starts its messages with, followed by
+// the ID of the message being split, the index of the fragment and the total
+// number of fragments, and then the fragment's share of the message.
+const fragmentMarker = 0xfe
+
+// Room for the marker and three varints
+const fragmentHeaderSize = 1 + 3*binary.MaxVarintLen32
+
+const fragmentPayloadSize = maxBufferSize - fragmentHeaderSize
+
+// Messages larger than this many fragments (about 300 KB) are refused.
+const maxFragments = 256
+
+// Partially received messages are dropped if the rest of their fragments
+// don't arrive within this long, or if too many are waiting at once.
+const fragmentTimeout = 5 * time.Second
+const maxPartialMessages = 16
+
+var errMessageTooLarge = errors.New("message too large to send")
+
+// fragment splits data into packets of at most maxBufferSize bytes. Messages
+// that already fit are sent as they are.
+func fragment(id uint32, data []byte) ([][]byte, error) {
+	if len(data) <= maxBufferSize {
+		return [][]byte{data}, nil
+	}
+
+	count := (len(data) + fragmentPayloadSize - 1) / fragmentPayloadSize
+
+	if count > maxFragments {
+		return nil, errMessageTooLarge
+	}
+
+	packets := make([][]byte, 0, count)
+
+	for i := 0; i < count; i++ {
+		start := i * fragmentPayloadSize
+		end := start + fragmentPayloadSize
+
+		if end > len(data) {
+			end = len(data)
+		}
+
+		packet := make([]byte, 0, fragmentHeaderSize+end-start)
+		packet = append(packet, fragmentMarker)
+		packet = appendUvarint(packet, uint64(id))
+		packet = appendUvarint(packet, uint64(i))
+		packet = appendUvarint(packet, uint64(count))
+		packet = append(packet, data[start:end]...)
+
+		packets = append(packets, packet)
+	}
+
+	return packets, nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+func isFragment(packet []byte) bool {
+	return len(packet) > 0 && packet[0] == fragmentMarker
+}
+
+type partialMessage struct {
+	fragments [][]byte
+	received  int
+	started   time.Time
+}
+
+// reassembler puts fragmented messages back together. Each client has its own,
+// since fragment IDs are only unique per sender.
+type reassembler struct {
+	partials map[uint32]*partialMessage
+}
+
+func newReassembler() *reassembler {
+	return &reassembler{
+		partials: make(map[uint32]*partialMessage),
+	}
+}
+
+// add adds a fragment, and returns the whole message once its last fragment
+// has arrived, or nil until then.
+func (r *reassembler) add(packet []byte, now time.Time) ([]byte, error) {
+	r.expire(now)
+
+	id, index, count, payload, err := parseFragment(packet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := r.partials[id]
+
+	if !ok {
+		if len(r.partials) >= maxPartialMessages {
+			return nil, fmt.Errorf("too many partial messages, dropping fragment of message %d", id)
+		}
+
+		p = &partialMessage{
+			fragments: make([][]byte, count),
+			started:   now,
+		}
+
+		r.partials[id] = p
+	}
+
+	if len(p.fragments) != count {
+		delete(r.partials, id)
+		return nil, fmt.Errorf("fragments of message %d disagree on the number of fragments", id)
+	}
+
+	if p.fragments[index] == nil {
+		p.fragments[index] = payload
+		p.received++
+	}
+
+	if p.received < count {
+		return nil, nil
+	}
+
+	delete(r.partials, id)
+
+	data := make([]byte, 0, count*fragmentPayloadSize)
+
+	for _, fragment := range p.fragments {
+		data = append(data, fragment...)
+	}
+
+	return data, nil
+}
+
+// expire drops messages that have been waiting on fragments for too long.
+func (r *reassembler) expire(now time.Time) {
+	for id, p := range r.partials {
+		if now.Sub(p.started) > fragmentTimeout {
+			log.Printf("Dropping message %d, only got %d of %d fragments", id, p.received, len(p.fragments))
+			delete(r.partials, id)
+		}
+	}
+}
+
+func parseFragment(packet []byte) (id uint32, index, count int, payload []byte, err error) {
+	if !isFragment(packet) {
+		return 0, 0, 0, nil, errors.New("not a fragment")
+	}
+
+	buf := packet[1:]
+	var header [3]uint64
+
+	for i := range header {
+		x, n := binary.Uvarint(buf)
+
+		if n <= 0 {
+			return 0, 0, 0, nil, errors.New("invalid fragment header")
+		}
+
+		header[i] = x
+		buf = buf[n:]
+	}
+
+	if header[0] > 0xffffffff || header[2] == 0 || header[2] > maxFragments || header[1] >= header[2] {
+		return 0, 0, 0, nil, errors.New("invalid fragment header")
+	}
+
+	return uint32(header[0]), int(header[1]), int(header[2]), buf, nil
+}
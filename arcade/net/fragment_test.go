@@ -0,0 +1,160 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSmallMessagesAreNotFragmented(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), maxBufferSize)
+	packets, err := fragment(0, data)
+
+	if err != nil {
+		t.Fatalf("fragment: %v", err)
+	}
+
+	if len(packets) != 1 || !bytes.Equal(packets[0], data) {
+		t.Fatalf("expected message to be sent as is")
+	}
+}
+
+func TestFragmentsReassembleInAnyOrder(t *testing.T) {
+	data := make([]byte, 10*maxBufferSize+17)
+	rand.Read(data)
+
+	packets, err := fragment(7, data)
+
+	if err != nil {
+		t.Fatalf("fragment: %v", err)
+	}
+
+	for _, packet := range packets {
+		if len(packet) > maxBufferSize {
+			t.Fatalf("fragment of %d bytes doesn't fit in a packet", len(packet))
+		}
+	}
+
+	rand.Shuffle(len(packets), func(i, j int) { packets[i], packets[j] = packets[j], packets[i] })
+
+	// duplicates are ignored
+	packets = append([][]byte{packets[0]}, packets...)
+
+	r := newReassembler()
+	now := time.Now()
+
+	for i, packet := range packets {
+		msg, err := r.add(packet, now)
+
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+
+		if i < len(packets)-1 && msg != nil {
+			t.Fatalf("message reassembled after %d of %d fragments", i+1, len(packets))
+		} else if i == len(packets)-1 && !bytes.Equal(msg, data) {
+			t.Fatalf("reassembled message doesn't match")
+		}
+	}
+}
+
+func TestIncompleteMessagesExpire(t *testing.T) {
+	packets, _ := fragment(1, make([]byte, 3*maxBufferSize))
+
+	r := newReassembler()
+	now := time.Now()
+
+	r.add(packets[0], now)
+	r.add(packets[1], now)
+
+	// the last fragment arrives too late to complete the message
+	if msg, err := r.add(packets[2], now.Add(2*fragmentTimeout)); err != nil || msg != nil {
+		t.Fatalf("expected message to have expired, got %d bytes, %v", len(msg), err)
+	}
+
+	if len(r.partials) != 1 {
+		t.Fatalf("expected only the late fragment to be waiting, got %d messages", len(r.partials))
+	}
+}
+
+func TestOversizedMessagesAreRefused(t *testing.T) {
+	if _, err := fragment(0, make([]byte, (maxFragments+1)*fragmentPayloadSize)); err != errMessageTooLarge {
+		t.Fatalf("expected message to be refused, got %v", err)
+	}
+}
+
+func TestInvalidFragmentsAreRejected(t *testing.T) {
+	invalid := [][]byte{
+		{fragmentMarker},
+		{fragmentMarker, 0, 2, 2},
+		{fragmentMarker, 0, 0, 0},
+		{fragmentMarker, 0, 0, 0xff, 0xff, 0x03},
+	}
+
+	for _, packet := range invalid {
+		if _, err := newReassembler().add(packet, time.Now()); err == nil {
+			t.Fatalf("expected fragment %v to be rejected", packet)
+		}
+	}
+}
+
+func TestClientsSendLargeMessages(t *testing.T) {
+	transport := NewMemoryTransport()
+	listener, err := transport.Listen("memory:1")
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		conn, err := transport.Dial("memory:1")
+
+		if err != nil {
+			return
+		}
+
+		sender := &Client{State: Connected}
+		sender.start(conn)
+
+		distances := make(map[string]ClientRoutingInfo)
+
+		for i := 0; i < 1000; i++ {
+			distances[fmt.Sprintf("client-%d", i)] = ClientRoutingInfo{Distance: float64(i)}
+		}
+
+		sender.Send(NewRoutingMessage(distances))
+	}()
+
+	conn, err := listener.Accept()
+
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	receiver := &Client{State: Connected}
+	receiver.start(conn)
+
+	select {
+	case data := <-receiver.recvCh:
+		msg, err := receiver.codec.Decode(data)
+
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if distances := msg.(*RoutingMessage).Distances; len(distances) != 1000 {
+			t.Fatalf("expected 1000 routes, got %d", len(distances))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("message never arrived")
+	}
+}
+
+func init() {
+	message.Register(RoutingMessage{Message: message.Message{Type: "routing"}})
+}
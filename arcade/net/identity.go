@@ -0,0 +1,86 @@
+package net
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Identity is a client's long-term X25519 keypair. It's saved with the
+// player's profile, and used to agree on a key with every other client.
+type Identity struct {
+	PublicKey  []byte
+	PrivateKey []byte
+}
+
+// Session IDs are hashed into this namespace.
+var sessionNamespace = uuid.MustParse("fb3b0a03-c5fc-4fa6-84a5-4f12f375aa5f")
+
+// Player IDs are hashed into this namespace, so they never match a session ID.
+var playerNamespace = uuid.MustParse("5d1c7e0e-3f0a-4b8e-9a57-2c61d8f4b9a2")
+
+func GenerateIdentity() (*Identity, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+
+	if _, err := rand.Read(privateKey); err != nil {
+		return nil, err
+	}
+
+	return NewIdentity(privateKey)
+}
+
+// NewIdentity returns the identity with the given private key.
+func NewIdentity(privateKey []byte) (*Identity, error) {
+	if len(privateKey) != curve25519.ScalarSize {
+		return nil, errors.New("invalid private key")
+	}
+
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	}, nil
+}
+
+// SessionID returns the network ID to use for a session. IDs are a hash of
+// the public key and a salt that's picked every session, so a client can't
+// claim an ID without the private key that goes with it.
+func (id *Identity) SessionID(salt string) string {
+	return sessionIDFor(id.PublicKey, salt)
+}
+
+// PlayerID returns the ID of the player the identity belongs to. Unlike the
+// session ID it's the same every session, so it recognizes a returning player,
+// while still being derived from the public key so it can't be claimed without
+// the private key.
+func (id *Identity) PlayerID() string {
+	return PlayerIDFor(id.PublicKey)
+}
+
+// PlayerIDFor returns the ID of the player with the given public key, or an
+// empty string if the key is invalid.
+func PlayerIDFor(publicKey []byte) string {
+	if len(publicKey) != curve25519.PointSize {
+		return ""
+	}
+
+	return uuid.NewSHA1(playerNamespace, publicKey).String()
+}
+
+// VerifySessionID returns whether sessionID belongs to publicKey.
+func VerifySessionID(sessionID string, publicKey []byte, salt string) bool {
+	return len(publicKey) == curve25519.PointSize && sessionID == sessionIDFor(publicKey, salt)
+}
+
+func sessionIDFor(publicKey []byte, salt string) string {
+	data := bytes.Join([][]byte{publicKey, []byte(salt)}, nil)
+	return uuid.NewSHA1(sessionNamespace, data).String()
+}
@@ -1,10 +1,26 @@
 package net
 
+import (
+	"log"
+	"math"
+)
+
 func (n *Network) processMessage(client, msg interface{}) interface{} {
 	c := client.(*Client)
 
+	// Every network gets every message, so ignore the ones that arrived on
+	// another network's clients, e.g. when running several in one process
+	if c.Delegate != n {
+		return nil
+	}
+
 	switch msg := msg.(type) {
 	case *PingMessage:
+		if !VerifySessionID(msg.Message.SenderID, msg.PublicKey, msg.IDSalt) {
+			log.Println("Ignoring ping from", msg.Message.SenderID, "with the wrong key")
+			return nil
+		}
+
 		c.RLock()
 		clientID := c.ID
 		c.RUnlock()
@@ -22,20 +38,43 @@ func (n *Network) processMessage(client, msg interface{}) interface{} {
 			}
 		}
 
-		c.Lock()
-		c.ID = msg.Message.SenderID
-		c.ClientRoutingInfo = ClientRoutingInfo{
+		// The round trip time isn't known until heartbeats measure it
+		info := ClientRoutingInfo{
 			Distributor: msg.Distributor,
-			Distance:    1,
+			Distance:    defaultLinkCost,
+			PublicKey:   msg.PublicKey,
+			IDSalt:      msg.IDSalt,
 		}
+
+		c.Lock()
+		c.ID = msg.Message.SenderID
+		c.ClientRoutingInfo = info
+		c.sessionKey = nil
 		c.Neighbor = true
 		c.Unlock()
 
 		n.clients.Store(msg.Message.SenderID, c)
 
-		return NewPongMessage(n.distributor)
+		if n.routes.SetLink(msg.Message.SenderID, info.Distance, info) {
+			n.applyRoutes()
+		}
+
+		// Agree on the newest codec both sides know. The pong is already
+		// sent with it, which is fine since either codec can be decoded.
+		codec := int(math.Min(float64(msg.Codec), float64(n.GetCodec())))
+		c.codec.SetVersion(codec)
+
+		return NewPongMessage(n.distributor, codec, n.identity.PublicKey, n.salt)
 	case *RoutingMessage:
 		n.UpdateRoutes(c, msg.Distances)
+	case *PunchRequestMessage:
+		return n.rendezvous(msg)
+	case *PunchMessage:
+		go n.punch(msg)
+	case *AckMessage:
+		if pc, ok := n.channels.Load(msg.SenderID); ok {
+			pc.(*peerChannels).ack(msg)
+		}
 	}
 
 	return nil
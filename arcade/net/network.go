@@ -2,7 +2,7 @@ package net
 
 import (
 	"arcade/arcade/message"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -12,9 +12,6 @@ import (
 	"reflect"
 	"sync"
 	"time"
-
-	"github.com/google/uuid"
-	"github.com/xtaci/kcp-go/v5"
 )
 
 type Network struct {
@@ -22,39 +19,75 @@ type Network struct {
 
 	Delegate NetworkDelegate
 
+	transport   Transport
 	clients     sync.Map
 	distributor bool
 	dropRate    float64
+	codec       int
+	identity    *Identity
+	salt        string
 	me          string
 	port        int
 
+	routes *RoutingTable
+
+	// Clients we're punching through to
+	punching sync.Map
+
+	// State of the channels between us and each client, by client ID
+	channels sync.Map
+
 	pendingMessagesMux sync.RWMutex
 	pendingMessages    map[string]chan interface{}
+
+	// Handlers for the messages sent to us, by type, and the replies they
+	// gave to recent requests
+	handlersMux sync.RWMutex
+	handlers    map[reflect.Type]HandlerFunc
+	replies     *replyCache
 }
 
 const maxTimeoutRetries = 1
 const timeoutInterval = time.Second
 const sendAndReceiveTimeout = 500 * time.Millisecond
 
-func NewNetwork(me string, port int, distributor bool) *Network {
+// NewNetwork creates a network for the given identity. Its ID is derived from
+// the identity and salt, see Identity.SessionID.
+func NewNetwork(identity *Identity, salt string, port int, distributor bool, transport Transport) *Network {
 	message.Register(PingMessage{Message: message.Message{Type: "ping"}})
 	message.Register(PongMessage{Message: message.Message{Type: "pong"}})
 	message.Register(RoutingMessage{Message: message.Message{Type: "routing"}})
+	message.Register(SealedMessage{Message: message.Message{Type: "sealed"}})
+	message.Register(PunchRequestMessage{Message: message.Message{Type: "punch_request"}})
+	message.Register(PunchMessage{Message: message.Message{Type: "punch"}})
+	message.Register(AckMessage{Message: message.Message{Type: "ack"}})
+	message.Register(RejectMessage{Message: message.Message{Type: "reject"}})
 
 	n := &Network{
 		clients:         sync.Map{},
-		me:              me,
+		identity:        identity,
+		salt:            salt,
+		me:              identity.SessionID(salt),
 		port:            port,
 		distributor:     distributor,
+		transport:       transport,
+		codec:           message.CodecLatest,
 		pendingMessages: make(map[string]chan interface{}),
+		handlers:        make(map[reflect.Type]HandlerFunc),
+		replies:         newReplyCache(),
 	}
 
+	n.routes = NewRoutingTable(n.me)
+
 	message.AddListener(message.Listener{
 		Distributor: true,
 		ServerID:    n.me,
 		Handle:      n.processMessage,
 	})
 
+	go n.advertiseRoutes()
+	go n.retransmit()
+
 	return n
 }
 
@@ -63,6 +96,12 @@ func (n *Network) Addr() string {
 	return fmt.Sprintf("%s:%d", ip, n.port)
 }
 
+// Listen starts accepting connections from other clients on the network's
+// transport.
+func (n *Network) Listen(addr string) (net.Listener, error) {
+	return n.transport.Listen(addr)
+}
+
 func (n *Network) Connect(addr, id string, conn net.Conn) (*Client, error) {
 	var c *Client
 
@@ -124,7 +163,7 @@ func (n *Network) Connect(addr, id string, conn net.Conn) (*Client, error) {
 
 	if conn == nil {
 		var err error
-		conn, err = kcp.Dial(c.Addr)
+		conn, err = n.transport.Dial(c.Addr)
 
 		if err != nil {
 			return nil, err
@@ -140,7 +179,7 @@ func (n *Network) Connect(addr, id string, conn net.Conn) (*Client, error) {
 func (n *Network) ConnectClient(c *Client, retry bool) error {
 	// Send ping and wait for reply
 	start := time.Now()
-	res, err := n.SendAndReceive(c, NewPingMessage(n.distributor))
+	res, err := n.SendAndReceive(c, NewPingMessage(n.distributor, n.GetCodec(), n.identity.PublicKey, n.salt))
 	end := time.Now()
 
 	p, ok := res.(*PongMessage)
@@ -153,8 +192,13 @@ func (n *Network) ConnectClient(c *Client, retry bool) error {
 
 			return n.ConnectClient(c, retry)
 		}
+		c.Unlock()
+
+		// disconnect takes the lock itself
 		c.disconnect()
 		n.clients.Delete(c.ID)
+
+		c.Lock()
 		c.State = TimedOut
 		c.Unlock()
 
@@ -163,6 +207,13 @@ func (n *Network) ConnectClient(c *Client, retry bool) error {
 
 	clientID := p.SenderID
 
+	if !VerifySessionID(clientID, p.PublicKey, p.IDSalt) {
+		c.disconnect()
+		n.clients.Delete(c.ID)
+
+		return errors.New("client's ID doesn't match its key")
+	}
+
 	if value, ok := n.clients.Load(clientID); ok {
 		existingClient := value.(*Client)
 
@@ -172,12 +223,20 @@ func (n *Network) ConnectClient(c *Client, retry bool) error {
 		}
 	}
 
-	c.Lock()
-	c.ID = clientID
-	c.ClientRoutingInfo = ClientRoutingInfo{
-		Distance:    float64(end.Sub(start).Milliseconds()),
+	// Older clients don't send a codec, so this falls back to JSON
+	c.codec.SetVersion(int(math.Min(float64(p.Codec), float64(n.GetCodec()))))
+
+	info := ClientRoutingInfo{
+		Distance:    math.Max(float64(end.Sub(start).Milliseconds()), minLinkCost),
 		Distributor: p.Distributor,
+		PublicKey:   p.PublicKey,
+		IDSalt:      p.IDSalt,
 	}
+
+	c.Lock()
+	c.ID = clientID
+	c.ClientRoutingInfo = info
+	c.sessionKey = nil
 	c.Neighbor = true
 	c.State = Connected
 	c.TimeoutRetries = 0
@@ -189,6 +248,8 @@ func (n *Network) ConnectClient(c *Client, retry bool) error {
 		n.Delegate.ClientConnected(clientID)
 	}
 
+	n.routes.SetLink(clientID, info.Distance, info)
+	n.applyRoutes()
 	go n.PropagateRoutes()
 
 	return nil
@@ -243,7 +304,15 @@ func (n *Network) SendRaw(client *Client, msg interface{}) bool {
 	return true
 }
 
+// Send sends msg to client unreliably. See SendOn.
 func (n *Network) Send(client *Client, msg interface{}) bool {
+	return n.SendOn(client, Unreliable, msg)
+}
+
+// SendOn sends msg to client with the delivery guarantees of channel. Reliable
+// messages are resent until they're acknowledged, so it returns as soon as
+// they're sealed, and false only if they couldn't be.
+func (n *Network) SendOn(client *Client, channel Channel, msg interface{}) bool {
 	client.RLock()
 	if client.State == Disconnected || client.State == TimedOut {
 		client.RUnlock()
@@ -251,51 +320,44 @@ func (n *Network) Send(client *Client, msg interface{}) bool {
 	}
 
 	// Set sender and recipient IDs
+	clientID := client.ID
 	reflect.ValueOf(msg).Elem().FieldByName("Message").FieldByName("SenderID").Set(reflect.ValueOf(n.me))
-	reflect.ValueOf(msg).Elem().FieldByName("Message").FieldByName("RecipientID").Set(reflect.ValueOf(client.ID))
+	reflect.ValueOf(msg).Elem().FieldByName("Message").FieldByName("RecipientID").Set(reflect.ValueOf(clientID))
 	client.RUnlock()
 
-	return n.SendRaw(client, msg)
-}
-
-func (n *Network) SendAndReceive(client *Client, msg interface{}) (interface{}, error) {
-
-	// log.Println("in SendAndReceive: ", msg)
-	// Set message ID
-	messageID := uuid.NewString()
-	reflect.ValueOf(msg).Elem().FieldByName("Message").FieldByName("MessageID").Set(reflect.ValueOf(messageID))
-
-	// Set up receive chan
-	recvCh := make(chan interface{}, 1)
+	// The handshake is sent in the clear, and on no channel, since it's how
+	// clients learn each other's keys
+	if isHandshake(msg) {
+		return n.SendRaw(client, msg)
+	}
 
-	n.pendingMessagesMux.Lock()
-	n.pendingMessages[messageID] = recvCh
-	n.pendingMessagesMux.Unlock()
+	h := n.channelsTo(clientID).number(channel)
 
-	// Send message
-	ok := n.Send(client, msg)
+	// Everything else is encrypted for the recipient
+	sealed, err := n.seal(client, msg, h)
 
-	if !ok {
-		return nil, errors.New("send failed")
+	if err != nil {
+		log.Println("Send failed:", err)
+		return false
 	}
 
-	time.AfterFunc(sendAndReceiveTimeout, func() {
-		n.pendingMessagesMux.Lock()
-		if _, ok := n.pendingMessages[messageID]; ok {
-			delete(n.pendingMessages, messageID)
-			close(recvCh)
-		}
-		n.pendingMessagesMux.Unlock()
-	})
+	if channel != Unreliable {
+		n.channelsTo(clientID).track(h, sealed, time.Now())
+		n.SendRaw(client, sealed)
+		return true
+	}
 
-	// Wait for response
-	recvMsg, ok := <-recvCh
+	return n.SendRaw(client, sealed)
+}
 
-	if !ok {
-		return nil, fmt.Errorf("timed out")
-	}
+// SendAndReceive sends msg to client reliably, and waits for the reply, which
+// is sent back on the same channel. It gives up if there's no reply within
+// sendAndReceiveTimeout. See Call for a typed version with a context.
+func (n *Network) SendAndReceive(client *Client, msg interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sendAndReceiveTimeout)
+	defer cancel()
 
-	return recvMsg, nil
+	return n.call(ctx, client, msg.(message.Envelope))
 }
 
 func (n *Network) SignalReceived(messageID string, resp interface{}) {
@@ -331,91 +393,178 @@ func (n *Network) SendNeighbors(msg interface{}) {
 	})
 }
 
-func (n *Network) getDistanceVector() map[string]ClientRoutingInfo {
-	distances := make(map[string]ClientRoutingInfo)
-
-	n.clients.Range(func(key, value any) bool {
-		clientID := key.(string)
+// PropagateRoutes sends every neighbor our routes.
+func (n *Network) PropagateRoutes() {
+	n.clients.Range(func(_, value any) bool {
 		client := value.(*Client)
-		distances[clientID] = client.ClientRoutingInfo
+		client.RLock()
+
+		if !client.Neighbor || client.NextHop != "" || client.State != Connected {
+			client.RUnlock()
+			return true
+		}
+
+		clientID := client.ID
+		client.RUnlock()
+
+		n.Send(client, NewRoutingMessage(n.routes.Advertisement(clientID)))
 		return true
 	})
+}
+
+// UpdateRoutes takes in the routes advertised by a neighbor.
+func (n *Network) UpdateRoutes(from *Client, distances map[string]ClientRoutingInfo) {
+	from.RLock()
+	fromID := from.ID
+	from.RUnlock()
+
+	// Don't trust a route to a client that isn't who it claims to be
+	for clientID, info := range distances {
+		if !VerifySessionID(clientID, info.PublicKey, info.IDSalt) {
+			log.Println("Ignoring route to", clientID, "with the wrong key")
+			delete(distances, clientID)
+		}
+	}
 
-	return distances
+	if n.routes.Update(fromID, distances, time.Now()) {
+		n.applyRoutes()
+		go n.PropagateRoutes()
+	}
 }
 
-func (n *Network) PropagateRoutes() {
-	n.RLock()
-	distances := n.getDistanceVector()
-	n.RUnlock()
+// ReportRTT updates the cost of the link to a neighbor with a round trip time
+// measured by the server, e.g. from heartbeats.
+func (n *Network) ReportRTT(clientID string, rtt time.Duration) {
+	if rtt < 0 {
+		return
+	}
 
-	n.SendNeighbors(NewRoutingMessage(distances))
+	if n.routes.SetLinkCost(clientID, float64(rtt.Milliseconds())) {
+		n.applyRoutes()
+		go n.PropagateRoutes()
+	}
 }
 
-func (n *Network) UpdateRoutes(from *Client, routingTable map[string]ClientRoutingInfo) {
-	n.Lock()
-	defer n.Unlock()
+// GetRoutes returns the best route to every reachable client.
+func (n *Network) GetRoutes() map[string]Route {
+	return n.routes.Routes()
+}
+
+// applyRoutes brings the clients we reach through neighbors in line with the
+// routing table, adding newly reachable clients and dropping unreachable ones.
+func (n *Network) applyRoutes() {
+	routes := n.routes.Routes()
+	withdrawn := make([]string, 0)
 
-	changes := 0
+	n.Lock()
 
 	n.clients.Range(func(key, value any) bool {
 		clientID := key.(string)
 		client := value.(*Client)
 
-		delete(routingTable, clientID)
+		client.Lock()
+		defer client.Unlock()
 
-		if clientID == from.ID {
+		// Neighbors are always reached through their own connection
+		if client.NextHop == "" {
 			return true
 		}
 
-		// Bellman-Ford equation: Update least-cost paths to all other clients
-		if c, ok := routingTable[clientID]; ok && c.Distance < client.Distance && client.NextHop != "" {
-			log.Println("New path to", clientID, "cost=", c.Distance)
-
-			client.Lock()
-			client.Distance = c.Distance
-
-			from.RLock()
-			client.NextHop = from.ID
-			client.conn = from.conn
-			from.RUnlock()
-
-			client.Unlock()
-			changes++
+		if route, ok := routes[clientID]; !ok {
+			withdrawn = append(withdrawn, clientID)
+		} else if route.NextHop != "" {
+			client.NextHop = route.NextHop
+			client.ClientRoutingInfo = route.ClientRoutingInfo
 		}
 
 		return true
 	})
 
-	for clientID, c := range routingTable {
-		if clientID == n.me {
+	for clientID, route := range routes {
+		if route.NextHop == "" {
 			continue
 		}
 
-		n.clients.Store(clientID, &Client{
-			ID:       clientID,
-			Delegate: n,
-			NextHop:  from.ID,
-			ClientRoutingInfo: ClientRoutingInfo{
-				Distance:    c.Distance + 1,
-				Distributor: c.Distributor,
-			},
-			State: Connected,
+		n.clients.LoadOrStore(clientID, &Client{
+			ID:                clientID,
+			Delegate:          n,
+			NextHop:           route.NextHop,
+			ClientRoutingInfo: route.ClientRoutingInfo,
+			State:             Connected,
 		})
+	}
 
-		changes++
+	n.Unlock()
+
+	for _, clientID := range withdrawn {
+		log.Println("Lost route to", clientID)
+		n.ClientDisconnected(clientID)
 	}
+}
 
-	if changes == 0 {
-		return
+// advertiseRoutes periodically expires stale routes and sends our routes to
+// every neighbor, so they can tell when we've gone away.
+func (n *Network) advertiseRoutes() {
+	for {
+		time.Sleep(routeAdvertiseInterval)
+
+		now := time.Now()
+
+		if n.routes.Expire(now) {
+			n.applyRoutes()
+		}
+
+		n.PropagateRoutes()
+		n.dropSilentNeighbors(now)
+		n.replies.expire(now)
 	}
+}
 
-	go n.PropagateRoutes()
+// dropSilentNeighbors disconnects neighbors we haven't heard from in
+// routeTimeout. Every neighbor advertises its routes more often than that, so
+// a silent one has gone away without disconnecting, e.g. because its machine
+// went down, and its connection would otherwise stay open forever.
+func (n *Network) dropSilentNeighbors(now time.Time) {
+	silent := make([]*Client, 0)
+
+	n.clients.Range(func(key, value any) bool {
+		client := value.(*Client)
+
+		client.RLock()
+		connected := client.NextHop == "" && client.State == Connected
+		client.RUnlock()
+
+		if last := client.LastReceived(); connected && !last.IsZero() && now.Sub(last) > routeTimeout {
+			silent = append(silent, client)
+		}
+
+		return true
+	})
+
+	for _, client := range silent {
+		log.Println("Haven't heard from", client.ID, "in", routeTimeout, "- disconnecting")
+		client.disconnect()
+	}
 }
 
 func (n *Network) handleMessages(c *Client) {
 	for {
-		data, ok := <-c.recvCh
+		var data []byte
+
+		select {
+		case data = <-c.recvCh:
+		case <-c.closeCh:
+			return
+		}
+
+		// Decode before dropping, since the codec keeps track of the peer IDs
+		// it has seen and needs to see every message
+		msg, err := c.codec.Decode(data)
+
+		if err != nil {
+			log.Println("Dropping message:", err)
+			continue
+		}
 
 		// // Randomly drop packets if debugging
 		dropRate := n.GetDropRate()
@@ -424,31 +573,63 @@ func (n *Network) handleMessages(c *Client) {
 			continue
 		}
 
-		if !ok {
-			break
-		}
+		header := reflect.ValueOf(msg).Elem().FieldByName("Message").Interface().(message.Message)
 
-		if !ok {
-			break
-		}
+		// Open messages sealed for us. Sealed messages for other clients are
+		// passed on as they are, and anything else must be part of the
+		// handshake, since it can't be trusted to come from its sender.
+		// Messages sealed for us may have to wait for earlier ones on their
+		// channel, and may let later ones through.
+		channel := Unreliable
+		msgs := []interface{}{msg}
+		opened := false
 
-		// Get sender ID
-		res := struct {
-			SenderID string
-		}{}
+		if sealed, ok := msg.(*SealedMessage); ok && header.RecipientID == n.me {
+			msg, sender, h, err := n.open(sealed)
 
-		if err := json.Unmarshal(data, &res); err != nil {
-			break
+			if err != nil {
+				log.Println("Dropping message:", err)
+				continue
+			}
+
+			channel = h.Channel
+			msgs = n.receive(sender, h, msg)
+			opened = true
+		} else if !ok && !isHandshake(msg) {
+			log.Println("Dropping unsealed", header.Type, "message from", header.SenderID)
+			continue
 		}
 
-		sender, ok := n.GetClient(res.SenderID)
+		for _, msg := range msgs {
+			var replies []interface{}
 
-		if !ok {
-			sender = c
-		}
+			// Messages sent to us may be replies we're waiting for
+			if h := msg.(message.Envelope).Header(); h.RecipientID == n.me {
+				n.SignalReceived(h.MessageID, msg)
+			}
+
+			// and go to their handlers if they were sealed. Anything else,
+			// like the handshake or messages we're passing on, goes to the
+			// listeners.
+			if opened {
+				replies = n.handle(c, msg)
+			} else {
+				replies = message.Notify(c, msg)
+			}
 
-		for _, reply := range message.Notify(c, data) {
-			n.Send(sender, reply)
+			// Get sender ID. Look it up after handling the message, in case
+			// the sender just connected directly instead of through another
+			// client.
+			sender, ok := n.GetClient(header.SenderID)
+
+			if !ok {
+				sender = c
+			}
+
+			// Replies get the same guarantees as what they're replying to
+			for _, reply := range replies {
+				n.SendOn(sender, channel, reply)
+			}
 		}
 	}
 }
@@ -469,6 +650,23 @@ func (n *Network) SetDropRate(rate float64) {
 	n.dropRate = rate
 }
 
+// GetCodec returns the newest wire codec this network offers to clients.
+func (n *Network) GetCodec() int {
+	n.RLock()
+	defer n.RUnlock()
+
+	return n.codec
+}
+
+// SetCodec changes the codec offered to clients that connect from now on,
+// e.g. to message.CodecJSON to make traffic readable when debugging.
+func (n *Network) SetCodec(codec int) {
+	n.Lock()
+	defer n.Unlock()
+
+	n.codec = codec
+}
+
 //
 // ClientDelegate methods
 //
@@ -476,6 +674,21 @@ func (n *Network) SetDropRate(rate float64) {
 func (n *Network) ClientDisconnected(clientID string) {
 	n.clients.Delete(clientID)
 
+	if n.routes.RemoveLink(clientID) {
+		go n.PropagateRoutes()
+	}
+
+	// The client may still be reachable through another neighbor, e.g. when a
+	// punched connection drops, in which case it hasn't really gone anywhere
+	n.applyRoutes()
+
+	if _, ok := n.GetClient(clientID); ok {
+		return
+	}
+
+	// Start numbering over if the client comes back
+	n.channelsTo(clientID).resetSending()
+
 	if n.Delegate != nil {
 		n.Delegate.ClientDisconnected(clientID)
 	}
@@ -9,12 +9,22 @@ import (
 type PingMessage struct {
 	message.Message
 	Distributor bool
+
+	// Newest wire codec the sender can decode
+	Codec int
+
+	// The sender's public key, and the salt its ID was derived from
+	PublicKey []byte
+	IDSalt    string
 }
 
-func NewPingMessage(distributor bool) *PingMessage {
+func NewPingMessage(distributor bool, codec int, publicKey []byte, salt string) *PingMessage {
 	return &PingMessage{
 		Message:     message.Message{Type: "ping"},
 		Distributor: distributor,
+		Codec:       codec,
+		PublicKey:   publicKey,
+		IDSalt:      salt,
 	}
 }
 
@@ -10,12 +10,22 @@ type PongMessage struct {
 	message.Message
 
 	Distributor bool
+
+	// Newest wire codec the sender can decode
+	Codec int
+
+	// The sender's public key, and the salt its ID was derived from
+	PublicKey []byte
+	IDSalt    string
 }
 
-func NewPongMessage(distributor bool) *PongMessage {
+func NewPongMessage(distributor bool, codec int, publicKey []byte, salt string) *PongMessage {
 	return &PongMessage{
 		Message:     message.Message{Type: "pong"},
 		Distributor: distributor,
+		Codec:       codec,
+		PublicKey:   publicKey,
+		IDSalt:      salt,
 	}
 }
 
@@ -0,0 +1,221 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// How long after the distributor sends out a punch both clients should start
+// punching. Each client's share is cut by how long the message takes to reach
+// it, so that they start at about the same time.
+const punchDelay = 500 * time.Millisecond
+
+// PunchRequestMessage asks a distributor to help connect us directly to Peer,
+// which we're currently reaching through it.
+type PunchRequestMessage struct {
+	message.Message
+
+	Peer string
+}
+
+func NewPunchRequestMessage(peer string) *PunchRequestMessage {
+	return &PunchRequestMessage{
+		Message: message.Message{Type: "punch_request"},
+		Peer:    peer,
+	}
+}
+
+func (m PunchRequestMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m PunchRequestMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// PunchMessage is sent by a distributor to both clients it's connecting. It
+// has the other client's public address as the distributor sees it, and the
+// KCP conversation both should use.
+type PunchMessage struct {
+	message.Message
+
+	Peer  string
+	Addr  string
+	Conv  uint32
+	Delay time.Duration
+}
+
+func NewPunchMessage(peer, addr string, conv uint32, delay time.Duration) *PunchMessage {
+	return &PunchMessage{
+		Message: message.Message{Type: "punch"},
+		Peer:    peer,
+		Addr:    addr,
+		Conv:    conv,
+		Delay:   delay,
+	}
+}
+
+func (m PunchMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m PunchMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// PunchThrough tries to upgrade a client we reach through a distributor to a
+// direct connection. Messages go through the distributor until then, and keep
+// doing so if punching fails.
+func (n *Network) PunchThrough(clientID string) {
+	if _, ok := n.transport.(Puncher); !ok {
+		return
+	}
+
+	// Both clients usually try at once, so leave it to the one with the
+	// lower ID
+	if clientID < n.me {
+		return
+	}
+
+	if _, punching := n.punching.Load(clientID); punching {
+		return
+	}
+
+	client, ok := n.GetClient(clientID)
+
+	if !ok {
+		return
+	}
+
+	client.RLock()
+	nextHop := client.NextHop
+	client.RUnlock()
+
+	if nextHop == "" {
+		return
+	}
+
+	distributor, ok := n.GetClient(nextHop)
+
+	if !ok {
+		return
+	}
+
+	distributor.RLock()
+	isDistributor := distributor.Distributor
+	distributor.RUnlock()
+
+	if isDistributor {
+		n.Send(distributor, NewPunchRequestMessage(clientID))
+	}
+}
+
+// rendezvous tells the client asking to punch and its peer each other's
+// address, if we're a distributor neighboring both.
+func (n *Network) rendezvous(msg *PunchRequestMessage) interface{} {
+	if !n.distributor {
+		return nil
+	}
+
+	requester, ok := n.GetClient(msg.SenderID)
+
+	if !ok {
+		return nil
+	}
+
+	peer, ok := n.GetClient(msg.Peer)
+
+	if !ok {
+		return nil
+	}
+
+	requester.RLock()
+	requesterID, requesterAddr := requester.ID, requester.Addr
+	requesterDelay := punchDelay - time.Duration(requester.Distance/2)*time.Millisecond
+	requesterDirect := requester.NextHop == ""
+	requester.RUnlock()
+
+	peer.RLock()
+	peerAddr := peer.Addr
+	peerDelay := punchDelay - time.Duration(peer.Distance/2)*time.Millisecond
+	peerDirect := peer.NextHop == ""
+	peer.RUnlock()
+
+	// The addresses we see are only worth anything for our own connections
+	if !requesterDirect || !peerDirect {
+		return nil
+	}
+
+	conv := rand.Uint32()
+
+	n.Send(peer, NewPunchMessage(requesterID, requesterAddr, conv, peerDelay))
+	return NewPunchMessage(msg.Peer, peerAddr, conv, requesterDelay)
+}
+
+// punch connects to a peer at the address a distributor gave us, while the
+// peer does the same. If that fails, the peer is still reachable through the
+// distributor.
+func (n *Network) punch(msg *PunchMessage) {
+	puncher, ok := n.transport.(Puncher)
+
+	if !ok {
+		return
+	}
+
+	from, ok := n.GetClient(msg.SenderID)
+
+	if !ok {
+		return
+	}
+
+	from.RLock()
+	trusted := from.Distributor && from.NextHop == ""
+	from.RUnlock()
+
+	// Only distributors we're connected to get to tell us where to connect
+	if !trusted {
+		return
+	}
+
+	if _, punching := n.punching.LoadOrStore(msg.Peer, true); punching {
+		return
+	}
+
+	defer n.punching.Delete(msg.Peer)
+
+	// Set up the connection before waiting, so it's ready for the peer's
+	// packets if they arrive early. KCP doesn't send anything until it's
+	// written to.
+	conn, err := puncher.Punch(msg.Addr, msg.Conv)
+
+	if err != nil {
+		log.Println("Couldn't punch through to", msg.Peer+":", err)
+		return
+	}
+
+	if msg.Delay > 0 {
+		time.Sleep(msg.Delay)
+	}
+
+	c := &Client{
+		Delegate: n,
+		Addr:     msg.Addr,
+		ID:       msg.Peer,
+		Neighbor: true,
+		State:    Connecting,
+	}
+
+	c.start(conn)
+	go n.handleMessages(c)
+
+	if err := n.ConnectClient(c, true); err != nil {
+		log.Println("Couldn't punch through to", msg.Peer+", staying on the relay:", err)
+
+		// Giving up drops the peer, so bring back the route through the
+		// distributor
+		n.applyRoutes()
+	}
+}
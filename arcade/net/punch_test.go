@@ -0,0 +1,167 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKCPTransportPunches(t *testing.T) {
+	a, b := NewKCPTransport(), NewKCPTransport()
+
+	for _, transport := range []*KCPTransport{a, b} {
+		listener, err := transport.Listen("127.0.0.1:0")
+
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+
+		defer listener.Close()
+	}
+
+	// both sides dial each other with the same conversation, and nobody
+	// accepts anything
+	aConn, err := a.Punch(b.mux.conn.LocalAddr().String(), 42)
+
+	if err != nil {
+		t.Fatalf("punch a: %v", err)
+	}
+
+	defer aConn.Close()
+
+	bConn, err := b.Punch(a.mux.conn.LocalAddr().String(), 42)
+
+	if err != nil {
+		t.Fatalf("punch b: %v", err)
+	}
+
+	defer bConn.Close()
+
+	aConn.Write([]byte("hello"))
+
+	buf := make([]byte, 16)
+	bConn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := bConn.Read(buf)
+
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected hello, got %q (%v)", buf[:n], err)
+	}
+
+	if _, err := a.Punch(b.mux.conn.LocalAddr().String(), 43); err == nil {
+		t.Fatalf("expected a second punch to the same address to fail")
+	}
+}
+
+func TestKCPTransportDialsFromListeningAddress(t *testing.T) {
+	server, client := NewKCPTransport(), NewKCPTransport()
+
+	serverListener, err := server.Listen("127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	defer serverListener.Close()
+
+	clientListener, err := client.Listen("127.0.0.1:0")
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	defer clientListener.Close()
+
+	conn, err := client.Dial(serverListener.Addr().String())
+
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	defer conn.Close()
+
+	// KCP only shows the listener a connection once something is sent
+	conn.Write([]byte("hello"))
+
+	accepted, err := serverListener.Accept()
+
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+
+	defer accepted.Close()
+
+	if accepted.RemoteAddr().String() != clientListener.Addr().String() {
+		t.Fatalf("expected connection from %s, got %s", clientListener.Addr(), accepted.RemoteAddr())
+	}
+}
+
+func TestNetworksPunchThroughDistributor(t *testing.T) {
+	a, _ := listenTestNetwork(t, NewKCPTransport(), "127.0.0.1:0", false)
+	d, dAddr := listenTestNetwork(t, NewKCPTransport(), "127.0.0.1:0", true)
+	b, _ := listenTestNetwork(t, NewKCPTransport(), "127.0.0.1:0", false)
+
+	if _, err := a.Connect(dAddr, "", nil); err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+
+	if _, err := b.Connect(dAddr, "", nil); err != nil {
+		t.Fatalf("connect b: %v", err)
+	}
+
+	waitFor := func(what string, done func() bool) {
+		for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+			if done() {
+				return
+			}
+		}
+
+		t.Fatalf("timed out waiting for %s", what)
+	}
+
+	nextHop := func(from, to *Network) (string, bool) {
+		client, ok := from.GetClient(to.me)
+
+		if !ok {
+			return "", false
+		}
+
+		client.RLock()
+		defer client.RUnlock()
+
+		return client.NextHop, client.State == Connected
+	}
+
+	waitFor("a and b to reach each other through d", func() bool {
+		aHop, _ := nextHop(a, b)
+		bHop, _ := nextHop(b, a)
+		return aHop == d.me && bHop == d.me
+	})
+
+	// only the client with the lower ID asks
+	a.PunchThrough(b.me)
+	b.PunchThrough(a.me)
+
+	waitFor("a and b to connect directly", func() bool {
+		aHop, aConnected := nextHop(a, b)
+		bHop, bConnected := nextHop(b, a)
+		return aHop == "" && aConnected && bHop == "" && bConnected
+	})
+
+	client, _ := a.GetClient(b.me)
+	res, err := a.SendAndReceive(client, newTestMessage("hello"))
+
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if reply := res.(*testMessage); reply.Text != "re: hello" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+
+	// when the direct connection drops, messages go through d again
+	a.Disconnect(b.me)
+
+	waitFor("a to route to b through d again", func() bool {
+		hop, connected := nextHop(a, b)
+		return hop == d.me && connected
+	})
+}
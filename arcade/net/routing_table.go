@@ -0,0 +1,238 @@
+package net
+
+import (
+	"sync"
+	"time"
+)
+
+// Routes are measured in milliseconds of round trip time. Anything this far
+// away is unreachable, which is also how a client tells a neighbor not to
+// route through it.
+const routeInfinity = 60000.0
+
+// Links are never free, so that zero-cost loops can't form between clients
+// on the same machine.
+const minLinkCost = 1.0
+
+// Cost of a new link until its round trip time has been measured.
+const defaultLinkCost = 100.0
+
+// How often routes are advertised to neighbors, and how long a neighbor's
+// advertisement is trusted for.
+const routeAdvertiseInterval = 2 * time.Second
+const routeTimeout = 3 * routeAdvertiseInterval
+
+// Route is the best known way to reach a client.
+type Route struct {
+	// The neighbor to send messages through, or empty if the client is a
+	// neighbor itself.
+	NextHop string
+
+	// Distance is the total round trip time along the route.
+	ClientRoutingInfo
+}
+
+type advertisement struct {
+	distances map[string]ClientRoutingInfo
+	received  time.Time
+}
+
+// RoutingTable is a distance-vector routing table. It keeps the cost of the
+// links to each neighbor and the latest routes each neighbor advertised, and
+// picks the cheapest route to every client from those.
+//
+// Routes through a neighbor disappear as soon as the neighbor disconnects,
+// stops advertising them, or hasn't been heard from in routeTimeout. To avoid
+// counting to infinity, routes are advertised back to the neighbor they go
+// through as unreachable (split horizon with poison reverse).
+type RoutingTable struct {
+	sync.Mutex
+
+	me      string
+	links   map[string]ClientRoutingInfo
+	adverts map[string]*advertisement
+	routes  map[string]Route
+}
+
+func NewRoutingTable(me string) *RoutingTable {
+	return &RoutingTable{
+		me:      me,
+		links:   make(map[string]ClientRoutingInfo),
+		adverts: make(map[string]*advertisement),
+		routes:  make(map[string]Route),
+	}
+}
+
+// SetLink adds a link to a neighbor, or updates its cost. Returns whether
+// any route changed which neighbor it goes through.
+func (t *RoutingTable) SetLink(neighbor string, cost float64, info ClientRoutingInfo) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if cost < minLinkCost {
+		cost = minLinkCost
+	}
+
+	info.Distance = cost
+	t.links[neighbor] = info
+
+	return t.recompute()
+}
+
+// SetLinkCost updates the cost of an existing link, e.g. from a new round trip
+// time measurement.
+func (t *RoutingTable) SetLinkCost(neighbor string, cost float64) bool {
+	t.Lock()
+	info, ok := t.links[neighbor]
+	t.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	return t.SetLink(neighbor, cost, info)
+}
+
+// RemoveLink removes a neighbor and every route through it.
+func (t *RoutingTable) RemoveLink(neighbor string) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.links[neighbor]; !ok {
+		return false
+	}
+
+	delete(t.links, neighbor)
+	delete(t.adverts, neighbor)
+
+	return t.recompute()
+}
+
+// Update replaces the routes advertised by a neighbor. Clients missing from
+// distances can no longer be reached through it.
+func (t *RoutingTable) Update(neighbor string, distances map[string]ClientRoutingInfo, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.links[neighbor]; !ok {
+		return false
+	}
+
+	t.adverts[neighbor] = &advertisement{
+		distances: distances,
+		received:  now,
+	}
+
+	return t.recompute()
+}
+
+// Expire forgets advertisements from neighbors that have gone quiet.
+func (t *RoutingTable) Expire(now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	expired := false
+
+	for neighbor, advert := range t.adverts {
+		if now.Sub(advert.received) > routeTimeout {
+			delete(t.adverts, neighbor)
+			expired = true
+		}
+	}
+
+	return expired && t.recompute()
+}
+
+// Route returns the best route to a client.
+func (t *RoutingTable) Route(id string) (Route, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	route, ok := t.routes[id]
+	return route, ok
+}
+
+// Routes returns a copy of the best route to every reachable client.
+func (t *RoutingTable) Routes() map[string]Route {
+	t.Lock()
+	defer t.Unlock()
+
+	routes := make(map[string]Route, len(t.routes))
+
+	for id, route := range t.routes {
+		routes[id] = route
+	}
+
+	return routes
+}
+
+// Advertisement returns the routes to send to a neighbor.
+func (t *RoutingTable) Advertisement(neighbor string) map[string]ClientRoutingInfo {
+	t.Lock()
+	defer t.Unlock()
+
+	distances := make(map[string]ClientRoutingInfo, len(t.routes))
+
+	for id, route := range t.routes {
+		if id == neighbor {
+			continue
+		}
+
+		info := route.ClientRoutingInfo
+
+		// Poison reverse: the neighbor mustn't route back through us
+		if route.NextHop == neighbor {
+			info.Distance = routeInfinity
+		}
+
+		distances[id] = info
+	}
+
+	return distances
+}
+
+// recompute picks the best route to every client, and returns whether any
+// client was added, removed or moved to a different next hop.
+func (t *RoutingTable) recompute() bool {
+	routes := make(map[string]Route)
+
+	for neighbor, link := range t.links {
+		routes[neighbor] = Route{ClientRoutingInfo: link}
+	}
+
+	for neighbor, advert := range t.adverts {
+		link, ok := t.links[neighbor]
+
+		if !ok {
+			continue
+		}
+
+		for id, info := range advert.distances {
+			distance := link.Distance + info.Distance
+
+			if id == t.me || info.Distance >= routeInfinity || distance >= routeInfinity {
+				continue
+			}
+
+			// Ties go to direct links, then to the first neighbor by ID, so
+			// the choice doesn't depend on map order
+			if best, ok := routes[id]; ok && (best.Distance < distance || best.Distance == distance && best.NextHop <= neighbor) {
+				continue
+			}
+
+			info.Distance = distance
+			routes[id] = Route{NextHop: neighbor, ClientRoutingInfo: info}
+		}
+	}
+
+	changed := len(routes) != len(t.routes)
+
+	for id, route := range routes {
+		if old, ok := t.routes[id]; !ok || old.NextHop != route.NextHop {
+			changed = true
+		}
+	}
+
+	t.routes = routes
+	return changed
+}
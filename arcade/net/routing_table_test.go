@@ -0,0 +1,240 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+func expectRoute(t *testing.T, table *RoutingTable, id, nextHop string, distance float64) {
+	t.Helper()
+
+	route, ok := table.Route(id)
+
+	if !ok {
+		t.Fatalf("expected a route to %s", id)
+	}
+
+	if route.NextHop != nextHop || route.Distance != distance {
+		t.Fatalf("expected route to %s through %q at %v, got %q at %v", id, nextHop, distance, route.NextHop, route.Distance)
+	}
+}
+
+func expectNoRoute(t *testing.T, table *RoutingTable, id string) {
+	t.Helper()
+
+	if route, ok := table.Route(id); ok {
+		t.Fatalf("expected no route to %s, got one through %q at %v", id, route.NextHop, route.Distance)
+	}
+}
+
+func distances(routes map[string]float64) map[string]ClientRoutingInfo {
+	distances := make(map[string]ClientRoutingInfo)
+
+	for id, distance := range routes {
+		distances[id] = ClientRoutingInfo{Distance: distance}
+	}
+
+	return distances
+}
+
+func TestNeighborsAreReachedDirectly(t *testing.T) {
+	table := NewRoutingTable("me")
+
+	if !table.SetLink("a", 20, ClientRoutingInfo{}) {
+		t.Fatalf("expected new link to change routes")
+	}
+
+	expectRoute(t, table, "a", "", 20)
+
+	// links always cost something
+	table.SetLinkCost("a", 0)
+	expectRoute(t, table, "a", "", minLinkCost)
+}
+
+func TestRoutesAreLearnedFromNeighbors(t *testing.T) {
+	table := NewRoutingTable("me")
+	now := time.Now()
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+
+	if !table.Update("a", distances(map[string]float64{"b": 30, "me": 20}), now) {
+		t.Fatalf("expected new route to change routes")
+	}
+
+	expectRoute(t, table, "b", "a", 50)
+	expectNoRoute(t, table, "me")
+
+	// advertisements from clients that aren't neighbors are ignored
+	if table.Update("x", distances(map[string]float64{"c": 1}), now) {
+		t.Fatalf("expected advertisement from a stranger to be ignored")
+	}
+
+	expectNoRoute(t, table, "c")
+}
+
+func TestLowestLatencyRouteWins(t *testing.T) {
+	table := NewRoutingTable("me")
+	now := time.Now()
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+	table.SetLink("b", 100, ClientRoutingInfo{})
+	table.SetLink("c", 200, ClientRoutingInfo{})
+
+	table.Update("a", distances(map[string]float64{"c": 30}), now)
+	table.Update("b", distances(map[string]float64{"c": 10}), now)
+
+	// through a is cheaper than the direct link
+	expectRoute(t, table, "c", "a", 50)
+
+	// a gets slow, so go direct
+	table.SetLinkCost("a", 500)
+	expectRoute(t, table, "c", "b", 110)
+
+	table.SetLinkCost("c", 10)
+	expectRoute(t, table, "c", "", 10)
+}
+
+func TestRoutesAreWithdrawn(t *testing.T) {
+	table := NewRoutingTable("me")
+	now := time.Now()
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+	table.Update("a", distances(map[string]float64{"b": 30, "c": 40}), now)
+
+	// a stops advertising b
+	if !table.Update("a", distances(map[string]float64{"c": 40}), now) {
+		t.Fatalf("expected withdrawn route to change routes")
+	}
+
+	expectNoRoute(t, table, "b")
+	expectRoute(t, table, "c", "a", 60)
+
+	// a disconnects
+	if !table.RemoveLink("a") {
+		t.Fatalf("expected removed link to change routes")
+	}
+
+	expectNoRoute(t, table, "a")
+	expectNoRoute(t, table, "c")
+}
+
+func TestRoutesExpire(t *testing.T) {
+	table := NewRoutingTable("me")
+	now := time.Now()
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+	table.Update("a", distances(map[string]float64{"b": 30}), now)
+
+	if table.Expire(now.Add(routeTimeout / 2)) {
+		t.Fatalf("expected recent routes to be kept")
+	}
+
+	expectRoute(t, table, "b", "a", 50)
+
+	if !table.Expire(now.Add(2 * routeTimeout)) {
+		t.Fatalf("expected stale routes to expire")
+	}
+
+	expectNoRoute(t, table, "b")
+
+	// the link itself stays until the neighbor disconnects
+	expectRoute(t, table, "a", "", 20)
+}
+
+func TestUnreachableRoutesAreIgnored(t *testing.T) {
+	table := NewRoutingTable("me")
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+	table.Update("a", distances(map[string]float64{"b": routeInfinity, "c": routeInfinity - 10}), time.Now())
+
+	expectNoRoute(t, table, "b")
+	expectNoRoute(t, table, "c")
+}
+
+func TestRoutesArePoisonedTowardsTheirNextHop(t *testing.T) {
+	table := NewRoutingTable("me")
+
+	table.SetLink("a", 20, ClientRoutingInfo{})
+	table.SetLink("b", 30, ClientRoutingInfo{})
+	table.Update("a", distances(map[string]float64{"c": 10}), time.Now())
+
+	toA := table.Advertisement("a")
+	toB := table.Advertisement("b")
+
+	if toA["c"].Distance != routeInfinity {
+		t.Fatalf("expected route to c to be poisoned towards a, got %v", toA["c"].Distance)
+	}
+
+	if toB["c"].Distance != 30 {
+		t.Fatalf("expected route to c to be advertised to b at 30, got %v", toB["c"].Distance)
+	}
+
+	if _, ok := toA["a"]; ok {
+		t.Fatalf("expected a not to be advertised to itself")
+	}
+}
+
+// Three clients in a line, me - a - b. When b goes away, a must not pick up
+// our old route to b, which went through a in the first place.
+func TestNoCountToInfinity(t *testing.T) {
+	me := NewRoutingTable("me")
+	a := NewRoutingTable("a")
+	now := time.Now()
+
+	me.SetLink("a", 10, ClientRoutingInfo{})
+	a.SetLink("me", 10, ClientRoutingInfo{})
+	a.SetLink("b", 10, ClientRoutingInfo{})
+
+	me.Update("a", a.Advertisement("me"), now)
+	a.Update("me", me.Advertisement("a"), now)
+
+	expectRoute(t, me, "b", "a", 20)
+
+	a.RemoveLink("b")
+	a.Update("me", me.Advertisement("a"), now)
+
+	expectNoRoute(t, a, "b")
+
+	me.Update("a", a.Advertisement("me"), now)
+
+	expectNoRoute(t, me, "b")
+}
+
+func TestNetworkWithdrawsRoutesWhenNeighborsLeave(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	d := startTestNetwork(t, transport, "memory:d")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	if _, err := a.Connect("memory:d", "", nil); err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+
+	if _, err := b.Connect("memory:d", "", nil); err != nil {
+		t.Fatalf("connect b: %v", err)
+	}
+
+	waitFor := func(what string, done func() bool) {
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+			if done() {
+				return
+			}
+		}
+
+		t.Fatalf("timed out waiting for %s", what)
+	}
+
+	waitFor("a to learn a route to b", func() bool {
+		route, ok := a.GetRoutes()[b.me]
+		return ok && route.NextHop == d.me
+	})
+
+	d.Disconnect(b.me)
+
+	waitFor("a to lose its route to b", func() bool {
+		_, routed := a.GetRoutes()[b.me]
+		_, client := a.GetClient(b.me)
+		return !routed && !client
+	})
+}
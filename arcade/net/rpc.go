@@ -0,0 +1,297 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Calls without a deadline give up after this long.
+const defaultCallTimeout = 2 * time.Second
+
+// Requests are sent again if there's no reply within callRetryInterval, then
+// twice that, and so on up to maxCallRetryInterval. Each one is only ever
+// handled once, see replyCache.
+const callRetryInterval = 250 * time.Millisecond
+const maxCallRetryInterval = 2 * time.Second
+
+// How long replies are kept in case the request is sent again.
+const replyCacheTimeout = 30 * time.Second
+
+var (
+	// ErrTimeout is returned when there's no reply before the deadline.
+	ErrTimeout = errors.New("timed out")
+
+	// ErrUnreachable is returned when there's no way to send the request,
+	// e.g. because the client disconnected.
+	ErrUnreachable = errors.New("client unreachable")
+
+	// ErrRejected matches every RejectedError with errors.Is.
+	ErrRejected = errors.New("request rejected")
+)
+
+// RejectedError is returned when the client replied, but not with what was
+// asked for, e.g. because its handler returned an error.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "request rejected: " + e.Reason
+}
+
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// Call sends req to client, and waits for its reply. The request is sent
+// reliably, and sent again with backoff while there's no reply, until ctx is
+// done or defaultCallTimeout passes if it has no deadline. The client handles
+// it once however many times it's sent.
+func Call[Req message.Envelope, Resp any](ctx context.Context, n *Network, client *Client, req Req) (Resp, error) {
+	var resp Resp
+
+	reply, err := n.call(ctx, client, req)
+
+	if err != nil {
+		return resp, err
+	}
+
+	if reject, ok := reply.(*RejectMessage); ok {
+		return resp, &RejectedError{Reason: reject.Reason}
+	}
+
+	resp, ok := reply.(Resp)
+
+	if !ok {
+		return resp, &RejectedError{Reason: fmt.Sprintf("unexpected reply %T", reply)}
+	}
+
+	return resp, nil
+}
+
+func (n *Network) call(ctx context.Context, client *Client, req message.Envelope) (interface{}, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultCallTimeout)
+		defer cancel()
+	}
+
+	messageID := uuid.NewString()
+	req.Header().MessageID = messageID
+
+	recvCh := make(chan interface{}, 1)
+
+	n.pendingMessagesMux.Lock()
+	n.pendingMessages[messageID] = recvCh
+	n.pendingMessagesMux.Unlock()
+
+	defer func() {
+		n.pendingMessagesMux.Lock()
+		delete(n.pendingMessages, messageID)
+		n.pendingMessagesMux.Unlock()
+	}()
+
+	retryInterval := callRetryInterval
+
+	for {
+		if !n.SendOn(client, Reliable, req) {
+			return nil, ErrUnreachable
+		}
+
+		timer := time.NewTimer(retryInterval)
+
+		select {
+		case reply := <-recvCh:
+			timer.Stop()
+			return reply, nil
+		case <-ctx.Done():
+			timer.Stop()
+
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		if retryInterval *= 2; retryInterval > maxCallRetryInterval {
+			retryInterval = maxCallRetryInterval
+		}
+	}
+}
+
+// HandlerFunc handles a message sent to us, and returns the reply to send
+// back, or nil for none.
+type HandlerFunc func(from *Client, msg interface{}) interface{}
+
+// Handle registers handler for the messages of type Req sent to us, instead
+// of passing them on to the listeners. Errors it returns are sent back as
+// rejections, see RejectedError.
+func Handle[Req message.Envelope](n *Network, handler func(from *Client, req Req) (interface{}, error)) {
+	n.HandleType(reflect.TypeOf((*Req)(nil)).Elem(), func(from *Client, msg interface{}) interface{} {
+		reply, err := handler(from, msg.(Req))
+
+		if err != nil {
+			return NewRejectMessage(err.Error())
+		}
+
+		return reply
+	})
+}
+
+// HandleType registers handler for the messages of type t sent to us. Handle
+// is usually more convenient.
+func (n *Network) HandleType(t reflect.Type, handler HandlerFunc) {
+	n.handlersMux.Lock()
+	defer n.handlersMux.Unlock()
+
+	n.handlers[t] = handler
+}
+
+func (n *Network) handlerFor(msg interface{}) (HandlerFunc, bool) {
+	n.handlersMux.RLock()
+	defer n.handlersMux.RUnlock()
+
+	handler, ok := n.handlers[reflect.TypeOf(msg)]
+	return handler, ok
+}
+
+// dispatch hands a message sent to us to its handler, or to the listeners if
+// there's none, and returns the replies.
+func (n *Network) dispatch(c *Client, msg interface{}) []interface{} {
+	handler, ok := n.handlerFor(msg)
+
+	if !ok {
+		return message.Notify(c, msg)
+	}
+
+	reply := handler(c, msg)
+
+	if reply == nil {
+		return nil
+	}
+
+	if envelope, ok := reply.(message.Envelope); ok {
+		envelope.Header().MessageID = msg.(message.Envelope).Header().MessageID
+	}
+
+	return []interface{}{reply}
+}
+
+type replyKey struct {
+	senderID  string
+	messageID string
+}
+
+type cachedReplies struct {
+	replies  []interface{}
+	received time.Time
+
+	// Closed once the replies are in
+	done chan struct{}
+}
+
+// replyCache remembers the replies to recent requests, so that requests sent
+// again are answered without being handled again.
+type replyCache struct {
+	sync.Mutex
+
+	entries map[replyKey]*cachedReplies
+}
+
+func newReplyCache() *replyCache {
+	return &replyCache{entries: make(map[replyKey]*cachedReplies)}
+}
+
+// begin returns the replies to the request, if it's been seen before, and
+// whether it has. Requests seen for the first time must be finished.
+func (rc *replyCache) begin(key replyKey, now time.Time) (*cachedReplies, bool) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	if entry, ok := rc.entries[key]; ok {
+		return entry, true
+	}
+
+	rc.entries[key] = &cachedReplies{received: now, done: make(chan struct{})}
+	return nil, false
+}
+
+func (rc *replyCache) finish(key replyKey, replies []interface{}) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	if entry, ok := rc.entries[key]; ok {
+		entry.replies = replies
+		close(entry.done)
+	}
+}
+
+func (rc *replyCache) expire(now time.Time) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	for key, entry := range rc.entries {
+		if now.Sub(entry.received) > replyCacheTimeout {
+			delete(rc.entries, key)
+		}
+	}
+}
+
+// handle dispatches a message sent to us, unless it's a request that was
+// sent again, in which case the replies it got the first time are returned.
+func (n *Network) handle(c *Client, msg interface{}) []interface{} {
+	header := msg.(message.Envelope).Header()
+
+	if header.MessageID == "" {
+		return n.dispatch(c, msg)
+	}
+
+	key := replyKey{header.SenderID, header.MessageID}
+	entry, seen := n.replies.begin(key, time.Now())
+
+	if !seen {
+		replies := n.dispatch(c, msg)
+		n.replies.finish(key, replies)
+		return replies
+	}
+
+	// Still being handled, in which case the first one will be answered
+	select {
+	case <-entry.done:
+		return entry.replies
+	default:
+		return nil
+	}
+}
+
+// RejectMessage is the reply to a request its handler returned an error for.
+type RejectMessage struct {
+	message.Message
+
+	Reason string
+}
+
+func NewRejectMessage(reason string) *RejectMessage {
+	return &RejectMessage{
+		Message: message.Message{Type: "reject"},
+		Reason:  reason,
+	}
+}
+
+func (m RejectMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m RejectMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
@@ -0,0 +1,107 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startTestCall connects two networks, where b handles count messages with
+// handler.
+func startTestCall(t *testing.T, handler func(from *Client, req *countMessage) (interface{}, error)) (*Network, *Client) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	Handle(b, handler)
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	return a, client
+}
+
+func TestCallReturnsTypedReplies(t *testing.T) {
+	a, client := startTestCall(t, func(from *Client, req *countMessage) (interface{}, error) {
+		return newCountMessage(req.N + 1), nil
+	})
+
+	reply, err := Call[*countMessage, *countMessage](context.Background(), a, client, newCountMessage(1))
+
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+
+	if reply.N != 2 {
+		t.Fatalf("expected 2, got %d", reply.N)
+	}
+
+	if _, err := Call[*countMessage, *testMessage](context.Background(), a, client, newCountMessage(1)); !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected a reply of the wrong type to be rejected, got %v", err)
+	}
+}
+
+func TestCallReturnsRejections(t *testing.T) {
+	a, client := startTestCall(t, func(from *Client, req *countMessage) (interface{}, error) {
+		return nil, errors.New("too high")
+	})
+
+	_, err := Call[*countMessage, *countMessage](context.Background(), a, client, newCountMessage(1))
+
+	var rejected *RejectedError
+
+	if !errors.As(err, &rejected) || rejected.Reason != "too high" || !errors.Is(err, ErrRejected) {
+		t.Fatalf("expected the request to be rejected, got %v", err)
+	}
+}
+
+func TestCallRetriesButHandlesOnce(t *testing.T) {
+	var handled int32
+
+	a, client := startTestCall(t, func(from *Client, req *countMessage) (interface{}, error) {
+		atomic.AddInt32(&handled, 1)
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*callRetryInterval)
+	defer cancel()
+
+	if _, err := Call[*countMessage, *countMessage](ctx, a, client, newCountMessage(1)); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected the call to time out, got %v", err)
+	}
+
+	if handled := atomic.LoadInt32(&handled); handled != 1 {
+		t.Fatalf("expected the request to be handled once, got %d", handled)
+	}
+}
+
+func TestCallCanBeCanceled(t *testing.T) {
+	a, client := startTestCall(t, func(from *Client, req *countMessage) (interface{}, error) {
+		return nil, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := Call[*countMessage, *countMessage](ctx, a, client, newCountMessage(1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the call to be canceled, got %v", err)
+	}
+}
+
+func TestCallFailsForUnreachableClients(t *testing.T) {
+	a, client := startTestCall(t, func(from *Client, req *countMessage) (interface{}, error) {
+		return newCountMessage(req.N), nil
+	})
+
+	a.Disconnect(client.ID)
+
+	if _, err := Call[*countMessage, *countMessage](context.Background(), a, client, newCountMessage(1)); !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expected the client to be unreachable, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SealedMessage carries another message encrypted for its recipient, so that
+// clients and distributors routing it along can't read or change it. Only the
+// header stays readable, and it's authenticated along with the contents.
+type SealedMessage struct {
+	message.Message
+
+	Nonce  []byte
+	Sealed []byte
+}
+
+func (m SealedMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m SealedMessage) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, &m)
+}
+
+// isHandshake returns whether msg is sent in the clear. These are only ever
+// sent between neighbors, and are how clients learn each other's keys.
+func isHandshake(msg interface{}) bool {
+	switch msg.(type) {
+	case *PingMessage, *PongMessage, *RoutingMessage:
+		return true
+	}
+
+	return false
+}
+
+// seal encrypts msg for client along with its channel header. msg must
+// already have its header set.
+func (n *Network) seal(client *Client, msg interface{}, h channelHeader) (*SealedMessage, error) {
+	aead, err := n.sessionCipher(client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Encode a copy without the header, since the header is sent in the clear
+	v := reflect.New(reflect.TypeOf(msg).Elem())
+	v.Elem().Set(reflect.ValueOf(msg).Elem())
+
+	header := v.Elem().FieldByName("Message").Interface().(message.Message)
+	v.Elem().FieldByName("Message").Set(reflect.ValueOf(message.Message{Type: header.Type}))
+
+	codec := message.NewCodec()
+	codec.SetVersion(n.GetCodec())
+
+	encoded, err := codec.Encode(v.Interface())
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := append(h.append(nil), encoded...)
+
+	sealed := &SealedMessage{
+		Message: message.Message{
+			SenderID:    header.SenderID,
+			RecipientID: header.RecipientID,
+			MessageID:   header.MessageID,
+			Type:        "sealed",
+		},
+		Nonce: make([]byte, aead.NonceSize()),
+	}
+
+	if _, err := rand.Read(sealed.Nonce); err != nil {
+		return nil, err
+	}
+
+	sealed.Sealed = aead.Seal(nil, sealed.Nonce, data, sealedHeader(sealed.Message))
+	return sealed, nil
+}
+
+// open decrypts a message sealed for us, and checks it really came from the
+// client in its header. It returns the message along with its sender and
+// channel header.
+func (n *Network) open(sealed *SealedMessage) (interface{}, *Client, channelHeader, error) {
+	sender, ok := n.GetClient(sealed.SenderID)
+
+	if !ok {
+		return nil, nil, channelHeader{}, fmt.Errorf("sealed message from unknown client %s", sealed.SenderID)
+	}
+
+	aead, err := n.sessionCipher(sender)
+
+	if err != nil {
+		return nil, nil, channelHeader{}, err
+	}
+
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, nil, channelHeader{}, errors.New("invalid nonce")
+	}
+
+	data, err := aead.Open(nil, sealed.Nonce, sealed.Sealed, sealedHeader(sealed.Message))
+
+	if err != nil {
+		return nil, nil, channelHeader{}, fmt.Errorf("sealed message from %s failed authentication", sealed.SenderID)
+	}
+
+	h, data, err := readChannelHeader(data)
+
+	if err != nil {
+		return nil, nil, channelHeader{}, err
+	}
+
+	msg, err := message.NewCodec().Decode(data)
+
+	if err != nil {
+		return nil, nil, channelHeader{}, err
+	}
+
+	header := reflect.ValueOf(msg).Elem().FieldByName("Message")
+	header.FieldByName("SenderID").SetString(sealed.SenderID)
+	header.FieldByName("RecipientID").SetString(sealed.RecipientID)
+	header.FieldByName("MessageID").SetString(sealed.MessageID)
+
+	return msg, sender, h, nil
+}
+
+// sealedHeader is the additional data authenticated with a sealed message, so
+// that it can't be passed off as coming from or going to someone else.
+func sealedHeader(header message.Message) []byte {
+	return bytes.Join([][]byte{
+		[]byte(header.SenderID),
+		[]byte(header.RecipientID),
+		[]byte(header.MessageID),
+	}, []byte{0})
+}
+
+// sessionCipher returns the cipher shared with client, working out the key
+// from our private key and the client's public key the first time.
+func (n *Network) sessionCipher(client *Client) (cipher.AEAD, error) {
+	client.Lock()
+	defer client.Unlock()
+
+	if client.sessionKey != nil {
+		return chacha20poly1305.NewX(client.sessionKey)
+	}
+
+	if len(client.PublicKey) == 0 {
+		return nil, fmt.Errorf("no key for client %s", client.ID)
+	}
+
+	shared, err := curve25519.X25519(n.identity.PrivateKey, client.PublicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Both sides need to come up with the same key, so put the IDs in order
+	ids := []string{n.me, client.ID}
+
+	if ids[0] > ids[1] {
+		ids[0], ids[1] = ids[1], ids[0]
+	}
+
+	info := []byte("arcade session key " + ids[0] + " " + ids[1])
+	key := make([]byte, chacha20poly1305.KeySize)
+
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, info), key); err != nil {
+		return nil, err
+	}
+
+	client.sessionKey = key
+	return chacha20poly1305.NewX(key)
+}
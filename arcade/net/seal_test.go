@@ -0,0 +1,306 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testMessage struct {
+	message.Message
+	Text string
+}
+
+func init() {
+	message.Register(testMessage{Message: message.Message{Type: "test"}})
+}
+
+func newTestMessage(text string) *testMessage {
+	return &testMessage{Message: message.Message{Type: "test"}, Text: text}
+}
+
+func TestSessionIDsBelongToTheirKey(t *testing.T) {
+	identity, _ := GenerateIdentity()
+	other, _ := GenerateIdentity()
+
+	salt := uuid.NewString()
+	id := identity.SessionID(salt)
+
+	if !VerifySessionID(id, identity.PublicKey, salt) {
+		t.Fatalf("expected session ID to match its key")
+	}
+
+	if VerifySessionID(id, other.PublicKey, salt) {
+		t.Fatalf("expected session ID not to match another key")
+	}
+
+	if VerifySessionID(id, identity.PublicKey, uuid.NewString()) {
+		t.Fatalf("expected session ID not to match another salt")
+	}
+
+	if restored, err := NewIdentity(identity.PrivateKey); err != nil || restored.SessionID(salt) != id {
+		t.Fatalf("expected identity restored from its private key to have the same session ID")
+	}
+}
+
+func TestPlayerIDsOutliveSessions(t *testing.T) {
+	identity, _ := GenerateIdentity()
+	other, _ := GenerateIdentity()
+
+	if identity.PlayerID() == "" || identity.PlayerID() == other.PlayerID() {
+		t.Fatalf("expected every identity to have its own player ID")
+	}
+
+	if identity.PlayerID() == identity.SessionID("") {
+		t.Fatalf("expected player IDs not to match session IDs")
+	}
+
+	if restored, _ := NewIdentity(identity.PrivateKey); restored.PlayerID() != identity.PlayerID() {
+		t.Fatalf("expected identity restored from its private key to have the same player ID")
+	}
+
+	if PlayerIDFor([]byte("short")) != "" {
+		t.Fatalf("expected invalid keys not to have a player ID")
+	}
+
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	client.RLock()
+	publicKey := client.PublicKey
+	client.RUnlock()
+
+	if client.PlayerID() == "" || client.PlayerID() != PlayerIDFor(publicKey) {
+		t.Fatalf("expected clients to have the player ID of their key")
+	}
+}
+
+func TestNeighborsSealMessages(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	res, err := a.SendAndReceive(client, newTestMessage("hello"))
+
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if reply := res.(*testMessage); reply.Text != "re: hello" || reply.SenderID != b.me {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+}
+
+func TestUnsealedMessagesAreDropped(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// skip sealing, as if a was pretending to be someone else
+	msg := newTestMessage("hello")
+	msg.SenderID = a.me
+	msg.RecipientID = b.me
+	msg.MessageID = uuid.NewString()
+
+	recvCh := make(chan interface{}, 1)
+
+	a.pendingMessagesMux.Lock()
+	a.pendingMessages[msg.MessageID] = recvCh
+	a.pendingMessagesMux.Unlock()
+
+	a.SendRaw(client, msg)
+
+	select {
+	case <-recvCh:
+		t.Fatalf("expected unsealed message to be dropped")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTamperedMessagesFailToOpen(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	msg := newTestMessage("hello")
+	msg.SenderID = a.me
+	msg.RecipientID = b.me
+
+	sealed, err := a.seal(client, msg, a.channelsTo(b.me).number(Unreliable))
+
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	if _, _, _, err := b.open(sealed); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	sealed.Sealed[0] ^= 1
+
+	if _, _, _, err := b.open(sealed); err == nil {
+		t.Fatalf("expected tampered message to fail to open")
+	}
+
+	sealed.Sealed[0] ^= 1
+	sealed.MessageID = uuid.NewString()
+
+	if _, _, _, err := b.open(sealed); err == nil {
+		t.Fatalf("expected message with a changed header to fail to open")
+	}
+}
+
+func TestReplayedMessagesAreDropped(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	var handledMux sync.Mutex
+	handled := 0
+
+	message.AddListener(message.Listener{
+		Distributor: true,
+		ServerID:    b.me,
+		Handle: func(c, msg interface{}) interface{} {
+			if msg, ok := msg.(*testMessage); ok && c.(*Client).Delegate == b && msg.Text == "replayed" {
+				handledMux.Lock()
+				handled++
+				handledMux.Unlock()
+			}
+
+			return nil
+		},
+	})
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// without a message ID, as sent by Send, so replies to earlier requests
+	// aren't what stops it
+	msg := newTestMessage("replayed")
+	msg.SenderID = a.me
+	msg.RecipientID = b.me
+
+	sealed, err := a.seal(client, msg, a.channelsTo(b.me).number(Unreliable))
+
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	// as if a client relaying it had kept a copy
+	for i := 0; i < 3; i++ {
+		a.SendRaw(client, sealed)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	handledMux.Lock()
+	defer handledMux.Unlock()
+
+	if handled != 1 {
+		t.Fatalf("expected the message to be handled once, got %d", handled)
+	}
+}
+
+func TestDistributorOnlyForwardsCiphertext(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	d := startTestNetwork(t, transport, "memory:d")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	var seenMux sync.Mutex
+	seen := make(map[string]bool)
+
+	message.AddListener(message.Listener{
+		Distributor: true,
+		ServerID:    d.me,
+		Handle: func(c, msg interface{}) interface{} {
+			if c.(*Client).Delegate == d {
+				seenMux.Lock()
+				switch msg.(type) {
+				case *testMessage:
+					seen["plaintext"] = true
+				case *SealedMessage:
+					seen["sealed"] = true
+				}
+				seenMux.Unlock()
+			}
+
+			return nil
+		},
+	})
+
+	if _, err := a.Connect("memory:d", "", nil); err != nil {
+		t.Fatalf("connect a: %v", err)
+	}
+
+	if _, err := b.Connect("memory:d", "", nil); err != nil {
+		t.Fatalf("connect b: %v", err)
+	}
+
+	d.PropagateRoutes()
+
+	var client *Client
+
+	for start := time.Now(); client == nil && time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		client, _ = a.GetClient(b.me)
+	}
+
+	if client == nil {
+		t.Fatalf("a never learned a route to b")
+	}
+
+	res, err := a.SendAndReceive(client, newTestMessage("hello"))
+
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	if reply := res.(*testMessage); reply.Text != "re: hello" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+
+	seenMux.Lock()
+	defer seenMux.Unlock()
+
+	if !seen["sealed"] || seen["plaintext"] {
+		t.Fatalf("expected the distributor to only see sealed messages")
+	}
+}
@@ -0,0 +1,373 @@
+package net
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// Transport opens connections between clients. Connections must keep message
+// boundaries: every Write on one end shows up as exactly one Read on the
+// other, which is how KCP behaves.
+type Transport interface {
+	Dial(addr string) (net.Conn, error)
+	Listen(addr string) (net.Listener, error)
+}
+
+// Puncher is a transport that can connect clients behind NAT. Both clients
+// punch each other's public address at about the same time, with the same
+// conversation ID, and each gets its end of one connection.
+type Puncher interface {
+	Punch(addr string, conv uint32) (net.Conn, error)
+}
+
+// NewTransport returns the transport with the given name, as picked with the
+// -transport flag.
+func NewTransport(name string) (Transport, error) {
+	switch name {
+	case "kcp":
+		return NewKCPTransport(), nil
+	case "tcp":
+		return TCPTransport{}, nil
+	case "memory":
+		return NewMemoryTransport(), nil
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", name)
+}
+
+//
+// KCP
+//
+
+// KCPTransport is reliable UDP, and what the game uses by default. Once it's
+// listening, connections are dialed from the listening socket too, so peers
+// and NATs see one address for us. That's what lets it punch holes.
+type KCPTransport struct {
+	sync.Mutex
+
+	mux *udpMux
+}
+
+func NewKCPTransport() *KCPTransport {
+	return &KCPTransport{}
+}
+
+func (t *KCPTransport) Dial(addr string) (net.Conn, error) {
+	t.Lock()
+	mux := t.mux
+	t.Unlock()
+
+	if mux == nil {
+		return kcp.Dial(addr)
+	}
+
+	return t.dial(mux, addr, rand.Uint32())
+}
+
+func (t *KCPTransport) Listen(addr string) (net.Listener, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mux := newUDPMux(conn)
+	listener, err := kcp.ServeConn(nil, 0, 0, mux.listener)
+
+	if err != nil {
+		mux.close()
+		return nil, err
+	}
+
+	t.Lock()
+	t.mux = mux
+	t.Unlock()
+
+	return &kcpListener{Listener: listener, mux: mux}, nil
+}
+
+func (t *KCPTransport) Punch(addr string, conv uint32) (net.Conn, error) {
+	t.Lock()
+	mux := t.mux
+	t.Unlock()
+
+	if mux == nil {
+		return nil, errors.New("can't punch without listening")
+	}
+
+	return t.dial(mux, addr, conv)
+}
+
+func (t *KCPTransport) dial(mux *udpMux, addr string, conv uint32) (net.Conn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := mux.dial(udpAddr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := kcp.NewConn3(conv, udpAddr, nil, 0, 0, conn)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &kcpConn{UDPSession: session, conn: conn}, nil
+}
+
+// KCP doesn't close sockets it was handed, so these close their part of the mux
+// themselves.
+
+type kcpListener struct {
+	*kcp.Listener
+
+	mux *udpMux
+}
+
+func (l *kcpListener) Close() error {
+	err := l.Listener.Close()
+	l.mux.close()
+
+	return err
+}
+
+type kcpConn struct {
+	*kcp.UDPSession
+
+	conn *muxConn
+}
+
+func (c *kcpConn) Close() error {
+	err := c.UDPSession.Close()
+	c.conn.Close()
+
+	return err
+}
+
+//
+// TCP
+//
+
+// TCPTransport sends messages over plain TCP, for networks that block UDP.
+// TCP is a stream, so every message is prefixed with its length.
+type TCPTransport struct{}
+
+func (TCPTransport) Dial(addr string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &framedConn{Conn: conn}, nil
+}
+
+func (TCPTransport) Listen(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return framedListener{listener}, nil
+}
+
+type framedListener struct {
+	net.Listener
+}
+
+func (l framedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &framedConn{Conn: conn}, nil
+}
+
+// framedConn restores message boundaries on top of a stream.
+type framedConn struct {
+	net.Conn
+
+	writeMux sync.Mutex
+}
+
+func (c *framedConn) Read(b []byte) (int, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return 0, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[:]))
+
+	if size > len(b) {
+		return 0, errors.New("message too large for buffer")
+	}
+
+	return io.ReadFull(c.Conn, b[:size])
+}
+
+func (c *framedConn) Write(b []byte) (int, error) {
+	if len(b) > 0xffff {
+		return 0, errors.New("message too large")
+	}
+
+	data := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(data, uint16(len(b)))
+	copy(data[2:], b)
+
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	if _, err := c.Conn.Write(data); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+//
+// In-memory
+//
+
+// MemoryTransport connects clients in the same process, so that several
+// clients can be run together in one test. Clients can only reach listeners
+// on the same MemoryTransport.
+type MemoryTransport struct {
+	sync.Mutex
+
+	listeners map[string]*memoryListener
+	nextPort  int
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		listeners: make(map[string]*memoryListener),
+		nextPort:  1,
+	}
+}
+
+func (t *MemoryTransport) Dial(addr string) (net.Conn, error) {
+	t.Lock()
+	listener, ok := t.listeners[addr]
+
+	// the dialing end needs an address too, so replies can find their way back
+	localAddr := memoryAddr(fmt.Sprintf("memory-client:%d", t.nextPort))
+	t.nextPort++
+	t.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no listener at %s", addr)
+	}
+
+	local, remote := net.Pipe()
+
+	select {
+	case listener.connCh <- &memoryConn{Conn: remote, local: memoryAddr(addr), remote: localAddr}:
+	case <-listener.closeCh:
+		return nil, fmt.Errorf("no listener at %s", addr)
+	}
+
+	return &memoryConn{Conn: local, local: localAddr, remote: memoryAddr(addr)}, nil
+}
+
+func (t *MemoryTransport) Listen(addr string) (net.Listener, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if _, ok := t.listeners[addr]; ok {
+		return nil, fmt.Errorf("address %s already in use", addr)
+	}
+
+	listener := &memoryListener{
+		transport: t,
+		addr:      memoryAddr(addr),
+		connCh:    make(chan net.Conn),
+		closeCh:   make(chan struct{}),
+	}
+
+	t.listeners[addr] = listener
+	return listener, nil
+}
+
+type memoryAddr string
+
+func (a memoryAddr) Network() string {
+	return "memory"
+}
+
+func (a memoryAddr) String() string {
+	return string(a)
+}
+
+type memoryListener struct {
+	transport *MemoryTransport
+	addr      memoryAddr
+
+	connCh    chan net.Conn
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.closeCh:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.transport.Lock()
+		delete(l.transport.listeners, string(l.addr))
+		l.transport.Unlock()
+
+		close(l.closeCh)
+	})
+
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// memoryConn is one end of a pipe. Pipes don't buffer, so each Write is read
+// whole by a single Read as long as the reader's buffer is big enough.
+type memoryConn struct {
+	net.Conn
+
+	local  memoryAddr
+	remote memoryAddr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memoryConn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,220 @@
+package net
+
+import (
+	"arcade/arcade/message"
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testMessageBoundaries(t *testing.T, transport Transport, addr string) {
+	listener, err := transport.Listen(addr)
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	defer listener.Close()
+
+	acceptCh := make(chan net.Conn, 1)
+
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			acceptCh <- conn
+		}
+	}()
+
+	client, err := transport.Dial(listener.Addr().String())
+
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	defer client.Close()
+
+	server := <-acceptCh
+	defer server.Close()
+
+	messages := [][]byte{[]byte("hello"), bytes.Repeat([]byte("x"), maxBufferSize), []byte("{}")}
+
+	go func() {
+		for _, msg := range messages {
+			client.Write(msg)
+		}
+	}()
+
+	buf := make([]byte, maxBufferSize)
+
+	for _, expected := range messages {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := server.Read(buf)
+
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		if !bytes.Equal(buf[:n], expected) {
+			t.Fatalf("expected message of %d bytes, got %d bytes", len(expected), n)
+		}
+	}
+}
+
+func TestTCPTransportKeepsMessageBoundaries(t *testing.T) {
+	testMessageBoundaries(t, TCPTransport{}, "127.0.0.1:0")
+}
+
+func TestMemoryTransportKeepsMessageBoundaries(t *testing.T) {
+	testMessageBoundaries(t, NewMemoryTransport(), "memory:1")
+}
+
+func TestMemoryTransportDialWithoutListener(t *testing.T) {
+	if _, err := NewMemoryTransport().Dial("memory:1"); err == nil {
+		t.Fatalf("expected dial to fail with nothing listening")
+	}
+}
+
+// startTestNetwork starts a network that accepts connections on addr.
+func startTestNetwork(t *testing.T, transport Transport, addr string) *Network {
+	n, _ := listenTestNetwork(t, transport, addr, false)
+	return n
+}
+
+// listenTestNetwork starts a network that accepts connections on addr, and
+// returns the address it's listening on. The server normally signals replies
+// to the network and forwards messages for other clients, so do that here
+// instead.
+func listenTestNetwork(t *testing.T, transport Transport, addr string, distributor bool) (*Network, string) {
+	identity, err := GenerateIdentity()
+
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+
+	n := NewNetwork(identity, uuid.NewString(), 0, distributor, transport)
+
+	message.AddListener(message.Listener{
+		Distributor: true,
+		ServerID:    n.me,
+		Handle: func(c, msg interface{}) interface{} {
+			if c.(*Client).Delegate != n {
+				return nil
+			}
+
+			header := reflect.ValueOf(msg).Elem().FieldByName("Message").Interface().(message.Message)
+
+			if header.RecipientID != n.me && header.RecipientID != "" {
+				if recipient, ok := n.GetClient(header.RecipientID); ok {
+					n.SendRaw(recipient, msg)
+				}
+
+				return nil
+			}
+
+			n.SignalReceived(header.MessageID, msg)
+
+			if msg, ok := msg.(*testMessage); ok {
+				return &testMessage{Message: message.Message{Type: "test"}, Text: "re: " + msg.Text}
+			}
+
+			return nil
+		},
+	})
+
+	listener, err := n.Listen(addr)
+
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			n.Connect(conn.RemoteAddr().String(), "", conn)
+		}
+	}()
+
+	return n, listener.Addr().String()
+}
+
+func TestNetworksConnectInProcess(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	if client.ID != b.me {
+		t.Fatalf("expected to connect to b, got %q", client.ID)
+	}
+
+	if version := client.codec.Version(); version != message.CodecLatest {
+		t.Fatalf("expected codec %d to be agreed on, got %d", message.CodecLatest, version)
+	}
+
+	// b learns about a from its ping
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, ok := b.GetClient(a.me); ok {
+			return
+		}
+	}
+
+	t.Fatalf("b never saw a connect")
+}
+
+func TestNetworksFallBackToJSON(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	startTestNetwork(t, transport, "memory:b").SetCodec(message.CodecJSON)
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	if version := client.codec.Version(); version != message.CodecJSON {
+		t.Fatalf("expected JSON to be agreed on, got codec %d", version)
+	}
+}
+
+func TestNetworksDropSilentNeighbors(t *testing.T) {
+	transport := NewMemoryTransport()
+
+	a := startTestNetwork(t, transport, "memory:a")
+	b := startTestNetwork(t, transport, "memory:b")
+
+	client, err := a.Connect("memory:b", "", nil)
+
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	a.dropSilentNeighbors(time.Now())
+
+	if _, ok := a.GetClient(b.me); !ok {
+		t.Fatalf("expected a neighbor we just heard from to be kept")
+	}
+
+	a.dropSilentNeighbors(client.LastReceived().Add(2 * routeTimeout))
+
+	if _, ok := a.GetClient(b.me); ok {
+		t.Fatalf("expected a silent neighbor to be dropped")
+	}
+}
@@ -0,0 +1,176 @@
+package net
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Packets queued for one connection before new ones get dropped, like a full
+// socket buffer would.
+const muxQueueSize = 1024
+
+// udpMux shares one UDP socket between a KCP listener and the sessions dialed
+// from it, so every connection leaves from the address we listen on. That's
+// the address NATs map for us, which the distributor sees and hands out when
+// punching holes.
+type udpMux struct {
+	sync.Mutex
+
+	conn     *net.UDPConn
+	listener *muxConn
+	dialed   map[string]*muxConn
+}
+
+type muxPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// muxConn is the part of a udpMux that one KCP session or listener reads and
+// writes through. Packets from addresses we dialed go to that session, and
+// everything else goes to the listener.
+type muxConn struct {
+	mux    *udpMux
+	remote string
+
+	packets   chan muxPacket
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newUDPMux(conn *net.UDPConn) *udpMux {
+	m := &udpMux{
+		conn:   conn,
+		dialed: make(map[string]*muxConn),
+	}
+
+	m.listener = m.newConn("")
+	go m.readLoop()
+
+	return m
+}
+
+func (m *udpMux) newConn(remote string) *muxConn {
+	return &muxConn{
+		mux:     m,
+		remote:  remote,
+		packets: make(chan muxPacket, muxQueueSize),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// dial returns the connection that receives packets from addr.
+func (m *udpMux) dial(addr net.Addr) (*muxConn, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.dialed[addr.String()]; ok {
+		return nil, fmt.Errorf("already connected to %s", addr)
+	}
+
+	c := m.newConn(addr.String())
+	m.dialed[c.remote] = c
+
+	return c, nil
+}
+
+func (m *udpMux) readLoop() {
+	buf := make([]byte, 1500)
+
+	for {
+		n, addr, err := m.conn.ReadFrom(buf)
+
+		if err != nil {
+			m.close()
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		m.Lock()
+		c, ok := m.dialed[addr.String()]
+
+		if !ok {
+			c = m.listener
+		}
+		m.Unlock()
+
+		select {
+		case c.packets <- muxPacket{data, addr}:
+		case <-c.closeCh:
+		default:
+		}
+	}
+}
+
+// close closes the socket and every connection on it.
+func (m *udpMux) close() {
+	m.conn.Close()
+
+	m.Lock()
+	conns := make([]*muxConn, 0, len(m.dialed)+1)
+	conns = append(conns, m.listener)
+
+	for _, c := range m.dialed {
+		conns = append(conns, c)
+	}
+	m.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+//
+// net.PacketConn methods
+//
+
+func (c *muxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-c.packets:
+		return copy(b, p.data), p.addr, nil
+	case <-c.closeCh:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *muxConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return c.mux.conn.WriteTo(b, addr)
+}
+
+func (c *muxConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closeCh)
+
+		if c.remote != "" {
+			c.mux.Lock()
+			if c.mux.dialed[c.remote] == c {
+				delete(c.mux.dialed, c.remote)
+			}
+			c.mux.Unlock()
+		}
+	})
+
+	return nil
+}
+
+func (c *muxConn) LocalAddr() net.Addr {
+	return c.mux.conn.LocalAddr()
+}
+
+// KCP keeps its own deadlines, so these are never needed
+
+func (c *muxConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *muxConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *muxConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,271 @@
+package arcade
+
+import (
+	"strconv"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	PONG_PADDLE_HEIGHT   = 4
+	PONG_WIN_SCORE       = 5
+	PONG_TIMESTEP_PERIOD = 50
+)
+
+type PongDirection int64
+
+const (
+	PongStop PongDirection = iota
+	PongUp
+	PongDown
+)
+
+func (d PongDirection) String() string {
+	switch d {
+	case PongStop:
+		return "PongStop"
+	case PongUp:
+		return "PongUp"
+	case PongDown:
+		return "PongDown"
+	}
+	return "?"
+}
+
+type PongPaddleState struct {
+	X         int
+	Y         int
+	Direction PongDirection
+	Color     string
+	PlayerNum int
+}
+
+type PongBallState struct {
+	X  int
+	Y  int
+	DX int
+	DY int
+}
+
+type PongGameState struct {
+	Width     int
+	Height    int
+	Serves    int
+	Ball      PongBallState
+	PlayerIDs []string
+	Paddles   map[string]PongPaddleState
+	Scores    map[string]int
+}
+
+type PongCommand struct {
+	Direction PongDirection
+}
+
+func (pc PongCommand) String() string {
+	return pc.Direction.String()
+}
+
+// PongGameLogic implements GameLogic for Pong.
+type PongGameLogic struct {
+	// Lobby the players' colors come from, if any
+	lobby *Lobby
+}
+
+func NewPongGameView(mgr *ViewManager, lobby *Lobby) *GameView[PongGameState, PongCommand] {
+	return NewGameView[PongGameState, PongCommand](mgr, lobby, PongGameLogic{lobby: lobby}, PONG_TIMESTEP_PERIOD)
+}
+
+// InitialState gives each paddle the color from its player's profile.
+func (pl PongGameLogic) InitialState(playerIDs []string, width, height int) PongGameState {
+	paddles := make(map[string]PongPaddleState)
+	scores := make(map[string]int)
+	profiles := gameProfiles(pl.lobby, playerIDs)
+
+	for i, playerID := range playerIDs {
+		x := 3
+		if i%2 == 1 {
+			x = width - 4
+		}
+
+		paddles[playerID] = PongPaddleState{x, (height - PONG_PADDLE_HEIGHT) / 2, PongStop, profiles[playerID].Color, i}
+		scores[playerID] = 0
+	}
+
+	state := PongGameState{
+		Width:     width,
+		Height:    height,
+		PlayerIDs: playerIDs,
+		Paddles:   paddles,
+		Scores:    scores,
+	}
+
+	return pl.serve(state)
+}
+
+// applies game state without increasing timestep
+func (pl PongGameLogic) ApplyCommand(gameState PongGameState, playerID string, cmd PongCommand) PongGameState {
+	paddle := gameState.Paddles[playerID]
+	paddle.Direction = cmd.Direction
+	gameState.Paddles[playerID] = paddle
+	return gameState
+}
+
+// Step moves the paddles and then the ball by one fixed timestep.
+func (pl PongGameLogic) Step(gameState PongGameState) PongGameState {
+	for playerID, paddle := range gameState.Paddles {
+		switch paddle.Direction {
+		case PongUp:
+			paddle.Y -= 1
+		case PongDown:
+			paddle.Y += 1
+		}
+
+		// paddles stop when they hit a wall
+		if paddle.Y < 2 {
+			paddle.Y = 2
+			paddle.Direction = PongStop
+		} else if paddle.Y > gameState.Height-2-PONG_PADDLE_HEIGHT {
+			paddle.Y = gameState.Height - 2 - PONG_PADDLE_HEIGHT
+			paddle.Direction = PongStop
+		}
+
+		gameState.Paddles[playerID] = paddle
+	}
+
+	return pl.stepBall(gameState)
+}
+
+func (pl PongGameLogic) IsOver(gameState PongGameState) (bool, string) {
+	if len(gameState.Paddles) == 1 {
+		return true, NoFriendsWinner
+	}
+
+	for _, playerID := range gameState.PlayerIDs {
+		if gameState.Scores[playerID] >= PONG_WIN_SCORE {
+			return true, playerID
+		}
+	}
+
+	return false, ""
+}
+
+// Input moves the paddle up or down. Pressing the opposite direction of a
+// moving paddle stops it.
+func (pl PongGameLogic) Input(gameState PongGameState, playerID string, ev *tcell.EventKey) (PongCommand, bool) {
+	current := gameState.Paddles[playerID].Direction
+
+	switch ev.Key() {
+	case tcell.KeyUp:
+		if current == PongDown {
+			return PongCommand{PongStop}, true
+		}
+
+		return PongCommand{PongUp}, current != PongUp
+	case tcell.KeyDown:
+		if current == PongUp {
+			return PongCommand{PongStop}, true
+		}
+
+		return PongCommand{PongDown}, current != PongDown
+	}
+
+	return PongCommand{}, false
+}
+
+func (pl PongGameLogic) Render(s *Screen, gameState PongGameState, me string, showDebug bool) {
+	netStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorDarkGray)
+
+	for y := 2; y < gameState.Height-2; y += 2 {
+		s.DrawText(gameState.Width/2, y, netStyle, "┆")
+	}
+
+	scores := ""
+	for i, playerID := range gameState.PlayerIDs {
+		if i > 0 {
+			scores += " - "
+		}
+
+		scores += strconv.Itoa(gameState.Scores[playerID])
+	}
+
+	scoreStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+	s.DrawText(CenterX, 1, scoreStyle, " "+scores+" ")
+
+	for _, paddle := range gameState.Paddles {
+		style := tcell.StyleDefault.Background(tcell.ColorNames[paddle.Color])
+
+		for i := 0; i < PONG_PADDLE_HEIGHT; i++ {
+			s.DrawText(paddle.X, paddle.Y+i, style, " ")
+		}
+	}
+
+	ball := gameState.Ball
+	ballStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite)
+	s.DrawText(ball.X, ball.Y, ballStyle, "●")
+}
+
+func (pl PongGameLogic) stepBall(gameState PongGameState) PongGameState {
+	ball := gameState.Ball
+
+	// bounce off the top and bottom walls
+	if ball.Y+ball.DY <= 1 || ball.Y+ball.DY >= gameState.Height-2 {
+		ball.DY = -ball.DY
+	}
+
+	newX := ball.X + ball.DX
+	newY := ball.Y + ball.DY
+
+	for _, paddle := range gameState.Paddles {
+		if newX != paddle.X || newY < paddle.Y || newY >= paddle.Y+PONG_PADDLE_HEIGHT {
+			continue
+		}
+
+		ball.DX = -ball.DX
+
+		// hitting the edge of a paddle sends the ball off at an angle
+		if newY == paddle.Y {
+			ball.DY = -1
+		} else if newY == paddle.Y+PONG_PADDLE_HEIGHT-1 {
+			ball.DY = 1
+		}
+
+		newX = ball.X + ball.DX
+		newY = ball.Y
+		break
+	}
+
+	ball.X = newX
+	ball.Y = newY
+	gameState.Ball = ball
+
+	if ball.X <= 1 || ball.X >= gameState.Width-2 {
+		for playerID, paddle := range gameState.Paddles {
+			// the player on the opposite side of the ball scores
+			if (ball.X <= 1) != (paddle.PlayerNum%2 == 0) {
+				gameState.Scores[playerID] += 1
+			}
+		}
+
+		gameState = pl.serve(gameState)
+	}
+
+	return gameState
+}
+
+// serve resets the ball to the center, alternating the serving direction.
+func (pl PongGameLogic) serve(gameState PongGameState) PongGameState {
+	dx := 1
+	if gameState.Serves%2 == 1 {
+		dx = -1
+	}
+
+	dy := 1
+	if (gameState.Serves/2)%2 == 1 {
+		dy = -1
+	}
+
+	gameState.Ball = PongBallState{gameState.Width / 2, gameState.Height / 2, dx, dy}
+	gameState.Serves += 1
+
+	return gameState
+}
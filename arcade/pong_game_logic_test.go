@@ -0,0 +1,176 @@
+package arcade
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const (
+	pongTestWidth  = 40
+	pongTestHeight = 20
+)
+
+// newPongTestState starts a game between a on the left and b on the right,
+// with the paddles at (3, 8) and (36, 8) and the ball served from (20, 10).
+func newPongTestState() PongGameState {
+	return PongGameLogic{}.InitialState([]string{"a", "b"}, pongTestWidth, pongTestHeight)
+}
+
+func TestPongStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		ball    PongBallState
+		paddles map[string]PongPaddleState
+		expBall PongBallState
+		expY    map[string]int
+		expDir  map[string]PongDirection
+		scores  map[string]int
+	}{
+		{
+			name:    "ball moves",
+			ball:    PongBallState{20, 10, 1, 1},
+			expBall: PongBallState{21, 11, 1, 1},
+		},
+		{
+			name:    "ball bounces off the top wall",
+			ball:    PongBallState{20, 2, 1, -1},
+			expBall: PongBallState{21, 3, 1, 1},
+		},
+		{
+			name:    "ball bounces off the bottom wall",
+			ball:    PongBallState{20, 17, 1, 1},
+			expBall: PongBallState{21, 16, 1, -1},
+		},
+		{
+			name:    "ball bounces straight back off the middle of a paddle",
+			ball:    PongBallState{35, 9, 1, 1},
+			expBall: PongBallState{34, 9, -1, 1},
+		},
+		{
+			name:    "ball bounces off the edge of a paddle at an angle",
+			ball:    PongBallState{35, 9, 1, -1},
+			expBall: PongBallState{34, 9, -1, -1},
+		},
+		{
+			name:    "right player scores past the left wall",
+			ball:    PongBallState{2, 10, -1, 1},
+			expBall: PongBallState{20, 10, -1, 1},
+			scores:  map[string]int{"a": 0, "b": 1},
+		},
+		{
+			name:    "left player scores past the right wall",
+			ball:    PongBallState{37, 10, 1, 1},
+			expBall: PongBallState{20, 10, -1, 1},
+			scores:  map[string]int{"a": 1, "b": 0},
+		},
+		{
+			name:    "paddles move",
+			ball:    PongBallState{20, 10, 1, 1},
+			paddles: map[string]PongPaddleState{"a": {Y: 8, Direction: PongUp}, "b": {Y: 8, Direction: PongDown}},
+			expBall: PongBallState{21, 11, 1, 1},
+			expY:    map[string]int{"a": 7, "b": 9},
+			expDir:  map[string]PongDirection{"a": PongUp, "b": PongDown},
+		},
+		{
+			name:    "paddles stop at the walls",
+			ball:    PongBallState{20, 10, 1, 1},
+			paddles: map[string]PongPaddleState{"a": {Y: 2, Direction: PongUp}, "b": {Y: 14, Direction: PongDown}},
+			expBall: PongBallState{21, 11, 1, 1},
+			expY:    map[string]int{"a": 2, "b": 14},
+			expDir:  map[string]PongDirection{"a": PongStop, "b": PongStop},
+		},
+	}
+
+	for _, test := range tests {
+		state := newPongTestState()
+		state.Ball = test.ball
+
+		for playerID, moved := range test.paddles {
+			paddle := state.Paddles[playerID]
+			paddle.Y = moved.Y
+			paddle.Direction = moved.Direction
+			state.Paddles[playerID] = paddle
+		}
+
+		state = PongGameLogic{}.Step(state)
+
+		if state.Ball != test.expBall {
+			t.Errorf("%s: expected ball %+v, got %+v", test.name, test.expBall, state.Ball)
+		}
+
+		for playerID, y := range test.expY {
+			if paddle := state.Paddles[playerID]; paddle.Y != y || paddle.Direction != test.expDir[playerID] {
+				t.Errorf("%s: expected paddle %s at %d moving %v, got %+v", test.name, playerID, y, test.expDir[playerID], paddle)
+			}
+		}
+
+		scores := test.scores
+		if scores == nil {
+			scores = map[string]int{"a": 0, "b": 0}
+		}
+
+		for playerID, score := range scores {
+			if state.Scores[playerID] != score {
+				t.Errorf("%s: expected %s to have %d points, got %d", test.name, playerID, score, state.Scores[playerID])
+			}
+		}
+	}
+}
+
+func TestPongIsOver(t *testing.T) {
+	tests := []struct {
+		name      string
+		playerIDs []string
+		scores    map[string]int
+		over      bool
+		winner    string
+	}{
+		{"single player", []string{"a"}, nil, true, NoFriendsWinner},
+		{"no one at the winning score", []string{"a", "b"}, map[string]int{"a": PONG_WIN_SCORE - 1, "b": 2}, false, ""},
+		{"left player wins", []string{"a", "b"}, map[string]int{"a": PONG_WIN_SCORE, "b": 2}, true, "a"},
+		{"right player wins", []string{"a", "b"}, map[string]int{"a": 3, "b": PONG_WIN_SCORE}, true, "b"},
+	}
+
+	for _, test := range tests {
+		state := PongGameLogic{}.InitialState(test.playerIDs, pongTestWidth, pongTestHeight)
+
+		for playerID, score := range test.scores {
+			state.Scores[playerID] = score
+		}
+
+		if over, winner := (PongGameLogic{}).IsOver(state); over != test.over || winner != test.winner {
+			t.Errorf("%s: expected (%v, %q), got (%v, %q)", test.name, test.over, test.winner, over, winner)
+		}
+	}
+}
+
+func TestPongInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		current PongDirection
+		key     tcell.Key
+		exp     PongDirection
+		ok      bool
+	}{
+		{"up starts moving up", PongStop, tcell.KeyUp, PongUp, true},
+		{"up while moving up is ignored", PongUp, tcell.KeyUp, PongUp, false},
+		{"up while moving down stops", PongDown, tcell.KeyUp, PongStop, true},
+		{"down starts moving down", PongStop, tcell.KeyDown, PongDown, true},
+		{"down while moving up stops", PongUp, tcell.KeyDown, PongStop, true},
+		{"other keys are ignored", PongStop, tcell.KeyLeft, PongStop, false},
+	}
+
+	for _, test := range tests {
+		state := newPongTestState()
+		paddle := state.Paddles["a"]
+		paddle.Direction = test.current
+		state.Paddles["a"] = paddle
+
+		cmd, ok := PongGameLogic{}.Input(state, "a", tcell.NewEventKey(test.key, 0, tcell.ModNone))
+
+		if ok != test.ok || (ok && cmd.Direction != test.exp) {
+			t.Errorf("%s: expected (%v, %v), got (%v, %v)", test.name, test.exp, test.ok, cmd.Direction, ok)
+		}
+	}
+}
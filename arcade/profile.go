@@ -1,6 +1,7 @@
 package arcade
 
 import (
+	"arcade/arcade/net"
 	"encoding/json"
 	"io"
 	"os"
@@ -12,6 +13,17 @@ const PROFILE_FILENAME = ".asciiarcade"
 type Profile struct {
 	Name  string `json:"name"`
 	Color string `json:"color"`
+
+	// Private half of the player's long-term keypair
+	PrivateKey []byte `json:"privateKey,omitempty"`
+
+	// ID the player is recognized by across sessions, derived from their
+	// keypair. See net.Identity.PlayerID.
+	PlayerID string `json:"playerId,omitempty"`
+
+	// Distributors to connect to, in the order they're tried. The defaults
+	// are used if there are none.
+	Distributors []string `json:"distributors,omitempty"`
 }
 
 func LoadProfile() (*Profile, error) {
@@ -44,6 +56,18 @@ func LoadProfile() (*Profile, error) {
 	return p, nil
 }
 
+// LocalProfile returns what the rest of a lobby sees of our profile.
+func LocalProfile() PlayerProfile {
+	local := PlayerProfile{PlayerID: arcade.Identity.PlayerID()}
+
+	if profile, err := LoadProfile(); err == nil {
+		local.Name = profile.Name
+		local.Color = profile.Color
+	}
+
+	return local
+}
+
 func (p *Profile) Save() error {
 	homeDir, err := os.UserHomeDir()
 
@@ -58,9 +82,58 @@ func (p *Profile) Save() error {
 		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// The profile holds the player's private key, so keep it to ourselves
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of profiles saved before keys were added
+	if err := os.Chmod(configPath, 0600); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// LoadIdentity returns the player's long-term keys from their profile. Players
+// without keys get new ones, which are saved to the profile if there is one,
+// or when it's created otherwise, along with the player ID that goes with them.
+func LoadIdentity() (*net.Identity, error) {
+	profile, err := LoadProfile()
+
+	if err == nil && profile.PrivateKey != nil {
+		identity, err := net.NewIdentity(profile.PrivateKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Profiles saved before player IDs were added don't have one yet
+		if profile.PlayerID != identity.PlayerID() {
+			profile.PlayerID = identity.PlayerID()
+
+			if err := profile.Save(); err != nil {
+				return nil, err
+			}
+		}
+
+		return identity, nil
+	}
+
+	identity, err := net.GenerateIdentity()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if profile != nil {
+		profile.PrivateKey = identity.PrivateKey
+		profile.PlayerID = identity.PlayerID()
+
+		if err := profile.Save(); err != nil {
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
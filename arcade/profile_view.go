@@ -30,6 +30,9 @@ func NewProfileView(mgr *ViewManager) *ProfileView {
 			profile := &Profile{
 				Name:  v.nameField.value,
 				Color: v.colorPicker.SelectedColor(),
+
+				PrivateKey: arcade.Identity.PrivateKey,
+				PlayerID:   arcade.Identity.PlayerID(),
 			}
 			profile.Save()
 
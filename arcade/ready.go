@@ -0,0 +1,26 @@
+package arcade
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// ReadyMessage is sent to the host when a player says they're ready to start,
+// or no longer are. It counts for the sender.
+type ReadyMessage struct {
+	message.Message
+	LobbyID string
+	Ready   bool
+}
+
+func NewReadyMessage(lobbyID string, ready bool) *ReadyMessage {
+	return &ReadyMessage{
+		Message: message.Message{Type: "ready"},
+		LobbyID: lobbyID,
+		Ready:   ready,
+	}
+}
+
+func (m ReadyMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,128 @@
+package arcade
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	REJOIN_FILENAME   = ".asciiarcade-rejoin"
+	RAFT_STATE_DIR    = ".asciiarcade-games"
+	rejoinGracePeriod = 5 * time.Minute
+)
+
+// RejoinInfo is saved while a game is running, so that a player whose client
+// crashes can restart with the same ID and pick the game back up.
+type RejoinInfo struct {
+	ServerID  string
+	IDSalt    string
+	Lobby     *Lobby
+	StatePath string
+	SavedAt   time.Time
+}
+
+// LoadRejoinInfo returns the game the player was in when their client last
+// exited, if they were last in it recently enough for it to still be running.
+func LoadRejoinInfo() (*RejoinInfo, error) {
+	info, err := readRejoinInfo()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the Raft state is written all through the game, so it tells when the
+	// player was last in it
+	lastPlayed := info.SavedAt
+
+	if stat, err := os.Stat(info.StatePath); err == nil && stat.ModTime().After(lastPlayed) {
+		lastPlayed = stat.ModTime()
+	}
+
+	if time.Since(lastPlayed) > rejoinGracePeriod {
+		return nil, fmt.Errorf("game is too old to rejoin")
+	}
+
+	return info, nil
+}
+
+func readRejoinInfo() (*RejoinInfo, error) {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path.Join(homeDir, REJOIN_FILENAME))
+
+	if err != nil {
+		return nil, err
+	}
+
+	info := &RejoinInfo{}
+
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (info *RejoinInfo) Save() error {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return err
+	}
+
+	info.SavedAt = time.Now()
+	data, err := json.Marshal(info)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join(homeDir, REJOIN_FILENAME), data, 0644)
+}
+
+// ClearRejoinInfo removes the rejoin file and the Raft state it points to,
+// once the game is over.
+func ClearRejoinInfo() error {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return err
+	}
+
+	if info, err := readRejoinInfo(); err == nil {
+		os.Remove(info.StatePath)
+	}
+
+	return os.Remove(path.Join(homeDir, REJOIN_FILENAME))
+}
+
+// raftStatePath returns the file holding a player's Raft state for a match.
+// Lobbies are reused for rematches, so the number of games played tells
+// matches apart.
+func raftStatePath(lobby *Lobby, playerID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	stateDir := path.Join(homeDir, RAFT_STATE_DIR)
+
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return "", err
+	}
+
+	lobby.mu.RLock()
+	defer lobby.mu.RUnlock()
+
+	id := playerID[:int(math.Min(8, float64(len(playerID))))]
+	return path.Join(stateDir, fmt.Sprintf("%s-%d-%s.raft", lobby.ID, lobby.GamesPlayed, id)), nil
+}
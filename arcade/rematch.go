@@ -0,0 +1,27 @@
+package arcade
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// RematchMessage is sent to the host when a player votes for, or withdraws
+// their vote for, another game with the same lobby. The vote counts for the
+// sender.
+type RematchMessage struct {
+	message.Message
+	LobbyID string
+	Vote    bool
+}
+
+func NewRematchMessage(lobbyID string, vote bool) *RematchMessage {
+	return &RematchMessage{
+		Message: message.Message{Type: "rematch"},
+		LobbyID: lobbyID,
+		Vote:    vote,
+	}
+}
+
+func (m RematchMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
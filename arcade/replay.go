@@ -0,0 +1,163 @@
+package arcade
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"time"
+)
+
+const REPLAY_DIRNAME = ".asciiarcade-replays"
+
+// Replay is everything needed to play a match back: the initial state and
+// the committed commands, stamped with the timestep they were committed at.
+type Replay[GS any, CMD any] struct {
+	GameType       string
+	GameID         string
+	Name           string
+	PlayerIDs      []string
+	Me             string
+	Winner         string
+	TimestepPeriod int
+	RecordedAt     time.Time
+
+	// Timestep of the initial state. Peers that caught up from a snapshot only
+	// have the match from this point on.
+	StartTimestep int
+
+	InitialState GS
+	Commands     []GameCommand[CMD]
+}
+
+// Save writes the replay to the replay directory in the user's home directory
+// and returns the path of the new file.
+func (r *Replay[GS, CMD]) Save() (string, error) {
+	homeDir, err := os.UserHomeDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	replayDir := path.Join(homeDir, REPLAY_DIRNAME)
+
+	if err := os.MkdirAll(replayDir, 0755); err != nil {
+		return "", err
+	}
+
+	if r.RecordedAt.IsZero() {
+		r.RecordedAt = time.Now()
+	}
+
+	id := r.GameID[:int(math.Min(8, float64(len(r.GameID))))]
+	replayPath := path.Join(replayDir, fmt.Sprintf("%s-%s-%s.json", r.GameType, r.RecordedAt.Format("20060102-150405"), id))
+
+	data, err := json.Marshal(r)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(replayPath, data, 0644); err != nil {
+		return "", err
+	}
+
+	return replayPath, nil
+}
+
+// LoadReplay decodes a replay saved by Save, rejecting replays that can't be
+// played back.
+func LoadReplay[GS any, CMD any](data []byte) (*Replay[GS, CMD], error) {
+	replay := &Replay[GS, CMD]{}
+
+	if err := json.Unmarshal(data, replay); err != nil {
+		return nil, err
+	}
+
+	if replay.TimestepPeriod <= 0 {
+		return nil, fmt.Errorf("replay has no timestep period")
+	}
+
+	return replay, nil
+}
+
+// Frames plays the committed commands on top of the initial state and returns
+// the state at every timestep, as it was shown during the match.
+func (r *Replay[GS, CMD]) Frames(logic GameLogic[GS, CMD]) []GS {
+	committedState := copyGameState(r.InitialState)
+	committedTimestep := r.StartTimestep - 1
+
+	workingState := copyGameState(committedState)
+	frames := []GS{copyGameState(workingState)}
+
+	lastTimestep := r.StartTimestep
+	if len(r.Commands) > 0 {
+		lastTimestep = r.Commands[len(r.Commands)-1].Timestep
+	}
+
+	i := 0
+	for t := r.StartTimestep + 1; ; t++ {
+		applied := false
+
+		for i < len(r.Commands) && r.Commands[i].Timestep < t {
+			cmd := r.Commands[i]
+			committedState = applyCommittedCommand(logic, committedState, committedTimestep, cmd)
+			committedTimestep = cmd.Timestep
+
+			applied = true
+			i++
+		}
+
+		if applied {
+			workingState = stepGame(logic, copyGameState(committedState), t-committedTimestep-1)
+		} else {
+			workingState = stepGame(logic, workingState, 1)
+		}
+
+		frames = append(frames, copyGameState(workingState))
+
+		if over, _ := logic.IsOver(workingState); i == len(r.Commands) && (over || t > lastTimestep) {
+			break
+		}
+	}
+
+	return frames
+}
+
+// NewReplayViewFromFile loads a replay of any game type and returns a view
+// that plays it back.
+func NewReplayViewFromFile(mgr *ViewManager, replayPath string) (View, error) {
+	data, err := os.ReadFile(replayPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		GameType string
+	}
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.GameType {
+	case Tron:
+		return loadReplayView[TronGameState, TronCommand](mgr, data, TronGameLogic{})
+	case Pong:
+		return loadReplayView[PongGameState, PongCommand](mgr, data, PongGameLogic{})
+	}
+
+	return nil, fmt.Errorf("unknown game type %q", header.GameType)
+}
+
+func loadReplayView[GS any, CMD any](mgr *ViewManager, data []byte, logic GameLogic[GS, CMD]) (View, error) {
+	replay, err := LoadReplay[GS, CMD](data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayView(mgr, nil, logic, replay), nil
+}
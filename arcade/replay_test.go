@@ -0,0 +1,126 @@
+package arcade
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// counterState moves a single position along by its velocity every timestep,
+// which is simple enough to work out every frame of a replay by hand.
+type counterState struct {
+	Position int
+	Velocity int
+	Steps    int
+}
+
+type counterCommand struct {
+	Velocity int
+}
+
+const counterGameLength = 10
+
+type counterGameLogic struct{}
+
+func (counterGameLogic) InitialState(playerIDs []string, width, height int) counterState {
+	return counterState{Velocity: 1}
+}
+
+func (counterGameLogic) ApplyCommand(state counterState, playerID string, cmd counterCommand) counterState {
+	state.Velocity = cmd.Velocity
+	return state
+}
+
+func (counterGameLogic) Step(state counterState) counterState {
+	state.Position += state.Velocity
+	state.Steps++
+	return state
+}
+
+func (counterGameLogic) IsOver(state counterState) (bool, string) {
+	return state.Steps >= counterGameLength, "a"
+}
+
+func (counterGameLogic) Input(state counterState, playerID string, ev *tcell.EventKey) (counterCommand, bool) {
+	return counterCommand{}, false
+}
+
+func (counterGameLogic) Render(s *Screen, state counterState, me string, debug bool) {}
+
+func newTestReplay() *Replay[counterState, counterCommand] {
+	return &Replay[counterState, counterCommand]{
+		GameType:       "counter",
+		GameID:         "game",
+		PlayerIDs:      []string{"a"},
+		Me:             "a",
+		Winner:         "a",
+		TimestepPeriod: 50,
+		InitialState:   counterGameLogic{}.InitialState([]string{"a"}, 0, 0),
+		Commands: []GameCommand[counterCommand]{
+			{ID: "1", Type: GameMoveCmd, Timestep: 3, PlayerID: "a", Data: counterCommand{Velocity: 2}},
+			{ID: "2", Type: GameEndCmd, Timestep: counterGameLength, PlayerID: "a", Winner: "a"},
+		},
+	}
+}
+
+func TestLoadReplay(t *testing.T) {
+	data, err := json.Marshal(newTestReplay())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := LoadReplay[counterState, counterCommand](data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replay.TimestepPeriod != 50 || len(replay.Commands) != 2 || replay.Commands[0].Data.Velocity != 2 {
+		t.Fatalf("replay didn't survive saving and loading: %+v", replay)
+	}
+}
+
+func TestLoadReplayRejectsMissingTimestepPeriod(t *testing.T) {
+	for _, period := range []int{0, -50} {
+		replay := newTestReplay()
+		replay.TimestepPeriod = period
+
+		data, err := json.Marshal(replay)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadReplay[counterState, counterCommand](data); err == nil {
+			t.Fatalf("expected a replay with timestep period %d to be rejected", period)
+		}
+	}
+
+	if _, err := LoadReplay[counterState, counterCommand]([]byte(`{"GameType": "counter"}`)); err == nil {
+		t.Fatal("expected a replay without a timestep period to be rejected")
+	}
+}
+
+func TestReplayFrames(t *testing.T) {
+	frames := newTestReplay().Frames(counterGameLogic{})
+
+	// one step a timestep until the command at timestep 3 speeds it up
+	for i := 0; i <= counterGameLength; i++ {
+		expected := i
+		if i > 3 {
+			expected = 3 + 2*(i-3)
+		}
+
+		if frames[i].Position != expected || frames[i].Steps != i {
+			t.Fatalf("frame %d: expected position %d after %d steps, got %+v", i, expected, i, frames[i])
+		}
+	}
+
+	last := frames[len(frames)-1]
+
+	if over, _ := (counterGameLogic{}).IsOver(last); !over || last.Position != 17 {
+		t.Fatalf("expected the replay to end with the game over at position 17, got %+v", last)
+	}
+}
@@ -0,0 +1,185 @@
+package arcade
+
+import (
+	"arcade/arcade/net"
+	"encoding"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+var replaySpeeds = []float64{0.25, 0.5, 1, 2, 4, 8}
+
+var replayFooter = "[Space] pause  [←/→] step  [↑/↓] speed  [PgUp/PgDn] seek  [Q] quit"
+
+// ReplayView plays back a recorded match. Every frame is computed up front, so
+// seeking anywhere in the match is instant.
+type ReplayView[GS any, CMD any] struct {
+	View
+	mgr *ViewManager
+
+	logic  GameLogic[GS, CMD]
+	replay *Replay[GS, CMD]
+
+	// lobby to return to, or nil when the replay was opened from a file
+	lobby *Lobby
+
+	mu       sync.RWMutex
+	frames   []GS
+	frame    int
+	paused   bool
+	speedInd int
+
+	stopTickerCh chan bool
+}
+
+func NewReplayView[GS any, CMD any](mgr *ViewManager, lobby *Lobby, logic GameLogic[GS, CMD], replay *Replay[GS, CMD]) *ReplayView[GS, CMD] {
+	return &ReplayView[GS, CMD]{
+		mgr:          mgr,
+		logic:        logic,
+		replay:       replay,
+		lobby:        lobby,
+		speedInd:     2,
+		stopTickerCh: make(chan bool),
+	}
+}
+
+func (v *ReplayView[GS, CMD]) Init() {
+	v.frames = v.replay.Frames(v.logic)
+
+	go func() {
+		for {
+			v.mu.RLock()
+			period := time.Duration(float64(v.replay.TimestepPeriod)/replaySpeeds[v.speedInd]) * time.Millisecond
+			v.mu.RUnlock()
+
+			select {
+			case <-time.After(period):
+				v.mu.Lock()
+				if !v.paused && v.frame < len(v.frames)-1 {
+					v.frame++
+				}
+				v.mu.Unlock()
+
+				v.mgr.RequestRender()
+			case <-v.stopTickerCh:
+				return
+			}
+		}
+	}()
+}
+
+func (v *ReplayView[GS, CMD]) ProcessEvent(ev interface{}) {
+	switch ev := ev.(type) {
+	case *tcell.EventKey:
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		// seek by five seconds of game time
+		seekFrames := 5000 / v.replay.TimestepPeriod
+
+		switch ev.Key() {
+		case tcell.KeyLeft:
+			v.paused = true
+			v.seek(v.frame - 1)
+		case tcell.KeyRight:
+			v.paused = true
+			v.seek(v.frame + 1)
+		case tcell.KeyUp:
+			if v.speedInd < len(replaySpeeds)-1 {
+				v.speedInd++
+			}
+		case tcell.KeyDown:
+			if v.speedInd > 0 {
+				v.speedInd--
+			}
+		case tcell.KeyPgUp:
+			v.seek(v.frame - seekFrames)
+		case tcell.KeyPgDn:
+			v.seek(v.frame + seekFrames)
+		case tcell.KeyHome:
+			v.seek(0)
+		case tcell.KeyEnd:
+			v.seek(len(v.frames) - 1)
+		case tcell.KeyRune:
+			switch ev.Rune() {
+			case ' ':
+				if v.frame == len(v.frames)-1 {
+					// restart from the beginning once the replay is over
+					v.frame = 0
+					v.paused = false
+				} else {
+					v.paused = !v.paused
+				}
+			case 'q':
+				go v.exit()
+			}
+		}
+	}
+}
+
+func (v *ReplayView[GS, CMD]) seek(frame int) {
+	if frame < 0 {
+		frame = 0
+	} else if frame > len(v.frames)-1 {
+		frame = len(v.frames) - 1
+	}
+
+	v.frame = frame
+}
+
+func (v *ReplayView[GS, CMD]) exit() {
+	if v.lobby != nil {
+		v.mgr.SetView(NewLobbyView(v.mgr, v.lobby))
+	} else {
+		v.mgr.SetView(NewSplashView(v.mgr))
+	}
+}
+
+func (v *ReplayView[GS, CMD]) ProcessMessage(from *net.Client, p interface{}) interface{} {
+	return nil
+}
+
+func (v *ReplayView[GS, CMD]) Render(s *Screen) {
+	s.ClearContent()
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	displayWidth, displayHeight := s.displaySize()
+	boxStyle := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorTeal)
+	s.DrawBox(1, 1, displayWidth-2, displayHeight-2, boxStyle, false)
+
+	v.mgr.RLock()
+	showDebug := v.mgr.showDebug
+	v.mgr.RUnlock()
+
+	v.logic.Render(s, v.frames[v.frame], v.replay.Me, showDebug)
+
+	status := fmt.Sprintf(" REPLAY %d/%d %gx ", v.frame, len(v.frames)-1, replaySpeeds[v.speedInd])
+	if v.paused {
+		status += "PAUSED "
+	}
+	s.DrawText(3, 1, boxStyle, status)
+
+	if v.frame == len(v.frames)-1 {
+		if v.replay.Winner == v.replay.Me {
+			s.DrawBlockText(CenterX, CenterY, boxStyle, "YOU WON", true)
+		} else {
+			s.DrawBlockText(CenterX, CenterY, boxStyle, "GAME OVER", true)
+		}
+	}
+
+	s.DrawText((displayWidth-utf8.RuneCountInString(replayFooter))/2, displayHeight-1, boxStyle, replayFooter)
+}
+
+func (v *ReplayView[GS, CMD]) GetHeartbeatMetadata() encoding.BinaryMarshaler {
+	return nil
+}
+
+func (v *ReplayView[GS, CMD]) Unload() {
+	close(v.stopTickerCh)
+}
@@ -4,17 +4,20 @@ import (
 	"arcade/arcade/message"
 	"arcade/arcade/multicast"
 	"arcade/arcade/net"
+	"context"
 	"fmt"
-	"reflect"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/xtaci/kcp-go/v5"
 )
 
 const timeoutInterval = 2500 * time.Millisecond
 const heartbeatInterval = 250 * time.Millisecond
+const heartbeatTimeout = 2 * heartbeatInterval
+
+// How long to wait for replies to requests to other players and distributors
+const requestTimeout = 500 * time.Millisecond
 const rttAverageNum = 10
 
 type ConnectedClientInfo struct {
@@ -47,20 +50,39 @@ type Server struct {
 	Addr string
 	ID   string
 
+	// Salt the ID was derived from, along with the player's identity
+	IDSalt string
+
 	connectedClients sync.Map
+
+	// Lobby we host and keep listed with distributors, if any
+	published *Lobby
+
+	// Conversation in the lobby we're in
+	Chat *ChatLog
 }
 
 // NewServer creates the server with a given address.
 func NewServer(addr string, port int, distributor bool, mgr *ViewManager) *Server {
-	id := uuid.NewString()
-	net := net.NewNetwork(id, port, distributor)
+	return NewServerWithSalt(uuid.NewString(), addr, port, distributor, mgr)
+}
+
+// NewServerWithSalt creates the server with a given address and ID salt, so
+// that a player can come back with the same ID after restarting.
+func NewServerWithSalt(salt string, addr string, port int, distributor bool, mgr *ViewManager) *Server {
+	id := arcade.Identity.SessionID(salt)
+
+	network := net.NewNetwork(arcade.Identity, salt, port, distributor, arcade.Transport)
+	network.SetCodec(arcade.Codec)
 
 	s := &Server{
 		mgr:              mgr,
 		Addr:             addr,
-		Network:          net,
+		Network:          network,
 		ID:               id,
+		IDSalt:           salt,
 		connectedClients: sync.Map{},
+		Chat:             NewChatLog(),
 	}
 
 	message.AddListener(message.Listener{
@@ -69,7 +91,11 @@ func NewServer(addr string, port int, distributor bool, mgr *ViewManager) *Serve
 		Handle:      s.handleMessage,
 	})
 
+	net.Handle(network, s.handleDisconnect)
+	net.Handle(network, s.handleHeartbeat)
+
 	go s.startHeartbeats()
+	go s.refreshLobbies()
 
 	return s
 }
@@ -92,13 +118,14 @@ func (s *Server) startHeartbeats() {
 			metadata := s.mgr.GetHeartbeatMetadata()
 
 			go func(clientID string) {
+				ctx, cancel := context.WithTimeout(context.Background(), heartbeatTimeout)
+				defer cancel()
+
 				start := time.Now()
-				res, err := s.Network.SendAndReceive(client, NewHeartbeatMessage(0, metadata))
+				_, err := net.Call[*HeartbeatMessage, *HeartbeatReplyMessage](ctx, s.Network, client, NewHeartbeatMessage(0, metadata))
 				end := time.Now()
 
-				_, ok := res.(*HeartbeatReplyMessage)
-
-				if !ok || err != nil {
+				if err != nil {
 					return
 				}
 
@@ -107,6 +134,9 @@ func (s *Server) startHeartbeats() {
 					client.RTTs = append(client.RTTs, end.Sub(start))
 					client.LastHeartbeat = time.Now()
 					s.connectedClients.Store(clientID, client)
+
+					// Route over the links with the lowest latency
+					s.Network.ReportRTT(clientID, client.GetMeanRTT())
 				}
 			}(clientID)
 
@@ -122,6 +152,9 @@ func (s *Server) BeginHeartbeats(clientID string) {
 		LastHeartbeat: time.Now(),
 		RTTs:          []time.Duration{},
 	})
+
+	// Talk to the client directly if we're behind a distributor
+	go s.Network.PunchThrough(clientID)
 }
 
 func (s *Server) EndHeartbeats(clientID string) {
@@ -135,6 +168,21 @@ func (s *Server) EndAllHeartbeats() {
 	})
 }
 
+// SetUsernames names the clients in a lobby after the profiles they joined
+// with.
+func (s *Server) SetUsernames(lobby *Lobby) {
+	lobby.mu.RLock()
+	defer lobby.mu.RUnlock()
+
+	for clientID, profile := range lobby.Profiles {
+		if client, ok := s.Network.GetClient(clientID); ok {
+			client.Lock()
+			client.Username = profile.Name
+			client.Unlock()
+		}
+	}
+}
+
 func (s *Server) GetHeartbeatClients() sync.Map {
 	return s.connectedClients
 }
@@ -142,83 +190,58 @@ func (s *Server) GetHeartbeatClients() sync.Map {
 func (s *Server) handleMessage(client, msg interface{}) interface{} {
 	c := client.(*net.Client)
 
-	baseMsg := reflect.ValueOf(msg).Elem().FieldByName("Message").Interface().(message.Message)
-
-	// Ping messages may not have a recipient ID set
-	if baseMsg.RecipientID == "" {
-		baseMsg.RecipientID = s.ID
+	// Ignore messages that arrived on another server's network
+	if c.Delegate != s.Network {
+		return nil
 	}
 
-	// Signal message received if necessary
-	s.Network.SignalReceived(baseMsg.MessageID, msg)
-
-	if arcade.Distributor {
-		fmt.Println(msg)
-		fmt.Printf("Received '%s' from %s\n", baseMsg.Type, baseMsg.SenderID[:4])
+	baseMsg := msg.(message.Envelope).Header()
 
-		if baseMsg.Type == "error" {
-			fmt.Println(msg)
-		}
+	// Messages the network handles, or that have handlers registered in
+	// NewServerWithSalt, don't need to go any further
+	switch msg.(type) {
+	case *net.PingMessage, *net.PongMessage, *net.RoutingMessage, *net.PunchRequestMessage, *net.PunchMessage, *net.AckMessage:
+		return nil
 	}
 
-	// Process message and return response
-	switch msg := msg.(type) {
-	case *DisconnectMessage:
-		s.Network.Disconnect(c.ID)
-	case *net.PingMessage, *net.PongMessage, *net.RoutingMessage:
-		break
-	default:
-		if baseMsg.RecipientID != s.ID {
-			if arcade.Distributor {
-				fmt.Println("Forwarding message to", baseMsg.RecipientID[:4])
-				fmt.Println(msg)
-			}
-
-			s.RLock()
-			recipient, ok := s.Network.GetClient(baseMsg.RecipientID)
-			s.RUnlock()
+	// Ping messages may not have a recipient ID set
+	if baseMsg.RecipientID != "" && baseMsg.RecipientID != s.ID {
+		s.RLock()
+		recipient, ok := s.Network.GetClient(baseMsg.RecipientID)
+		s.RUnlock()
 
-			if ok {
-				s.Network.SendRaw(recipient, msg)
-				return nil
-			} else {
-				return NewErrorMessage("invalid recipient")
-			}
-		} else {
-			if arcade.Distributor {
-				fmt.Println(msg)
-				panic("Recipient: " + baseMsg.RecipientID + ", self: " + s.ID)
-			}
+		if !ok {
+			return net.NewRejectMessage("invalid recipient")
+		}
 
-			switch msg := msg.(type) {
-			case *HeartbeatMessage:
-				if cli, ok := s.connectedClients.Load(msg.SenderID); ok {
-					client := cli.(ConnectedClientInfo)
-					client.LastHeartbeat = time.Now()
-					s.connectedClients.Store(msg.SenderID, client)
+		s.Network.SendRaw(recipient, msg)
+		return nil
+	}
 
-					c.Lock()
-					c.Distance = float64(client.GetMeanRTT().Milliseconds())
-					c.Unlock()
-				}
+	return s.mgr.ProcessMessage(c, msg)
+}
 
-				// Send heartbeat metadata to view
-				s.mgr.ProcessEvent(NewHeartbeatEvent(msg.Metadata))
+func (s *Server) handleDisconnect(from *net.Client, msg *DisconnectMessage) (interface{}, error) {
+	s.Network.Disconnect(msg.SenderID)
+	return nil, nil
+}
 
-				// Reply to heartbeat
-				return NewHeartbeatReplyMessage(msg.Seq)
-			default:
-				return s.mgr.ProcessMessage(c, msg)
-			}
-		}
+func (s *Server) handleHeartbeat(from *net.Client, msg *HeartbeatMessage) (interface{}, error) {
+	if cli, ok := s.connectedClients.Load(msg.SenderID); ok {
+		client := cli.(ConnectedClientInfo)
+		client.LastHeartbeat = time.Now()
+		s.connectedClients.Store(msg.SenderID, client)
 	}
 
-	return nil
+	// Send heartbeat metadata to view
+	s.mgr.ProcessEvent(NewHeartbeatEvent(msg.Metadata))
+
+	return NewHeartbeatReplyMessage(msg.Seq), nil
 }
 
 // Start starts listening for connections on a given address.
 func (s *Server) Start(noLAN bool) error {
-	listener, err := kcp.Listen(s.Addr)
+	listener, err := s.Network.Listen(s.Addr)
 
 	if err != nil {
 		panic(err)
@@ -0,0 +1,70 @@
+package arcade
+
+import (
+	"arcade/arcade/message"
+	"encoding/json"
+)
+
+// SpectateMessage is sent by a spectator to every player in a running game,
+// so that each of their Raft peers adds it as a learner.
+type SpectateMessage struct {
+	message.Message
+	PlayerID string
+	LobbyID  string
+}
+
+type SpectateReplyMessage struct {
+	message.Message
+}
+
+// StopSpectatingMessage is sent by a spectator leaving a game, so that the
+// players stop sending it the log. It stays in the lobby.
+type StopSpectatingMessage struct {
+	message.Message
+	PlayerID string
+	LobbyID  string
+}
+
+// canSpectate returns true if a spectator asking to follow the game sent the
+// request itself, and was let into the lobby by the host, which checks the
+// join code of private lobbies.
+func canSpectate(lobby *Lobby, senderID string, p *SpectateMessage) bool {
+	lobby.mu.RLock()
+	defer lobby.mu.RUnlock()
+
+	return lobby.ID == p.LobbyID && senderID == p.PlayerID && containsID(lobby.SpectatorIDs, p.PlayerID)
+}
+
+func NewSpectateMessage(playerID string, lobbyID string) *SpectateMessage {
+	return &SpectateMessage{
+		Message:  message.Message{Type: "spectate"},
+		PlayerID: playerID,
+		LobbyID:  lobbyID,
+	}
+}
+
+func NewSpectateReplyMessage() *SpectateReplyMessage {
+	return &SpectateReplyMessage{
+		Message: message.Message{Type: "spectate_reply"},
+	}
+}
+
+func NewStopSpectatingMessage(playerID string, lobbyID string) *StopSpectatingMessage {
+	return &StopSpectatingMessage{
+		Message:  message.Message{Type: "stop_spectating"},
+		PlayerID: playerID,
+		LobbyID:  lobbyID,
+	}
+}
+
+func (m SpectateMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m SpectateReplyMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m StopSpectatingMessage) MarshalBinary() ([]byte, error) {
+	return json.Marshal(m)
+}
@@ -0,0 +1,28 @@
+package arcade
+
+import "testing"
+
+func TestCanSpectate(t *testing.T) {
+	lobby := NewLobby("lobby", true, Tron, 4, "host")
+	lobby.AddPlayer("player")
+	lobby.AddSpectator("spectator")
+
+	tests := []struct {
+		name     string
+		senderID string
+		msg      *SpectateMessage
+		allowed  bool
+	}{
+		{"spectator let in by the host", "spectator", NewSpectateMessage("spectator", lobby.ID), true},
+		{"peer that never joined", "stranger", NewSpectateMessage("stranger", lobby.ID), false},
+		{"peer asking for a spectator", "stranger", NewSpectateMessage("spectator", lobby.ID), false},
+		{"player", "player", NewSpectateMessage("player", lobby.ID), false},
+		{"another lobby", "spectator", NewSpectateMessage("spectator", "other"), false},
+	}
+
+	for _, test := range tests {
+		if allowed := canSpectate(lobby, test.senderID, test.msg); allowed != test.allowed {
+			t.Errorf("%s: expected %v, got %v", test.name, test.allowed, allowed)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package tron holds the rules of Tron. Everything here is deterministic and
+// free of any screen or network dependency, so a game can be stepped forward
+// headlessly from its initial state and a list of moves.
+package tron
+
+import (
+	"math"
+	"sort"
+)
+
+// NoFriendsWinner is reported as the winner of a game with a single player.
+const NoFriendsWinner = "can't win without friends :^)"
+
+// MaxPlayers is the number of players that fit in a collision cell.
+const MaxPlayers = 8
+
+type Direction int64
+
+const (
+	Up Direction = iota
+	Right
+	Down
+	Left
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Up:
+		return "TronUp"
+	case Right:
+		return "TronRight"
+	case Down:
+		return "TronDown"
+	case Left:
+		return "TronLeft"
+	}
+	return "?"
+}
+
+type ClientState struct {
+	Timestep  int
+	Alive     bool
+	Name      string
+	Color     string
+	X         int
+	Y         int
+	Direction Direction
+	PlayerNum int
+}
+
+type GameState struct {
+	Width        int
+	Height       int
+	Collisions   []byte
+	ClientStates map[string]ClientState
+}
+
+type Command struct {
+	Direction Direction
+}
+
+func (c Command) String() string {
+	return c.Direction.String()
+}
+
+// Move is a command issued by a player at a given timestep.
+type Move struct {
+	Timestep int
+	PlayerID string
+	Command
+}
+
+// NewGameState places up to MaxPlayers players at their starting positions on
+// a board of the given size. Players are numbered in the order given.
+func NewGameState(playerIDs []string, width, height int) GameState {
+	clientStates := make(map[string]ClientState)
+	startingPos, startingDir := startingPosAndDir(width, height)
+
+	for i, playerID := range playerIDs {
+		clientStates[playerID] = ClientState{
+			Alive:     true,
+			X:         startingPos[i][0],
+			Y:         startingPos[i][1],
+			Direction: startingDir[i],
+			PlayerNum: i,
+		}
+	}
+
+	return GameState{
+		Width:        width,
+		Height:       height,
+		Collisions:   make([]byte, int(math.Ceil(float64(width*height)/2))),
+		ClientStates: clientStates,
+	}
+}
+
+// ApplyCommand turns a player without advancing time.
+func ApplyCommand(state GameState, playerID string, cmd Command) GameState {
+	clientState, ok := state.ClientStates[playerID]
+
+	if !ok {
+		return state
+	}
+
+	clientState.Direction = cmd.Direction
+	state.ClientStates[playerID] = clientState
+	return state
+}
+
+// Step advances every player by one timestep.
+func Step(state GameState) GameState {
+	return StepPlayers(state, PlayerIDs(state))
+}
+
+// StepPlayers advances only the given players by one timestep, leaving a
+// trail behind them, and then kills anyone who crashed.
+func StepPlayers(state GameState, playerIDs []string) GameState {
+	for _, playerID := range playerIDs {
+		clientState, ok := state.ClientStates[playerID]
+
+		if !ok || !clientState.Alive {
+			continue
+		}
+
+		state.Collisions = SetCollision(state, clientState.X, clientState.Y, clientState.PlayerNum)
+
+		switch clientState.Direction {
+		case Up:
+			clientState.Y -= 1
+		case Right:
+			clientState.X += 1
+		case Down:
+			clientState.Y += 1
+		case Left:
+			clientState.X -= 1
+		}
+
+		state.ClientStates[playerID] = clientState
+	}
+
+	// Find everyone who crashed before killing anyone, so that both players in
+	// a head-on crash die
+	crashed := []string{}
+
+	for _, playerID := range PlayerIDs(state) {
+		if state.ClientStates[playerID].Alive && shouldDie(state, playerID) {
+			crashed = append(crashed, playerID)
+		}
+	}
+
+	for _, playerID := range crashed {
+		clientState := state.ClientStates[playerID]
+		clientState.Alive = false
+		state.ClientStates[playerID] = clientState
+	}
+
+	return state
+}
+
+// Winner returns true once at most one player is left alive, along with the
+// ID of that player. The winner is empty if everyone crashed at once.
+func Winner(state GameState) (bool, string) {
+	if len(state.ClientStates) == 1 {
+		return true, NoFriendsWinner
+	}
+
+	winner := ""
+
+	for _, playerID := range PlayerIDs(state) {
+		if state.ClientStates[playerID].Alive {
+			if winner != "" {
+				return false, ""
+			}
+			winner = playerID
+		}
+	}
+
+	return true, winner
+}
+
+// Simulate steps the state forward by the given number of timesteps, applying
+// each move at the start of its timestep. Moves must be sorted by timestep.
+func Simulate(state GameState, moves []Move, timesteps int) GameState {
+	for t := 0; t < timesteps; t++ {
+		for len(moves) > 0 && moves[0].Timestep <= t {
+			if moves[0].Timestep == t {
+				state = ApplyCommand(state, moves[0].PlayerID, moves[0].Command)
+			}
+			moves = moves[1:]
+		}
+
+		if over, _ := Winner(state); over {
+			break
+		}
+
+		state = Step(state)
+	}
+
+	return state
+}
+
+// CanMoveInDir returns true if a player heading in currentDir is allowed to
+// turn towards proposedDir. Players can only turn left or right.
+func CanMoveInDir(currentDir Direction, proposedDir Direction) bool {
+	if currentDir == Down || currentDir == Up {
+		return proposedDir == Left || proposedDir == Right
+	}
+	if currentDir == Left || currentDir == Right {
+		return proposedDir == Down || proposedDir == Up
+	}
+	return false
+}
+
+// PlayerIDs returns the IDs of all players in a stable order, so that stepping
+// doesn't depend on map iteration order.
+func PlayerIDs(state GameState) []string {
+	playerIDs := make([]string, 0, len(state.ClientStates))
+
+	for playerID := range state.ClientStates {
+		playerIDs = append(playerIDs, playerID)
+	}
+
+	sort.Slice(playerIDs, func(i, j int) bool {
+		return state.ClientStates[playerIDs[i]].PlayerNum < state.ClientStates[playerIDs[j]].PlayerNum
+	})
+
+	return playerIDs
+}
+
+func IsOutOfBounds(state GameState, x int, y int) bool {
+	return x <= 1 || x >= state.Width-2 || y <= 1 || y >= state.Height-2
+}
+
+func SetCollision(state GameState, x int, y int, playerNum int) []byte {
+	collisions := state.Collisions
+	if !IsOutOfBounds(state, x, y) && playerNum < MaxPlayers {
+		ind := y*state.Width + x
+		collisions[ind/2] |= byte(playerNum<<1+1) << ((ind % 2) * 4)
+	}
+	return collisions
+}
+
+// returns bool of collision and player num
+func GetCollision(state GameState, x int, y int) (bool, int) {
+	if !IsOutOfBounds(state, x, y) {
+		ind := y*state.Width + x
+		offset := ((ind % 2) * 4)
+		coll := state.Collisions[ind/2] >> offset
+
+		if coll&1 == 1 {
+			return true, int((coll >> 1) & 7)
+		} else {
+			return false, -1
+		}
+	}
+	return true, -1
+}
+
+func shouldDie(state GameState, playerID string) bool {
+	player := state.ClientStates[playerID]
+
+	if collides, _ := GetCollision(state, player.X, player.Y); collides {
+		return true
+	}
+
+	// Head-on crash: two players moved onto the same cell this timestep
+	for otherID, other := range state.ClientStates {
+		if otherID != playerID && other.Alive && other.X == player.X && other.Y == player.Y {
+			return true
+		}
+	}
+
+	return false
+}
+
+func startingPosAndDir(width, height int) ([][2]int, []Direction) {
+	width -= 1 // account for tron border
+	height -= 1
+	margin := int(math.Round(math.Min(float64(width)/8, float64(height)/8)))
+	return [][2]int{{margin, margin}, {width - margin, height - margin}, {width - margin, margin}, {margin, height - margin}, {width / 2, margin}, {width - margin, height / 2}, {width / 2, height - margin}, {margin, height / 2}}, []Direction{Right, Left, Down, Up, Down, Left, Up, Right}
+}
@@ -0,0 +1,253 @@
+package tron
+
+import "testing"
+
+const (
+	testWidth  = 20
+	testHeight = 12
+)
+
+// newTestState builds a board with players placed explicitly, instead of at
+// their usual starting positions.
+func newTestState(players map[string]ClientState) GameState {
+	state := NewGameState(nil, testWidth, testHeight)
+
+	for playerID, clientState := range players {
+		clientState.Alive = true
+		state.ClientStates[playerID] = clientState
+	}
+
+	return state
+}
+
+func TestNewGameState(t *testing.T) {
+	playerIDs := []string{"a", "b", "c", "d"}
+	state := NewGameState(playerIDs, 80, 24)
+
+	if len(state.ClientStates) != len(playerIDs) {
+		t.Fatalf("expected %d players, got %d", len(playerIDs), len(state.ClientStates))
+	}
+
+	for i, playerID := range playerIDs {
+		clientState := state.ClientStates[playerID]
+
+		if !clientState.Alive || clientState.PlayerNum != i {
+			t.Fatalf("player %s: expected alive with number %d, got %+v", playerID, i, clientState)
+		}
+
+		if IsOutOfBounds(state, clientState.X, clientState.Y) {
+			t.Fatalf("player %s starts out of bounds at (%d, %d)", playerID, clientState.X, clientState.Y)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name    string
+		players map[string]ClientState
+		moves   []Move
+		steps   int
+		alive   map[string]bool
+	}{
+		{
+			name: "open board",
+			players: map[string]ClientState{
+				"a": {X: 4, Y: 4, Direction: Right, PlayerNum: 0},
+				"b": {X: 4, Y: 8, Direction: Right, PlayerNum: 1},
+			},
+			steps: 5,
+			alive: map[string]bool{"a": true, "b": true},
+		},
+		{
+			name: "out of bounds left",
+			players: map[string]ClientState{
+				"a": {X: 3, Y: 4, Direction: Left, PlayerNum: 0},
+				"b": {X: 10, Y: 8, Direction: Right, PlayerNum: 1},
+			},
+			steps: 2,
+			alive: map[string]bool{"a": false, "b": true},
+		},
+		{
+			name: "out of bounds bottom",
+			players: map[string]ClientState{
+				"a": {X: 4, Y: 4, Direction: Up, PlayerNum: 0},
+				"b": {X: 10, Y: testHeight - 4, Direction: Down, PlayerNum: 1},
+			},
+			steps: 2,
+			alive: map[string]bool{"a": true, "b": false},
+		},
+		{
+			name: "head-on into the same cell",
+			players: map[string]ClientState{
+				"a": {X: 8, Y: 5, Direction: Right, PlayerNum: 0},
+				"b": {X: 10, Y: 5, Direction: Left, PlayerNum: 1},
+			},
+			steps: 1,
+			alive: map[string]bool{"a": false, "b": false},
+		},
+		{
+			name: "head-on swapping cells",
+			players: map[string]ClientState{
+				"a": {X: 8, Y: 5, Direction: Right, PlayerNum: 0},
+				"b": {X: 9, Y: 5, Direction: Left, PlayerNum: 1},
+			},
+			steps: 1,
+			alive: map[string]bool{"a": false, "b": false},
+		},
+		{
+			name: "crash into another trail",
+			players: map[string]ClientState{
+				"a": {X: 5, Y: 5, Direction: Right, PlayerNum: 0},
+				"b": {X: 6, Y: 3, Direction: Down, PlayerNum: 1},
+			},
+			// b crosses a's path at (6, 5) after a has already passed it
+			steps: 2,
+			alive: map[string]bool{"a": true, "b": false},
+		},
+		{
+			name: "crash into own trail",
+			players: map[string]ClientState{
+				"a": {X: 5, Y: 5, Direction: Right, PlayerNum: 0},
+				"b": {X: 12, Y: 8, Direction: Right, PlayerNum: 1},
+			},
+			// a turns around in a tight loop back onto its own trail
+			moves: []Move{
+				{1, "a", Command{Down}},
+				{2, "a", Command{Left}},
+				{3, "a", Command{Up}},
+			},
+			steps: 4,
+			alive: map[string]bool{"a": false, "b": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := Simulate(newTestState(tt.players), tt.moves, tt.steps)
+
+			for playerID, alive := range tt.alive {
+				if state.ClientStates[playerID].Alive != alive {
+					t.Errorf("player %s: expected alive=%t, got %t", playerID, alive, !alive)
+				}
+			}
+		})
+	}
+}
+
+func TestStepLeavesTrail(t *testing.T) {
+	state := newTestState(map[string]ClientState{
+		"a": {X: 4, Y: 4, Direction: Right, PlayerNum: 3},
+	})
+
+	state = Step(state)
+
+	if collides, playerNum := GetCollision(state, 4, 4); !collides || playerNum != 3 {
+		t.Fatalf("expected trail of player 3 at (4, 4), got %t, %d", collides, playerNum)
+	}
+
+	if collides, _ := GetCollision(state, 5, 4); collides {
+		t.Fatalf("expected no trail under the player's head")
+	}
+
+	if clientState := state.ClientStates["a"]; clientState.X != 5 || clientState.Y != 4 {
+		t.Fatalf("expected player at (5, 4), got (%d, %d)", clientState.X, clientState.Y)
+	}
+}
+
+func TestWinner(t *testing.T) {
+	tests := []struct {
+		name   string
+		alive  map[string]bool
+		over   bool
+		winner string
+	}{
+		{"everyone alive", map[string]bool{"a": true, "b": true, "c": true}, false, ""},
+		{"two left", map[string]bool{"a": true, "b": false, "c": true}, false, ""},
+		{"last one standing", map[string]bool{"a": false, "b": true, "c": false}, true, "b"},
+		{"everyone crashed", map[string]bool{"a": false, "b": false}, true, ""},
+		{"single player", map[string]bool{"a": true}, true, NoFriendsWinner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewGameState(nil, testWidth, testHeight)
+			i := 0
+
+			for playerID, alive := range tt.alive {
+				state.ClientStates[playerID] = ClientState{Alive: alive, PlayerNum: i}
+				i++
+			}
+
+			over, winner := Winner(state)
+
+			if over != tt.over || winner != tt.winner {
+				t.Fatalf("expected (%t, %q), got (%t, %q)", tt.over, tt.winner, over, winner)
+			}
+		})
+	}
+}
+
+func TestCanMoveInDir(t *testing.T) {
+	tests := []struct {
+		current  Direction
+		proposed Direction
+		ok       bool
+	}{
+		{Up, Left, true},
+		{Up, Right, true},
+		{Up, Down, false},
+		{Up, Up, false},
+		{Left, Up, true},
+		{Left, Right, false},
+	}
+
+	for _, tt := range tests {
+		if ok := CanMoveInDir(tt.current, tt.proposed); ok != tt.ok {
+			t.Errorf("%v -> %v: expected %t, got %t", tt.current, tt.proposed, tt.ok, ok)
+		}
+	}
+}
+
+func TestSimulateIsDeterministic(t *testing.T) {
+	playerIDs := []string{"a", "b", "c"}
+	moves := []Move{
+		{3, "a", Command{Down}},
+		{5, "b", Command{Up}},
+		{5, "c", Command{Right}},
+		{9, "a", Command{Right}},
+	}
+
+	first := Simulate(NewGameState(playerIDs, 80, 24), moves, 30)
+
+	for i := 0; i < 10; i++ {
+		state := Simulate(NewGameState(playerIDs, 80, 24), moves, 30)
+
+		for _, playerID := range playerIDs {
+			if state.ClientStates[playerID] != first.ClientStates[playerID] {
+				t.Fatalf("run %d: player %s diverged: %+v != %+v", i, playerID, state.ClientStates[playerID], first.ClientStates[playerID])
+			}
+		}
+
+		if string(state.Collisions) != string(first.Collisions) {
+			t.Fatalf("run %d: collisions diverged", i)
+		}
+	}
+}
+
+func TestSimulateStopsWhenOver(t *testing.T) {
+	state := newTestState(map[string]ClientState{
+		"a": {X: 3, Y: 4, Direction: Left, PlayerNum: 0},
+		"b": {X: 4, Y: 8, Direction: Right, PlayerNum: 1},
+	})
+
+	state = Simulate(state, nil, 10)
+
+	if over, winner := Winner(state); !over || winner != "b" {
+		t.Fatalf("expected b to win, got (%t, %q)", over, winner)
+	}
+
+	// b should have stopped moving as soon as a crashed
+	if x := state.ClientStates["b"].X; x != 6 {
+		t.Fatalf("expected b to stop at x=6, got %d", x)
+	}
+}
@@ -0,0 +1,260 @@
+package arcade
+
+import (
+	"arcade/arcade/tron"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+const TRON_TIMESTEP_PERIOD = 80
+
+var TRON_COLORS = [8]string{"blue", "red", "green", "purple", "yellow", "orange", "white", "teal"}
+
+func isTronColor(color string) bool {
+	for _, v := range TRON_COLORS {
+		if v == color {
+			return true
+		}
+	}
+
+	return false
+}
+
+// leastUsedColor returns the first color no one has, or if every color is
+// taken, the first one the fewest players share.
+func leastUsedColor(uses map[string]int) string {
+	least := TRON_COLORS[0]
+
+	for _, color := range TRON_COLORS {
+		if uses[color] < uses[least] {
+			least = color
+		}
+	}
+
+	return least
+}
+
+type TronDirection = tron.Direction
+
+const (
+	TronUp    = tron.Up
+	TronRight = tron.Right
+	TronDown  = tron.Down
+	TronLeft  = tron.Left
+)
+
+type TronClientState = tron.ClientState
+type TronGameState = tron.GameState
+type TronCommand = tron.Command
+
+/*
+
+P1 50 Left
+P2 50 Right
+P1 56 Up
+P2 53 Left
+
+
+=== P2 ===
+TIMESTEP: 54
+
+uncommited logs:
+P1 50 Left
+P2 50 Right
+P1 56 Up <-- just arrived
+P2 57 Left
+P2 58 Up
+
+client pred:
+P2 53 Left
+P2 54 Up
+P2 57 Down
+
+
+If higher timestep comes in, shift everything up so that timestep matches, relative
+
+uncommited logs:
+P1 56 Up <-- just arrived
+
+client pred:
+P2 53 Left --> P2 56 Left
+P2 54 Up --> P2 57 Up
+
+NEW TIMESTEP: 57
+
+
+maybe try relative timesteps to uncommitted logs?
+
+reset client prediction at every appendEntries?
+Send an id with each own player move, maintain client prediction up until that move
+*/
+
+// TronGameLogic implements GameLogic for Tron.
+type TronGameLogic struct {
+	// Lobby the players' names and colors come from, if any
+	lobby *Lobby
+}
+
+func NewTronGameView(mgr *ViewManager, lobby *Lobby) *GameView[TronGameState, TronCommand] {
+	return NewGameView[TronGameState, TronCommand](mgr, lobby, TronGameLogic{lobby: lobby}, TRON_TIMESTEP_PERIOD)
+}
+
+// InitialState gives each player the name and color from their profile.
+func (tl TronGameLogic) InitialState(playerIDs []string, width, height int) TronGameState {
+	state := tron.NewGameState(playerIDs, width, height)
+	profiles := gameProfiles(tl.lobby, playerIDs)
+
+	for _, playerID := range playerIDs {
+		profile := profiles[playerID]
+
+		clientState := state.ClientStates[playerID]
+		clientState.Name = profile.Name
+		clientState.Color = profile.Color
+		state.ClientStates[playerID] = clientState
+	}
+
+	return state
+}
+
+func (tl TronGameLogic) ApplyCommand(gameState TronGameState, playerID string, cmd TronCommand) TronGameState {
+	return tron.ApplyCommand(gameState, playerID, cmd)
+}
+
+func (tl TronGameLogic) Step(gameState TronGameState) TronGameState {
+	return tron.Step(gameState)
+}
+
+func (tl TronGameLogic) PredictLocal(gameState TronGameState, playerID string) TronGameState {
+	return tron.StepPlayers(gameState, []string{playerID})
+}
+
+func (tl TronGameLogic) IsOver(gameState TronGameState) (bool, string) {
+	return tron.Winner(gameState)
+}
+
+func (tl TronGameLogic) Input(gameState TronGameState, playerID string, ev *tcell.EventKey) (TronCommand, bool) {
+	var newDir TronDirection
+
+	switch ev.Key() {
+	case tcell.KeyUp:
+		newDir = TronUp
+	case tcell.KeyRight:
+		newDir = TronRight
+	case tcell.KeyDown:
+		newDir = TronDown
+	case tcell.KeyLeft:
+		newDir = TronLeft
+	default:
+		return TronCommand{}, false
+	}
+
+	clientState := gameState.ClientStates[playerID]
+
+	if !clientState.Alive || !tron.CanMoveInDir(clientState.Direction, newDir) {
+		return TronCommand{}, false
+	}
+
+	return TronCommand{Direction: newDir}, true
+}
+
+func (tl TronGameLogic) Render(s *Screen, gameState TronGameState, me string, showDebug bool) {
+	// trails only know the number of the player that left them
+	colors := TRON_COLORS
+	for _, client := range gameState.ClientStates {
+		if client.PlayerNum >= 0 && client.PlayerNum < len(colors) && client.Color != "" {
+			colors[client.PlayerNum] = client.Color
+		}
+	}
+
+	for row := 0; row < gameState.Width; row++ {
+		for col := 0; col < gameState.Height; col++ {
+			if ok, playerNum := tron.GetCollision(gameState, row, col); ok && playerNum >= 0 {
+				style := tcell.StyleDefault.Background(tcell.ColorNames[colors[playerNum]])
+
+				if showDebug {
+					s.DrawText(row, col, style, "*")
+				} else {
+					s.DrawText(row, col, style, " ")
+				}
+
+			}
+
+			if showCommits {
+				if ok, playerNum := tron.GetCollision(gameState, row, col); ok && playerNum >= 0 && playerNum < len(TRON_COLORS)-1 {
+					style := tcell.StyleDefault.Background(tcell.ColorNames[TRON_COLORS[playerNum+1]])
+					s.DrawText(row, col, style, " ")
+				}
+			}
+		}
+	}
+
+	for _, client := range gameState.ClientStates {
+		if client.Alive {
+			style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorNames[client.Color])
+			chr := getDirChr(client.Direction)
+			s.DrawText(client.X, client.Y, style, chr)
+			if client.Direction == TronLeft {
+				s.DrawText(client.X+1, client.Y, style, " ")
+			} else if client.Direction == TronRight {
+				s.DrawText(client.X-1, client.Y, style, " ")
+			}
+		} else {
+			style := tcell.StyleDefault.Foreground(tcell.ColorNames[client.Color])
+			s.DrawText(client.X, client.Y, style, "😵")
+		}
+	}
+
+	tl.renderHUD(s, gameState, me)
+}
+
+// renderHUD lists the players by name in their colors along the bottom of the
+// screen, crossing out the ones that crashed.
+func (tl TronGameLogic) renderHUD(s *Screen, gameState TronGameState, me string) {
+	playerIDs := make([]string, len(gameState.ClientStates))
+	for playerID, client := range gameState.ClientStates {
+		if client.PlayerNum >= 0 && client.PlayerNum < len(playerIDs) {
+			playerIDs[client.PlayerNum] = playerID
+		}
+	}
+
+	x := 3
+	for _, playerID := range playerIDs {
+		client, ok := gameState.ClientStates[playerID]
+		if !ok {
+			continue
+		}
+
+		name := client.Name
+		if name == "" {
+			name = shortID(playerID)
+		}
+
+		name = truncateRunes(name, maxChatNameLength)
+		if playerID == me {
+			name += " (you)"
+		}
+
+		style := tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorNames[client.Color])
+		if !client.Alive {
+			style = style.StrikeThrough(true)
+		}
+
+		s.DrawText(x, gameState.Height-1, style, name)
+		x += utf8.RuneCountInString(name) + 3
+	}
+}
+
+func getDirChr(dir TronDirection) string {
+	switch dir {
+	case TronUp:
+		return "▲"
+	case TronRight:
+		return "▶"
+	case TronDown:
+		return "▼"
+	case TronLeft:
+		return "◀"
+	}
+	return "?"
+}
@@ -0,0 +1,74 @@
+// Command distributor runs a standalone distributor, which clients connect to
+// in order to find and reach each other.
+package main
+
+import (
+	"arcade/arcade/distributor"
+	"arcade/arcade/message"
+	"arcade/arcade/net"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func main() {
+	config := distributor.DefaultConfig()
+
+	port := flag.Int("port", 6824, "Port to listen on")
+	flag.IntVar(port, "p", 6824, "Port to listen on")
+
+	adminAddr := flag.String("admin", "127.0.0.1:6825", "Address to serve stats and metrics on, or empty to disable")
+
+	flag.IntVar(&config.MaxClients, "max-clients", config.MaxClients, "Most clients connected at once, or 0 for no limit")
+	flag.IntVar(&config.MaxClientsPerIP, "max-clients-per-ip", config.MaxClientsPerIP, "Most clients connected at once from one IP address, or 0 for no limit")
+	flag.DurationVar(&config.IdleTimeout, "idle-timeout", config.IdleTimeout, "Disconnect clients that send nothing for this long")
+
+	peers := flag.String("peers", "", "Comma-separated addresses of distributors to federate with")
+
+	transportName := flag.String("transport", "kcp", "Transport to accept clients with (kcp or tcp)")
+	jsonWire := flag.Bool("json-wire", false, "Send messages as JSON instead of binary, for debugging")
+	flag.Parse()
+
+	transport, err := net.NewTransport(*transportName)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	config.Addr = fmt.Sprintf("0.0.0.0:%d", *port)
+	config.Transport = transport
+	config.Log = os.Stdout
+
+	for _, peer := range strings.Split(*peers, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			config.Peers = append(config.Peers, peer)
+		}
+	}
+
+	if *jsonWire {
+		config.Codec = message.CodecJSON
+	}
+
+	d, err := distributor.New(config)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *adminAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*adminAddr, d.AdminHandler()); err != nil {
+				fmt.Fprintln(os.Stderr, "Admin endpoint stopped:", err)
+			}
+		}()
+	}
+
+	if err := d.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
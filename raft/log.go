@@ -1,6 +1,8 @@
 package raft
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"sync"
 )
@@ -12,6 +14,17 @@ type LogEntry struct {
 	Timestep int
 }
 
+// UnmarshalJSON decodes numbers in the command as json.Number instead of
+// float64, so large integers make it across the network intact.
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	type logEntry LogEntry
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	return d.Decode((*logEntry)(e))
+}
+
 type Log struct {
 	sync.RWMutex
 
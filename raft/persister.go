@@ -9,18 +9,176 @@ package raft
 // test with the original before submitting.
 //
 
-import "sync"
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync"
+
+	"arcade/labgob"
+)
 
 type Persister struct {
 	mu        sync.Mutex
 	raftstate []byte
 	snapshot  []byte
+
+	// if set, every save is also written to this file
+	path string
+
+	// Saves are written by a separate goroutine, so that Raft doesn't wait on
+	// the disk while holding its lock. dirty is set when there is a save it
+	// hasn't started writing yet, writing while it writes one, and written is
+	// signaled after each write.
+	writes  chan struct{}
+	dirty   bool
+	writing bool
+	closed  bool
+	written *sync.Cond
+	err     error
 }
 
 func MakePersister() *Persister {
 	return &Persister{}
 }
 
+// MakeFilePersister returns a persister that keeps its state in the file at
+// path, starting from whatever state was last saved there.
+func MakeFilePersister(path string) (*Persister, error) {
+	ps := &Persister{path: path, writes: make(chan struct{}, 1)}
+	ps.written = sync.NewCond(&ps.mu)
+
+	data, err := os.ReadFile(path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		d := labgob.NewDecoder(bytes.NewBuffer(data))
+
+		var raftstate []byte
+		var snapshot []byte
+
+		if err := d.Decode(&raftstate); err != nil {
+			return nil, err
+		}
+
+		if err := d.Decode(&snapshot); err != nil {
+			return nil, err
+		}
+
+		ps.raftstate = raftstate
+		ps.snapshot = snapshot
+	}
+
+	go ps.writer()
+
+	return ps, nil
+}
+
+// save has the writer write the state to disk, if this persister is backed by
+// a file. Lock must already be held.
+func (ps *Persister) save() {
+	if ps.path == "" || ps.closed {
+		return
+	}
+
+	ps.dirty = true
+
+	select {
+	case ps.writes <- struct{}{}:
+	default:
+		// the writer already has a write pending, which picks this save up
+	}
+}
+
+// writer writes the latest state to disk whenever it is saved, until the
+// persister is closed. Saves made while a write is in progress are batched
+// into the next one.
+func (ps *Persister) writer() {
+	for range ps.writes {
+		ps.mu.Lock()
+		raftstate := ps.raftstate
+		snapshot := ps.snapshot
+		ps.dirty = false
+		ps.writing = true
+		ps.mu.Unlock()
+
+		err := writeState(ps.path, raftstate, snapshot)
+
+		if err != nil {
+			log.Println("Failed to persist Raft state:", err)
+		}
+
+		ps.mu.Lock()
+		ps.err = err
+		ps.writing = false
+		ps.written.Broadcast()
+		ps.mu.Unlock()
+	}
+}
+
+// writeState writes the state to a temporary file and syncs it before renaming
+// it over the file at path, so that a crash never leaves a partially written
+// state behind.
+func writeState(path string, raftstate []byte, snapshot []byte) error {
+	w := new(bytes.Buffer)
+	e := labgob.NewEncoder(w)
+
+	if err := e.Encode(raftstate); err != nil {
+		return err
+	}
+
+	if err := e.Encode(snapshot); err != nil {
+		return err
+	}
+
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(w.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// Close waits for the last save to be written to disk and stops the writer,
+// returning the error from the last write, if any. Later saves are only kept
+// in memory.
+func (ps *Persister) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.path == "" || ps.closed {
+		return ps.err
+	}
+
+	for ps.dirty || ps.writing {
+		ps.written.Wait()
+	}
+
+	ps.closed = true
+	close(ps.writes)
+
+	return ps.err
+}
+
 func clone(orig []byte) []byte {
 	x := make([]byte, len(orig))
 	copy(x, orig)
@@ -40,6 +198,7 @@ func (ps *Persister) SaveRaftState(state []byte) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 	ps.raftstate = clone(state)
+	ps.save()
 }
 
 func (ps *Persister) ReadRaftState() []byte {
@@ -61,6 +220,7 @@ func (ps *Persister) SaveStateAndSnapshot(state []byte, snapshot []byte) {
 	defer ps.mu.Unlock()
 	ps.raftstate = clone(state)
 	ps.snapshot = clone(snapshot)
+	ps.save()
 }
 
 func (ps *Persister) ReadSnapshot() []byte {
@@ -0,0 +1,41 @@
+package raft
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestFilePersisterRestoresState(t *testing.T) {
+	statePath := path.Join(t.TempDir(), "state.raft")
+
+	ps, err := MakeFilePersister(statePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		ps.SaveStateAndSnapshot([]byte{byte(i)}, []byte("snapshot"))
+	}
+
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := MakeFilePersister(statePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer restored.Close()
+
+	if state := restored.ReadRaftState(); !bytes.Equal(state, []byte{99}) {
+		t.Fatalf("expected the last saved state, got %v", state)
+	}
+
+	if snapshot := restored.ReadSnapshot(); string(snapshot) != "snapshot" {
+		t.Fatalf("expected the saved snapshot, got %q", snapshot)
+	}
+}
@@ -36,6 +36,13 @@ import (
 
 type BasicQueue[T any] []T
 
+// Network is how a Raft peer reaches the others. It's implemented by
+// net.Network in the game, and by an in-process stand-in in the tester.
+type Network interface {
+	SendAndReceive(client *net.Client, msg interface{}) (interface{}, error)
+	GetClient(id string) (*net.Client, bool)
+}
+
 func (bq *BasicQueue[T]) initialize(queue *[]T) {
 	*bq = *queue
 }
@@ -54,6 +61,9 @@ func (bq *BasicQueue[T]) pop() (T, bool) {
 	return element, true
 }
 
+// times a follower tries forwarding a command to the leader
+const maxForwardedStartAttempts = 5
+
 type RaftState int
 
 const (
@@ -99,11 +109,20 @@ type ApplyMsg struct {
 type Raft struct {
 	sync.RWMutex               // Lock to protect shared access to this peer's state
 	peers        []*net.Client // RPC end points of all peers
-	network      *net.Network
+	network      Network
 	persister    *Persister // Object to hold this peer's persisted state
 	me           int        // this peer's index into peers[]
 	dead         int32      // set by Kill()
 
+	// peers[:voters] vote and count towards a majority. Any peers after them
+	// are learners, which only receive the log.
+	voters  int
+	learner bool
+
+	// true if this peer restored its state after a crash, and is rejoining a
+	// game that's already running
+	rejoined bool
+
 	// Your data here (2A, 2B, 2C).
 	// Look at the paper's Figure 2 for a description of what
 	// state a Raft server must maintain.
@@ -130,6 +149,9 @@ type Raft struct {
 	timestep       int
 	timestepCond   *sync.Cond
 
+	// followers pass commands from Start on to the leader. the tester turns
+	// this off, since it expects Start to fail anywhere but on the leader
+	forwardStarts       bool
 	forwardedStartQueue BasicQueue[*ForwardedStartArgs]
 }
 
@@ -168,11 +190,11 @@ func (rf *Raft) persist(snapshot []byte) {
 	e.Encode(rf.log.GetLastIncludedTerm())
 	e.Encode(rf.log.GetEntries())
 
-	// if snapshot == nil {
-	// 	rf.persister.SaveRaftState(w.Bytes())
-	// } else {
-	// 	rf.persister.SaveStateAndSnapshot(w.Bytes(), snapshot)
-	// }
+	if snapshot == nil {
+		rf.persister.SaveRaftState(w.Bytes())
+	} else {
+		rf.persister.SaveStateAndSnapshot(w.Bytes(), snapshot)
+	}
 }
 
 //
@@ -298,6 +320,10 @@ func (rf *Raft) RequestVote(args *RequestVoteArgs) *RequestVoteReply {
 
 	// }()
 
+	if rf.learner {
+		return reply
+	}
+
 	if args.Term < rf.currentTerm {
 		log.Println("[RAFT]: RequestVote", "Reject, args.Term < currentTerm")
 		return reply
@@ -448,7 +474,11 @@ func (rf *Raft) AppendEntries(args *AppendEntriesArgs) *AppendEntriesReply {
 		return reply
 	}
 
-	// rf.timestep = args.Timestep
+	// learners and rejoining peers join late, so they follow the leader's clock
+	if (rf.learner || rf.rejoined) && args.Timestep > rf.timestep {
+		rf.timestep = args.Timestep
+	}
+
 	reply.Success = true
 
 	// 3
@@ -507,6 +537,9 @@ type InstallSnapshotArgs struct {
 
 	// Raw bytes of the snapshot chunk, starting at offset
 	Data []byte
+
+	// Leader's current timestep, so learners and rejoined peers can catch up
+	Timestep int
 }
 
 //
@@ -535,7 +568,7 @@ func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs) *InstallSnapshotReply
 	rf.Lock()
 	defer rf.Unlock()
 
-	reply := &InstallSnapshotReply{Message: message.Message{Type: "InstallSnashotReply"}}
+	reply := &InstallSnapshotReply{Message: message.Message{Type: "InstallSnapshotReply"}}
 
 	reply.ClientId = rf.me
 
@@ -557,37 +590,35 @@ func (rf *Raft) InstallSnapshot(args *InstallSnapshotArgs) *InstallSnapshotReply
 	rf.print("InstallSnapshot", fmt.Sprintf("Received snapshot, %d bytes, lastIncludedIndex=%d, lastIncludedTerm=%d", len(args.Data), args.LastIncludedIndex, args.LastIncludedTerm))
 	rf.resetElectionTimeout()
 
-	// Ignore 2-5
-
-	// 6
-	// entry, ok := rf.log.GetEntry(args.LastIncludedIndex)
-
-	// if (ok && entry.Term == args.LastIncludedTerm) || (args.LastIncludedIndex == rf.log.GetLastIncludedIndex() && args.LastIncludedTerm == rf.log.GetLastIncludedTerm()) {
-	if args.LastIncludedIndex < rf.log.LastIndex() {
-		rf.log.DeleteEntriesPreceding(args.LastIncludedIndex + 1)
+	if (rf.learner || rf.rejoined) && args.Timestep > rf.timestep {
+		rf.timestep = args.Timestep
+	}
 
-		if len(rf.log.entries) > 0 {
-			rf.log.SetLastIncludedIndex(rf.log.entries[0].Index - 1)
-			rf.log.SetLastIncludedTerm(rf.log.entries[0].Term)
-		} else {
-			rf.log.SetLastIncludedIndex(args.LastIncludedIndex)
-			rf.log.SetLastIncludedTerm(args.LastIncludedTerm)
-		}
+	// Ignore 2-5, the snapshot is always sent in one chunk
 
-		rf.persist(args.Data)
-		rf.print("InstallSnapshot", fmt.Sprintf("Deleted entries preceding %d -- %v", args.LastIncludedIndex+1, rf.log.entries))
+	// Already have everything in this snapshot
+	if args.LastIncludedIndex <= rf.log.GetLastIncludedIndex() {
 		return reply
 	}
 
-	// rf.print("InstallSnapshot", fmt.Sprintf("%t %d %d", ok, entry.Term, args.LastIncludedTerm))
+	// 6
+	if entry, ok := rf.log.GetEntry(args.LastIncludedIndex); ok && entry.Term == args.LastIncludedTerm {
+		rf.log.DeleteEntriesPreceding(args.LastIncludedIndex + 1)
+		rf.print("InstallSnapshot", fmt.Sprintf("Deleted entries preceding %d -- %v", args.LastIncludedIndex+1, rf.log.entries))
+	} else {
+		// 7
+		rf.log = &Log{}
+		rf.print("InstallSnapshot", "Cleared log")
+	}
 
-	// 7
-	rf.log = &Log{}
 	rf.log.SetLastIncludedIndex(args.LastIncludedIndex)
 	rf.log.SetLastIncludedTerm(args.LastIncludedTerm)
 	rf.persist(args.Data)
 
-	rf.print("InstallSnapshot", fmt.Sprintf("Cleared log -- %v", rf.log.entries))
+	// 8
+	if args.LastIncludedIndex > rf.commitIndex {
+		rf.commitIndex = args.LastIncludedIndex
+	}
 
 	go rf.commit()
 
@@ -633,11 +664,16 @@ func (m ForwardedStartReply) MarshalBinary() ([]byte, error) {
 func (rf *Raft) Start(command interface{}, timestep int) (int, int, bool) {
 	rf.Lock()
 
+	if rf.learner {
+		rf.Unlock()
+		return -1, -1, false
+	}
+
 	if rf.state != Leader {
 		// log.Println("[RAFT]", "currentLeader", rf.currentLeader)
-		if rf.currentLeader >= 0 {
+		if rf.forwardStarts && rf.currentLeader >= 0 {
 			args := &ForwardedStartArgs{Message: message.Message{Type: "ForwardedStart"}, ClientId: rf.me, Command: command, Timestep: timestep}
-			leader := rf.peers[rf.currentLeader]
+			leader := rf.getPeer(rf.currentLeader)
 			// log.Println("[RAFT]", "currentLeader2", leader.ID)
 			log.Println("[RAFT]", "sending forwardedstart")
 
@@ -651,11 +687,16 @@ func (rf *Raft) Start(command interface{}, timestep int) (int, int, bool) {
 						// log.Println("[RAFT]", "ForwardedStartqueue len ", len(rf.forwardedStartQueue))
 						args := rf.forwardedStartQueue[0]
 						rf.Unlock()
+						// SendAndReceive resends until the leader acknowledges
+						// the command, so only try again a few times in case
+						// the reply is slow, rather than forever
 						_, err := rf.network.SendAndReceive(leader, args)
-						for err != nil {
+						for attempt := 1; err != nil && attempt < maxForwardedStartAttempts && !rf.killed(); attempt++ {
 							// log.Println("[RAFT]", "ForwardedStart error", err, timestep)
 							_, err = rf.network.SendAndReceive(leader, args)
-
+						}
+						if err != nil {
+							log.Println("[RAFT]", "giving up on forwarding start to leader:", err)
 						}
 						rf.Lock()
 						rf.forwardedStartQueue.pop()
@@ -779,16 +820,18 @@ func (rf *Raft) runElection() {
 		ClientId:     rf.me,
 	}
 
-	votes := make(chan *RequestVoteReply, len(rf.peers))
+	votes := make(chan *RequestVoteReply, rf.voters)
 
 	rf.print("runElection", "Requesting votes")
 
-	for i, peer := range rf.peers {
+	for i := range rf.peers[:rf.voters] {
 		if i == rf.me {
 			votes <- &RequestVoteReply{message.Message{Type: "RequestVoteReply"}, rf.currentTerm, true, rf.me}
 			continue
 		}
 
+		peer := rf.getPeer(i)
+
 		go func(votes chan *RequestVoteReply, peer *net.Client) {
 			log.Println("[RAFT]:", "SENDING vote req", args, peer)
 			if reply, err := rf.network.SendAndReceive(peer, args); err == nil {
@@ -803,7 +846,7 @@ func (rf *Raft) runElection() {
 
 	voteCount := 0
 
-	for range rf.peers {
+	for range rf.peers[:rf.voters] {
 		go func() {
 			reply := <-votes
 
@@ -834,7 +877,7 @@ func (rf *Raft) runElection() {
 
 			voteCount++
 
-			if voteCount <= len(rf.peers)/2 {
+			if voteCount <= rf.voters/2 {
 				log.Println("[RAFT]:", "runElection, return", "not enough")
 				return
 			}
@@ -867,7 +910,7 @@ func (rf *Raft) electionTicker() {
 	rf.Lock()
 	defer rf.Unlock()
 
-	if time.Now().Before(rf.electionTimeout) {
+	if time.Now().Before(rf.electionTimeout) || rf.learner {
 		return
 	}
 
@@ -911,12 +954,12 @@ func (rf *Raft) sendAllAppendEntries() {
 
 	rf.matchIndex[rf.me] = rf.log.LastIndex()
 
-	for server, peer := range rf.peers {
+	for server := range rf.peers {
 		if server == rf.me {
 			continue
 		}
 
-		rf.sendAppendEntries(server, peer)
+		rf.sendAppendEntries(server, rf.getPeer(server))
 	}
 }
 
@@ -933,25 +976,44 @@ func (rf *Raft) sendAppendEntries(server int, peer *net.Client) {
 			ClientId:          rf.me,
 			LastIncludedIndex: rf.log.GetLastIncludedIndex(),
 			LastIncludedTerm:  rf.log.GetLastIncludedTerm(),
-			// Data:              rf.persister.ReadSnapshot(),
+			Data:              rf.persister.ReadSnapshot(),
+			Timestep:          rf.timestep,
 		}
 
 		rf.print("sendAppendEntries", fmt.Sprintf("Sending InstallSnapshot to %d, prevLogIndex=%d, lastIncludedIndex=%d, lastIncludedTerm=%d, size=%d", server, prevLogIndex, rf.log.GetLastIncludedIndex(), rf.log.GetLastIncludedTerm(), len(args.Data)))
 
 		go func() {
-			if _, err := rf.network.SendAndReceive(peer, args); err == nil {
+			reply, err := rf.network.SendAndReceive(peer, args)
+
+			if err != nil {
 				return
 			}
 
-			rf.Lock()
-			defer rf.Unlock()
+			if reply, ok := reply.(*InstallSnapshotReply); ok {
+				rf.Lock()
+				defer rf.Unlock()
 
-			if rf.killed() || rf.state != Leader || rf.currentTerm != args.Term {
-				return
-			}
+				if rf.killed() || rf.state != Leader || rf.currentTerm != args.Term {
+					return
+				}
+
+				if reply.Term > rf.currentTerm {
+					rf.startNewTerm(reply.Term, NullPeer, reply.ClientId)
+					rf.persist(nil)
+					return
+				}
+
+				if !rf.isPeer(server, peer) {
+					return
+				}
 
-			rf.nextIndex[server] = args.LastIncludedIndex + 1
-			rf.matchIndex[server] = args.LastIncludedIndex
+				if args.LastIncludedIndex > rf.matchIndex[server] {
+					rf.matchIndex[server] = args.LastIncludedIndex
+					rf.nextIndex[server] = args.LastIncludedIndex + 1
+				}
+
+				rf.updateCommitIndex()
+			}
 		}()
 
 		return
@@ -1007,6 +1069,10 @@ func (rf *Raft) sendAppendEntries(server int, peer *net.Client) {
 				return
 			}
 
+			if !rf.isPeer(server, peer) {
+				return
+			}
+
 			if reply.Success {
 				// log.Println("[RAFT]", "AppendEntries", "advance index")
 				rf.matchIndex[server] = args.PrevLogIndex + len(entries)
@@ -1050,13 +1116,13 @@ func (rf *Raft) updateCommitIndex() {
 	for i := rf.log.LastIndex(); i > rf.commitIndex; i-- {
 		count := 0
 
-		for j := range rf.matchIndex {
+		for j := 0; j < rf.voters; j++ {
 			if rf.matchIndex[j] >= i {
 				count++
 			}
 		}
 
-		if count <= len(rf.peers)/2 {
+		if count <= rf.voters/2 {
 			continue
 		}
 
@@ -1090,17 +1156,24 @@ func (rf *Raft) commit() {
 		}
 
 		if index <= rf.log.GetLastIncludedIndex() {
-			rf.applyCh <- ApplyMsg{
+			applyMsg := ApplyMsg{
 				SnapshotValid: true,
-				// Snapshot:      rf.persister.ReadSnapshot(),
+				Snapshot:      rf.persister.ReadSnapshot(),
 				SnapshotTerm:  rf.log.GetLastIncludedTerm(),
 				SnapshotIndex: rf.log.GetLastIncludedIndex(),
 			}
 
-			rf.print("commit", fmt.Sprintf("%v", rf.log.entries))
-			rf.print("commit", fmt.Sprintf("Applying snapshot, %d", rf.log.GetLastIncludedIndex()))
+			rf.print("commit", fmt.Sprintf("Applying snapshot, %d", applyMsg.SnapshotIndex))
 
-			rf.lastApplied = rf.log.GetLastIncludedIndex()
+			// The service may call Snapshot while handling an applied entry, so
+			// don't hold the lock while sending
+			rf.Unlock()
+			rf.applyCh <- applyMsg
+
+			rf.Lock()
+			if applyMsg.SnapshotIndex > rf.lastApplied {
+				rf.lastApplied = applyMsg.SnapshotIndex
+			}
 			rf.Unlock()
 
 			continue
@@ -1130,6 +1203,23 @@ func (rf *Raft) commit() {
 	}
 }
 
+// getPeer looks up the current client for a peer by its ID. Clients are
+// replaced when a peer reconnects, e.g. after restarting mid-game, so the
+// client we were created with may be stale. Lock must already be held.
+func (rf *Raft) getPeer(server int) *net.Client {
+	peer := rf.peers[server]
+
+	if peer.ID == "" {
+		return peer
+	}
+
+	if client, ok := rf.network.GetClient(peer.ID); ok {
+		return client
+	}
+
+	return peer
+}
+
 func (rf *Raft) GetPersistentSize() int {
 	return rf.persister.RaftStateSize()
 }
@@ -1176,7 +1266,7 @@ func (rf *Raft) ProcessMessage(from interface{}, data interface{}) interface{} {
 // Make() must return quickly, so it should start goroutines
 // for any long-running work.
 //
-func Make(peers []*net.Client, me int, applyCh chan ApplyMsg, network *net.Network, timestepPeriod int, timestepCond *sync.Cond) *Raft {
+func Make(peers []*net.Client, me int, persister *Persister, applyCh chan ApplyMsg, network Network, timestepPeriod int, timestepCond *sync.Cond) *Raft {
 	log.Printf("[RAFT] %p", &timestepCond.L)
 	rand.Seed(time.Now().UnixNano())
 
@@ -1184,9 +1274,11 @@ func Make(peers []*net.Client, me int, applyCh chan ApplyMsg, network *net.Netwo
 
 	rf := &Raft{}
 	rf.peers = peers
-	// rf.persister = persister
+	rf.persister = persister
 	rf.me = me
+	rf.voters = len(peers)
 	rf.network = network
+	rf.forwardStarts = true
 
 	// Initialization
 	rf.log = &Log{}
@@ -1206,12 +1298,84 @@ func Make(peers []*net.Client, me int, applyCh chan ApplyMsg, network *net.Netwo
 	rf.resetElectionTimeout()
 
 	// initialize from state persisted before a crash
-	// rf.readPersist(persister.ReadRaftState())
+	rf.rejoined = persister.RaftStateSize() > 0
+	rf.readPersist(persister.ReadRaftState())
 	rf.commitIndex = rf.log.GetLastIncludedIndex()
-	rf.lastApplied = rf.log.GetLastIncludedIndex()
+
+	// hand the persisted snapshot back to the service before any entries
+	if rf.commitIndex > 0 {
+		go rf.commit()
+	}
 
 	// message.AddListener(message.Listener{Handle: rf.processMessage})
 
 	log.Println("[RAFT", "NEW LOG: ", rf.log, rf.log.lastIncludedIndex, rf.log.lastIncludedIndex)
 	return rf
 }
+
+//
+// create a Raft learner that follows the log of the given voters without
+// voting or proposing commands. the voters must each call AddLearner for it
+// to start receiving entries.
+//
+func MakeLearner(voters []*net.Client, applyCh chan ApplyMsg, network Network, timestepPeriod int, timestepCond *sync.Cond) *Raft {
+	peers := append(append([]*net.Client{}, voters...), &net.Client{})
+
+	rf := Make(peers, len(voters), MakePersister(), applyCh, network, timestepPeriod, timestepCond)
+
+	rf.Lock()
+	rf.voters = len(voters)
+	rf.learner = true
+	rf.Unlock()
+
+	return rf
+}
+
+// AddLearner adds a peer that receives the log but doesn't vote. Adding the
+// same peer twice is a no-op.
+func (rf *Raft) AddLearner(peer *net.Client) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	for _, p := range rf.peers[rf.voters:] {
+		if p.ID == peer.ID {
+			return
+		}
+	}
+
+	// Learners start with an empty log, so anything already compacted is sent
+	// as a snapshot
+	rf.peers = append(rf.peers, peer)
+	rf.nextIndex = append(rf.nextIndex, 1)
+	rf.matchIndex = append(rf.matchIndex, 0)
+
+	log.Println("[RAFT]", "Added learner", peer.ID)
+}
+
+// RemoveLearner stops sending the log to a learner that left. Removing a peer
+// that isn't a learner is a no-op.
+func (rf *Raft) RemoveLearner(peerID string) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	for i := rf.voters; i < len(rf.peers); i++ {
+		// learners keep themselves after the voters
+		if i == rf.me || rf.peers[i].ID != peerID {
+			continue
+		}
+
+		rf.peers = append(rf.peers[:i:i], rf.peers[i+1:]...)
+		rf.nextIndex = append(rf.nextIndex[:i:i], rf.nextIndex[i+1:]...)
+		rf.matchIndex = append(rf.matchIndex[:i:i], rf.matchIndex[i+1:]...)
+
+		log.Println("[RAFT]", "Removed learner", peerID)
+		return
+	}
+}
+
+// Removing a learner shifts the ones after it, so replies must check that the
+// peer they were sent to is still at the same index. Lock must already be
+// held.
+func (rf *Raft) isPeer(server int, peer *net.Client) bool {
+	return server < len(rf.peers) && rf.peers[server].ID == peer.ID
+}
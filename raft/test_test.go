@@ -209,7 +209,7 @@ func For2023TestFollowerFailure2B(t *testing.T) {
 	cfg.disconnect((leader2 + 2) % servers)
 
 	// submit a command.
-	index, _, ok := cfg.rafts[leader2].Start(104)
+	index, _, ok := cfg.rafts[leader2].Start(104, 0)
 	if ok != true {
 		t.Fatalf("leader rejected Start()")
 	}
@@ -256,7 +256,7 @@ func For2023TestLeaderFailure2B(t *testing.T) {
 
 	// submit a command to each server.
 	for i := 0; i < servers; i++ {
-		cfg.rafts[i].Start(104)
+		cfg.rafts[i].Start(104, 0)
 	}
 
 	time.Sleep(2 * RaftElectionTimeout)
@@ -323,7 +323,7 @@ func TestFailNoAgree2B(t *testing.T) {
 	cfg.disconnect((leader + 2) % servers)
 	cfg.disconnect((leader + 3) % servers)
 
-	index, _, ok := cfg.rafts[leader].Start(20)
+	index, _, ok := cfg.rafts[leader].Start(20, 0)
 	if ok != true {
 		t.Fatalf("leader rejected Start()")
 	}
@@ -346,7 +346,7 @@ func TestFailNoAgree2B(t *testing.T) {
 	// the disconnected majority may have chosen a leader from
 	// among their own ranks, forgetting index 2.
 	leader2 := cfg.checkOneLeader()
-	index2, _, ok2 := cfg.rafts[leader2].Start(30)
+	index2, _, ok2 := cfg.rafts[leader2].Start(30, 0)
 	if ok2 == false {
 		t.Fatalf("leader2 rejected Start()")
 	}
@@ -375,7 +375,7 @@ loop:
 		}
 
 		leader := cfg.checkOneLeader()
-		_, term, ok := cfg.rafts[leader].Start(1)
+		_, term, ok := cfg.rafts[leader].Start(1, 0)
 		if !ok {
 			// leader moved on really quickly
 			continue
@@ -388,7 +388,7 @@ loop:
 			wg.Add(1)
 			go func(i int) {
 				defer wg.Done()
-				i, term1, ok := cfg.rafts[leader].Start(100 + i)
+				i, term1, ok := cfg.rafts[leader].Start(100+i, 0)
 				if term1 != term {
 					return
 				}
@@ -474,9 +474,9 @@ func TestRejoin2B(t *testing.T) {
 	cfg.disconnect(leader1)
 
 	// make old leader try to agree on some entries
-	cfg.rafts[leader1].Start(102)
-	cfg.rafts[leader1].Start(103)
-	cfg.rafts[leader1].Start(104)
+	cfg.rafts[leader1].Start(102, 0)
+	cfg.rafts[leader1].Start(103, 0)
+	cfg.rafts[leader1].Start(104, 0)
 
 	// new leader commits, also for index=2
 	cfg.one(103, 2, true)
@@ -515,7 +515,7 @@ func TestBackup2B(t *testing.T) {
 
 	// submit lots of commands that won't commit
 	for i := 0; i < 50; i++ {
-		cfg.rafts[leader1].Start(rand.Int())
+		cfg.rafts[leader1].Start(rand.Int(), 0)
 	}
 
 	time.Sleep(RaftElectionTimeout / 2)
@@ -543,7 +543,7 @@ func TestBackup2B(t *testing.T) {
 
 	// lots more commands that won't commit
 	for i := 0; i < 50; i++ {
-		cfg.rafts[leader2].Start(rand.Int())
+		cfg.rafts[leader2].Start(rand.Int(), 0)
 	}
 
 	time.Sleep(RaftElectionTimeout / 2)
@@ -605,7 +605,7 @@ loop:
 		total1 = rpcs()
 
 		iters := 10
-		starti, term, ok := cfg.rafts[leader].Start(1)
+		starti, term, ok := cfg.rafts[leader].Start(1, 0)
 		if !ok {
 			// leader moved on really quickly
 			continue
@@ -614,7 +614,7 @@ loop:
 		for i := 1; i < iters+2; i++ {
 			x := int(rand.Int31())
 			cmds = append(cmds, x)
-			index1, term1, ok := cfg.rafts[leader].Start(x)
+			index1, term1, ok := cfg.rafts[leader].Start(x, 0)
 			if term1 != term {
 				// Term changed while starting
 				continue loop
@@ -826,7 +826,7 @@ func TestFigure82C(t *testing.T) {
 		leader := -1
 		for i := 0; i < servers; i++ {
 			if cfg.rafts[i] != nil {
-				_, _, ok := cfg.rafts[i].Start(rand.Int())
+				_, _, ok := cfg.rafts[i].Start(rand.Int(), 0)
 				if ok {
 					leader = i
 				}
@@ -913,7 +913,7 @@ func TestFigure8Unreliable2C(t *testing.T) {
 		}
 		leader := -1
 		for i := 0; i < servers; i++ {
-			_, _, ok := cfg.rafts[i].Start(rand.Int() % 10000)
+			_, _, ok := cfg.rafts[i].Start(rand.Int()%10000, 0)
 			if ok && cfg.connected[i] {
 				leader = i
 			}
@@ -982,7 +982,7 @@ func internalChurn(t *testing.T, unreliable bool) {
 				rf := cfg.rafts[i]
 				cfg.mu.Unlock()
 				if rf != nil {
-					index1, _, ok1 := rf.Start(x)
+					index1, _, ok1 := rf.Start(x, 0)
 					if ok1 {
 						ok = ok1
 						index = index1
@@ -1138,7 +1138,7 @@ func snapcommon(t *testing.T, name string, disconnect bool, reliable bool, crash
 		// perhaps send enough to get a snapshot
 		nn := (SnapShotInterval / 2) + (rand.Int() % SnapShotInterval)
 		for i := 0; i < nn; i++ {
-			cfg.rafts[sender].Start(rand.Int())
+			cfg.rafts[sender].Start(rand.Int(), 0)
 		}
 
 		// let applier threads catch up with the Start()'s
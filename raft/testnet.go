@@ -0,0 +1,238 @@
+package raft
+
+//
+// an in-process stand-in for net.Network, used by the Raft tester.
+//
+// messages take the same path they do between players: they're marshaled
+// with MarshalBinary, decoded back into their message type on the other
+// side, handed to the recipient's ProcessMessage, and the reply makes the
+// same trip back. servers can be disconnected or crashed, and the network
+// can be made unreliable (delays and drops) or made to reorder replies.
+//
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"arcade/arcade/net"
+)
+
+// same as the real network, a request that gets no reply fails after this
+const testSendAndReceiveTimeout = 500 * time.Millisecond
+
+type testNetwork struct {
+	mu             sync.Mutex
+	reliable       bool
+	longReordering bool // sometimes delay replies a long time
+
+	ends    map[string]*testEnd // current end of each server, by peer ID
+	servers map[string]*Raft    // running servers, by peer ID
+	enabled map[string]bool     // whether each server is on the net
+
+	counts     map[string]int // incoming messages, by peer ID
+	totalCount int32
+	bytes      int64
+}
+
+// testEnd is the Network handed to a single Raft instance. restarting a
+// server gives it a new end, so a crashed instance can't send anything.
+type testEnd struct {
+	net *testNetwork
+	id  string
+}
+
+func makeTestNetwork() *testNetwork {
+	return &testNetwork{
+		reliable: true,
+		ends:     make(map[string]*testEnd),
+		servers:  make(map[string]*Raft),
+		enabled:  make(map[string]bool),
+		counts:   make(map[string]int),
+	}
+}
+
+func (tn *testNetwork) makeEnd(id string) *testEnd {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	end := &testEnd{net: tn, id: id}
+	tn.ends[id] = end
+
+	return end
+}
+
+func (tn *testNetwork) addServer(id string, rf *Raft) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	tn.servers[id] = rf
+}
+
+func (tn *testNetwork) deleteServer(id string) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	delete(tn.servers, id)
+}
+
+func (tn *testNetwork) enable(id string, enabled bool) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	tn.enabled[id] = enabled
+}
+
+func (tn *testNetwork) setReliable(reliable bool) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	tn.reliable = reliable
+}
+
+func (tn *testNetwork) setLongReordering(longReordering bool) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	tn.longReordering = longReordering
+}
+
+func (tn *testNetwork) getCount(id string) int {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	return tn.counts[id]
+}
+
+func (tn *testNetwork) getTotalCount() int {
+	return int(atomic.LoadInt32(&tn.totalCount))
+}
+
+func (tn *testNetwork) getTotalBytes() int64 {
+	return atomic.LoadInt64(&tn.bytes)
+}
+
+// lookup returns the server a message from end to id would be delivered to,
+// or nil if either side is disconnected or crashed.
+func (tn *testNetwork) lookup(end *testEnd, id string) (*Raft, bool, bool) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+
+	if tn.ends[end.id] != end || !tn.enabled[end.id] || !tn.enabled[id] {
+		return nil, tn.reliable, tn.longReordering
+	}
+
+	return tn.servers[id], tn.reliable, tn.longReordering
+}
+
+func (tn *testNetwork) send(end *testEnd, id string, msg interface{}) (interface{}, error) {
+	atomic.AddInt32(&tn.totalCount, 1)
+
+	data, err := msg.(encoding.BinaryMarshaler).MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&tn.bytes, int64(len(data)))
+
+	server, reliable, longReordering := tn.lookup(end, id)
+
+	if server == nil {
+		// nothing arrives, so wait for the timeout
+		time.Sleep(testSendAndReceiveTimeout)
+		return nil, errors.New("timed out")
+	}
+
+	if !reliable {
+		// short delay
+		time.Sleep(time.Duration(rand.Intn(27)) * time.Millisecond)
+
+		if rand.Intn(1000) < 100 {
+			// drop the request
+			time.Sleep(testSendAndReceiveTimeout)
+			return nil, errors.New("timed out")
+		}
+	}
+
+	tn.mu.Lock()
+	tn.counts[id]++
+	tn.mu.Unlock()
+
+	req, err := decodeTestMessage(msg, data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply := server.ProcessMessage(&net.Client{ID: end.id}, req)
+
+	if reply == nil {
+		time.Sleep(testSendAndReceiveTimeout)
+		return nil, errors.New("timed out")
+	}
+
+	// don't reply if the server was crashed or disconnected in the meantime,
+	// in case it had already persisted to a persister that's been replaced
+	if current, _, _ := tn.lookup(end, id); current != server {
+		time.Sleep(testSendAndReceiveTimeout)
+		return nil, errors.New("timed out")
+	}
+
+	if !reliable && rand.Intn(1000) < 100 {
+		// drop the reply
+		time.Sleep(testSendAndReceiveTimeout)
+		return nil, errors.New("timed out")
+	}
+
+	if longReordering && rand.Intn(900) < 600 {
+		// delay the reply for a while, which may be long enough to time out
+		delay := time.Duration(200+rand.Intn(1+rand.Intn(2000))) * time.Millisecond
+
+		if delay >= testSendAndReceiveTimeout {
+			time.Sleep(testSendAndReceiveTimeout)
+			return nil, errors.New("timed out")
+		}
+
+		time.Sleep(delay)
+	}
+
+	data, err = reply.(encoding.BinaryMarshaler).MarshalBinary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&tn.bytes, int64(len(data)))
+
+	return decodeTestMessage(reply, data)
+}
+
+// decodeTestMessage decodes data into a new message of the same type as msg,
+// like the real network does when a message arrives.
+func decodeTestMessage(msg interface{}, data []byte) (interface{}, error) {
+	decoded := reflect.New(reflect.TypeOf(msg).Elem()).Interface()
+
+	if err := json.Unmarshal(data, decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+//
+// Network methods
+//
+
+func (end *testEnd) SendAndReceive(client *net.Client, msg interface{}) (interface{}, error) {
+	return end.net.send(end, client.ID, msg)
+}
+
+func (end *testEnd) GetClient(id string) (*net.Client, bool) {
+	return nil, false
+}